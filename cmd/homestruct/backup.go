@@ -0,0 +1,312 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/backup"
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+func runBackup(args []string) error {
+	if len(args) < 1 {
+		return usageErrorf("missing backup subcommand (list, restore, verify, prune)")
+	}
+
+	switch args[0] {
+	case "list":
+		return runBackupList(args[1:])
+	case "restore":
+		return runBackupRestore(args[1:])
+	case "verify":
+		return runBackupVerify(args[1:])
+	case "prune":
+		return runBackupPrune(args[1:])
+	default:
+		return usageErrorf("unknown backup subcommand: %s", args[0])
+	}
+}
+
+func runBackupList(args []string) error {
+	fs := flag.NewFlagSet("backup list", flag.ContinueOnError)
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	backupRoot := fs.String("backup-root", "", "Directory backups are kept under (default: target home)")
+	subdirTemplate := fs.String("backup-subdir", "", "Template for the snapshot subdirectory (e.g. {{ .Hostname }})")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	homeDir, root, err := resolveHomes(*home, *backupRoot)
+	if err != nil {
+		return err
+	}
+	dir, err := snapshotsDir(homeDir, root, *subdirTemplate)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := backup.ListSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No backups found")
+		return nil
+	}
+
+	for _, s := range snapshots {
+		files, err := s.Files()
+		if err != nil {
+			return err
+		}
+		kind := "dir"
+		if s.Archive {
+			kind = "archive"
+		}
+		fmt.Printf("%s  %-7s  %3d files  %s", s.Timestamp, kind, len(files), s.Path)
+		if s.Base != "" {
+			fmt.Printf("  (incremental, base %s)", s.Base)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func runBackupRestore(args []string) error {
+	fs := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	timestamp := fs.String("timestamp", "", "Snapshot to restore (default: most recent)")
+	dryRun := fs.Bool("dry-run", false, "Show what would be restored without changing anything")
+
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	backupRoot := fs.String("backup-root", "", "Directory backups are kept under (default: target home)")
+	wait := fs.Bool("wait", false, "Wait for another run holding the lock instead of failing")
+	subdirTemplate := fs.String("backup-subdir", "", "Template for the snapshot subdirectory (e.g. {{ .Hostname }})")
+	var paths stringList
+	fs.Var(&paths, "path", "Only restore this file or directory, relative to home, or files matching this glob (repeatable)")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	homeDir, root, err := resolveHomes(*home, *backupRoot)
+	if err != nil {
+		return err
+	}
+
+	subdir, err := homeSubdir(homeDir, *subdirTemplate)
+	if err != nil {
+		return err
+	}
+	mgr := backup.New(homeDir)
+	mgr.SetRoot(root)
+	if err := mgr.SetSubdir(subdir); err != nil {
+		return err
+	}
+	dir, err := backup.SnapshotsDir(root, subdir)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		lock, err := acquireRunLock(homeDir, *wait, nil)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	snapshot, err := backup.FindSnapshot(dir, *timestamp)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restoring snapshot %s\n", snapshot.Timestamp)
+	if *dryRun {
+		fmt.Println("=== DRY RUN MODE ===")
+	}
+	fmt.Println()
+
+	restored, err := mgr.Restore(backup.RestoreOptions{
+		Timestamp: snapshot.Timestamp,
+		Paths:     paths,
+		DryRun:    *dryRun,
+		Warn:      func(w string) { fmt.Fprintf(os.Stderr, "Warning: %s\n", w) },
+	})
+	for _, path := range restored {
+		fmt.Printf("[RESTORE] %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if *dryRun {
+		fmt.Printf("Would restore %d files (dry run - no changes made)\n", len(restored))
+	} else {
+		fmt.Printf("Restored %d files\n", len(restored))
+	}
+	return nil
+}
+
+func runBackupVerify(args []string) error {
+	fs := flag.NewFlagSet("backup verify", flag.ContinueOnError)
+	timestamp := fs.String("timestamp", "", "Snapshot to verify (default: most recent)")
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	backupRoot := fs.String("backup-root", "", "Directory backups are kept under (default: target home)")
+	subdirTemplate := fs.String("backup-subdir", "", "Template for the snapshot subdirectory (e.g. {{ .Hostname }})")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	homeDir, root, err := resolveHomes(*home, *backupRoot)
+	if err != nil {
+		return err
+	}
+	dir, err := snapshotsDir(homeDir, root, *subdirTemplate)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := backup.FindSnapshot(dir, *timestamp)
+	if err != nil {
+		return err
+	}
+
+	problems, err := snapshot.Verify()
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Printf("[CORRUPT] %s\n", p)
+	}
+	if len(problems) > 0 {
+		return withExitCode(ExitVerify, fmt.Errorf("snapshot %s failed verification with %d problems", snapshot.Timestamp, len(problems)))
+	}
+
+	fmt.Printf("Snapshot %s verified\n", snapshot.Timestamp)
+	return nil
+}
+
+func runBackupPrune(args []string) error {
+	fs := flag.NewFlagSet("backup prune", flag.ContinueOnError)
+	keep := fs.Int("keep", 0, "Keep this many most recent snapshots regardless of age")
+	olderThan := fs.String("older-than", "", "Only remove snapshots older than this age (e.g. 30d, 2w, 12h)")
+	dryRun := fs.Bool("dry-run", false, "List the snapshots that would be removed without removing them")
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	backupRoot := fs.String("backup-root", "", "Directory backups are kept under (default: target home)")
+	wait := fs.Bool("wait", false, "Wait for another run holding the lock instead of failing")
+	subdirTemplate := fs.String("backup-subdir", "", "Template for the snapshot subdirectory (e.g. {{ .Hostname }})")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	opts := backup.PruneOptions{Keep: *keep}
+	if *olderThan != "" {
+		age, err := parseAge(*olderThan)
+		if err != nil {
+			return fmt.Errorf("invalid --older-than: %w", err)
+		}
+		opts.OlderThan = age
+	}
+	if opts.Keep <= 0 && opts.OlderThan == 0 {
+		return usageErrorf("usage: homestruct backup prune --keep <n> and/or --older-than <age>")
+	}
+
+	homeDir, root, err := resolveHomes(*home, *backupRoot)
+	if err != nil {
+		return err
+	}
+	dir, err := snapshotsDir(homeDir, root, *subdirTemplate)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		lock, err := acquireRunLock(homeDir, *wait, nil)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	pruned, err := backup.Prune(dir, opts, *dryRun)
+	for _, s := range pruned {
+		fmt.Printf("[PRUNE] %s  %s\n", s.Timestamp, s.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(pruned) == 0:
+		fmt.Println("No snapshots to prune")
+	case *dryRun:
+		fmt.Printf("\nWould remove %d snapshots (dry run - no changes made)\n", len(pruned))
+	default:
+		fmt.Printf("\nRemoved %d snapshots\n", len(pruned))
+	}
+	return nil
+}
+
+// parseAge parses a duration as accepted by time.ParseDuration, or a whole
+// number of days or weeks with a d or w suffix.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g. 30d, 2w or 12h)", s)
+	}
+	return age, nil
+}
+
+// backupSubdir renders a --backup-subdir template with the context.
+func backupSubdir(tmpl string, ctx *generator.Context) (string, error) {
+	if tmpl == "" {
+		return "", nil
+	}
+
+	t, err := template.New("backup-subdir").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse backup subdirectory template: %w", err)
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, ctx); err != nil {
+		return "", fmt.Errorf("failed to render backup subdirectory template: %w", err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// snapshotsDir returns the directory holding the snapshots under root for
+// the --backup-subdir template, rendered with the context of homeDir.
+func snapshotsDir(homeDir, root, subdirTemplate string) (string, error) {
+	subdir, err := homeSubdir(homeDir, subdirTemplate)
+	if err != nil {
+		return "", err
+	}
+	return backup.SnapshotsDir(root, subdir)
+}
+
+// homeSubdir renders the --backup-subdir template with the context of homeDir.
+func homeSubdir(homeDir, subdirTemplate string) (string, error) {
+	ctx, err := generator.NewContext()
+	if err != nil {
+		return "", fmt.Errorf("failed to create context: %w", err)
+	}
+	ctx.Home = homeDir
+	return backupSubdir(subdirTemplate, ctx)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// writeBundle writes every rendered result to a single file, each preceded by
+// a "### <dest> ###" header, for review as one document. Sensitive content is
+// redacted.
+func writeBundle(path string, results []generator.Result) error {
+	var sb strings.Builder
+	for i, r := range results {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "### %s ###\n", r.DestPath)
+		fmt.Fprintf(&sb, "# source: %s\n", r.TemplatePath)
+		content := r.Preview()
+		sb.WriteString(content)
+		if !strings.HasSuffix(content, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write bundle %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// printCacheStatuses explains for --show-cache why each file was or was not
+// regenerated, with shortened input hashes.
+func printCacheStatuses(w io.Writer, statuses []generator.CacheStatus) {
+	for _, s := range statuses {
+		tag := "MISS"
+		if s.Hit {
+			tag = "HIT"
+		}
+		fmt.Fprintf(w, "[CACHE %s] %s (%s)\n", tag, s.DestPath, s.Reason)
+		if s.Input != "" || s.Stored != "" {
+			fmt.Fprintf(w, "  Input: %s  Recorded: %s\n", shortHash(s.Input), shortHash(s.Stored))
+		}
+	}
+	if len(statuses) > 0 {
+		fmt.Fprintln(w)
+	}
+}
+
+// shortHash abbreviates a hex hash for display, or returns "-" if it is empty.
+func shortHash(h string) string {
+	switch {
+	case h == "":
+		return "-"
+	case len(h) > 12:
+		return h[:12]
+	default:
+		return h
+	}
+}
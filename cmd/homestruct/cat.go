@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runCat(args []string) error {
+	fs := flag.NewFlagSet("cat", flag.ContinueOnError)
+	var sets stringList
+	fs.Var(&sets, "set", "Set a template value as key=value (repeatable)")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable)")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable)")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays of the defaults and values files")
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	source := addTemplateSourceFlags(fs)
+	remoteOpts := addRemoteValuesFlags(fs)
+
+	// Allow the destination before the flags
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		args = append(args[1:], args[0])
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: homestruct cat <dest>")
+	}
+
+	gen, err := source.newGenerator(false)
+	if err != nil {
+		return err
+	}
+	if *home != "" {
+		gen.SetHome(*home)
+	}
+	// Asking for a file by name renders it even if its tool is missing
+	gen.SetIgnoreRequires(true)
+	gen.SetProfile(*profile)
+	if err := gen.LoadValues(valuesFiles, sets); err != nil {
+		return err
+	}
+	if err := gen.LoadData(dataFiles); err != nil {
+		return err
+	}
+	if err := remoteOpts.load(gen.Context(), *source.offline); err != nil {
+		return err
+	}
+
+	result, err := gen.GenerateOne(fs.Arg(0))
+	for _, w := range gen.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.WriteString(result.Content)
+	return err
+}
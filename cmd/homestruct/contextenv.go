@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// printContextEnv writes the context as "export HOMESTRUCT_<NAME>=<value>"
+// lines for --print-context-env, quoted for POSIX shells so the output can
+// be eval'd. HOMESTRUCT_OS, _ARCH, _CONTAINER, _WSL, _VM, _TERM,
+// _TERM_PROGRAM and _TRUECOLOR are also the overrides NewContext reads, so a
+// later run in that environment sees the same values.
+func printContextEnv(w io.Writer, ctx *generator.Context) {
+	vars := []struct{ name, value string }{
+		{"OS", ctx.OS},
+		{"ARCH", ctx.Arch},
+		{"HOME", ctx.Home},
+		{"USER", ctx.User},
+		{"GROUP", ctx.Group},
+		{"HOSTNAME", ctx.Hostname},
+		{"SHELL", ctx.Shell},
+		{"CONFIG_HOME", ctx.ConfigHome},
+		{"DATA_HOME", ctx.DataHome},
+		{"STATE_HOME", ctx.StateHome},
+		{"CACHE_HOME", ctx.CacheHome},
+		{"CONTAINER", boolEnv(ctx.IsContainer)},
+		{"WSL", boolEnv(ctx.IsWSL)},
+		{"VM", boolEnv(ctx.IsVM)},
+		{"TERM", ctx.Term},
+		{"TERM_PROGRAM", ctx.TermProgram},
+		{"TRUECOLOR", boolEnv(ctx.TrueColor)},
+	}
+	for _, v := range vars {
+		fmt.Fprintf(w, "export HOMESTRUCT_%s=%s\n", v.name, shellQuote(v.value))
+	}
+}
+
+// boolEnv formats b as "1" or "0".
+func boolEnv(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
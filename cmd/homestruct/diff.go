@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/remote"
+)
+
+// runDiff renders the --template-dir templates as they are on disk and as
+// they were at a git revision, and prints how each generated file differs.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	rev := fs.String("template-rev", "", "Git revision of the templates to compare the working tree against (e.g. HEAD)")
+	var sets stringList
+	fs.Var(&sets, "set", "Set a template value as key=value (repeatable)")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable)")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable)")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays of the defaults and values files")
+	source := addTemplateSourceFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *rev == "" {
+		return usageErrorf("usage: homestruct diff --template-rev <rev> --template-dir <dir>")
+	}
+	if len(*source.dirs) != 1 || *source.url != "" {
+		return usageErrorf("--template-rev requires a single --template-dir pointing into a git checkout")
+	}
+	dir := (*source.dirs)[0]
+
+	root, err := templateRoot(dir)
+	if err != nil {
+		return err
+	}
+	revDir, err := os.MkdirTemp("", "homestruct-rev-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(revDir)
+	if err := checkoutTemplates(root, *rev, revDir); err != nil {
+		return err
+	}
+
+	newGen, err := source.newGenerator(false)
+	if err != nil {
+		return err
+	}
+	oldGen, err := generator.New(os.DirFS(revDir), false)
+	if err != nil {
+		return fmt.Errorf("failed to initialize generator: %w", err)
+	}
+	if err := oldGen.SetTemplateExt(*source.ext); err != nil {
+		return err
+	}
+
+	// Only the directory itself is compared, without the built-in fallback
+	newFS, err := openTemplateDir(dir)
+	if err != nil {
+		return err
+	}
+	both := commonTemplates(newGen, newFS, os.DirFS(revDir), *rev)
+	if len(both) == 0 {
+		return nil
+	}
+
+	oldGen.SetProfile(*profile)
+	newGen.SetProfile(*profile)
+	oldResults, err := renderForDiff(oldGen, both, valuesFiles, dataFiles, sets)
+	if err != nil {
+		return fmt.Errorf("failed to render templates at %s: %w", *rev, err)
+	}
+	newResults, err := renderForDiff(newGen, both, valuesFiles, dataFiles, sets)
+	if err != nil {
+		return fmt.Errorf("failed to render working tree templates: %w", err)
+	}
+
+	oldContent := make(map[string]string, len(oldResults))
+	for _, r := range oldResults {
+		oldContent[r.DestPath] = r.Content
+	}
+	changed := 0
+	for _, r := range newResults {
+		name := r.DestPath
+		if rel, err := filepath.Rel(newGen.Context().Home, r.DestPath); err == nil && !r.Crontab {
+			name = filepath.ToSlash(rel)
+		}
+		if d := r.Diff(name+" ("+*rev+")", name+" (working tree)", oldContent[r.DestPath]); d != "" {
+			fmt.Print(d)
+			changed++
+		}
+	}
+
+	if changed == 0 {
+		fmt.Printf("No differences in generated files between %s and the working tree\n", *rev)
+		return nil
+	}
+	fmt.Printf("\n%d generated files differ between %s and the working tree\n", changed, *rev)
+	return errDrift
+}
+
+// commonTemplates returns gen's mapped templates present in both the working
+// tree and the revision, with all of their fragments, which are the ones
+// that can be rendered twice, and lists the others as only on one side.
+func commonTemplates(gen *generator.Generator, newFS, oldFS fs.FS, rev string) []string {
+	var both []string
+	for _, m := range gen.SortedMappings() {
+		inNew, inOld := hasTemplates(newFS, m), hasTemplates(oldFS, m)
+		switch {
+		case inNew && inOld:
+			both = append(both, m.Template)
+		case inNew:
+			fmt.Printf("Only in working tree: %s\n", m.Template)
+		case inOld:
+			fmt.Printf("Only in %s: %s\n", rev, m.Template)
+		}
+	}
+	return both
+}
+
+// hasTemplates reports whether fsys has the template and every fragment of m.
+func hasTemplates(fsys fs.FS, m generator.Mapping) bool {
+	for _, t := range m.Templates() {
+		if _, err := fs.Stat(fsys, t); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// renderForDiff renders the mappings of the given templates with the same
+// values on each side, including those whose required tool is missing.
+func renderForDiff(gen *generator.Generator, templates, valuesFiles, dataFiles, sets []string) ([]generator.Result, error) {
+	gen.SetOutput(io.Discard)
+	gen.SetIgnoreRequires(true)
+	gen.SetOnly(templates)
+	if err := gen.LoadValues(valuesFiles, sets); err != nil {
+		return nil, err
+	}
+	if err := gen.LoadData(dataFiles); err != nil {
+		return nil, err
+	}
+	return gen.Generate()
+}
+
+// checkoutTemplates extracts the templates directory under root as of the
+// git revision rev into dest, using "git archive" so the working tree and
+// index are left alone.
+func checkoutTemplates(root, rev, dest string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("--template-rev requires git: %w", err)
+	}
+
+	out, err := gitOutput(root, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return fmt.Errorf("%s is not in a git repository: %w", root, err)
+	}
+	toplevel, prefix, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	// Archive the subtree holding templates/ so entries start at templates/
+	treeish := rev
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		treeish = rev + ":" + prefix
+	}
+	archive, err := gitOutput(toplevel, "archive", "--format=tar", treeish, "--", "templates")
+	if err != nil {
+		return fmt.Errorf("failed to read templates at %s: %w", rev, err)
+	}
+	return remote.ExtractTar(strings.NewReader(archive), dest)
+}
+
+// gitOutput runs git in dir and returns its standard output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
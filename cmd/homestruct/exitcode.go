@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/runlock"
+)
+
+// Exit codes of every command. Scripts rely on them, so existing values
+// must never change; new conditions get new codes.
+const (
+	ExitOK         = 0 // Success
+	ExitError      = 1 // Any failure without a more specific code
+	ExitDrift      = 2 // diff, plan-diff or status found differences
+	ExitValidation = 3 // Invalid arguments or flags, invalid mappings, or lint issues
+	ExitLocked     = 4 // Another run holds the run lock (retry with --wait)
+	ExitVerify     = 5 // generate --verify or backup verify found mismatches
+)
+
+// exitError is an error that exits with a specific code rather than
+// ExitError. Reported errors have already been described to the user, so
+// only the code is used.
+type exitError struct {
+	code     int
+	err      error
+	reported bool
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// errDrift is returned by diff, plan-diff and status after printing
+// differences.
+var errDrift = &exitError{code: ExitDrift, err: errors.New("differences found"), reported: true}
+
+// withExitCode returns err, or nil if err is nil, exiting with code.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// usageErrorf returns an error for invalid arguments or flags, which exits
+// with ExitValidation.
+func usageErrorf(format string, args ...any) error {
+	return withExitCode(ExitValidation, fmt.Errorf(format, args...))
+}
+
+// parseFlags parses args with fs, which must use flag.ContinueOnError and
+// prints its own messages: -h exits with ExitOK and invalid flags with
+// ExitValidation.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, flag.ErrHelp):
+		return &exitError{code: ExitOK, err: err, reported: true}
+	default:
+		return &exitError{code: ExitValidation, err: err, reported: true}
+	}
+}
+
+// exitCode returns the exit code for an error returned by a command.
+func exitCode(err error) int {
+	var exitErr *exitError
+	var held *runlock.HeldError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.As(err, &held):
+		return ExitLocked
+	case errors.Is(err, generator.ErrInvalidMapping):
+		return ExitValidation
+	default:
+		return ExitError
+	}
+}
+
+// exit reports err, unless already reported, and exits with its code.
+func exit(err error) {
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || !exitErr.reported {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// checkGuardMode validates a --guard value: "warn", "prompt", "abort", or
+// empty to overwrite edited files without comment.
+func checkGuardMode(mode string) error {
+	switch mode {
+	case "", "warn", "prompt", "abort":
+		return nil
+	default:
+		return usageErrorf("invalid --guard %q (expected warn, prompt or abort)", mode)
+	}
+}
+
+// guardEdits applies --guard to the results that would overwrite managed
+// files edited since the last run (see Generator.Edited). warn reports them
+// on stderr, abort fails before anything is written, and prompt asks about
+// each one on w and leaves the declined ones out of the returned results.
+// In dry-run mode prompt only warns.
+func guardEdits(mode string, gen *generator.Generator, results []generator.Result, man *manifest.Manifest, w io.Writer, dryRun, assumeYes bool) ([]generator.Result, error) {
+	if mode == "" {
+		return results, nil
+	}
+	edited, err := gen.Edited(results, man)
+	if err != nil || len(edited) == 0 {
+		return results, err
+	}
+
+	switch {
+	case mode == "abort":
+		errs := &generator.MultiError{Summary: fmt.Sprintf("%d managed files were edited since the last run (--guard abort); nothing was written", len(edited))}
+		for _, r := range edited {
+			errs.Append(fmt.Errorf("%s was edited outside homestruct", r.DestPath))
+		}
+		return nil, errs
+	case mode == "warn" || dryRun:
+		for _, r := range edited {
+			fmt.Fprintf(os.Stderr, "Warning: %s was edited since the last run and will be overwritten\n", r.DestPath)
+		}
+		return results, nil
+	}
+
+	declined := make(map[string]bool)
+	for _, r := range edited {
+		ok, err := promptYesNo(w, fmt.Sprintf("%s was edited since the last run. Overwrite it?", r.DestPath), assumeYes)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			declined[r.DestPath] = true
+			fmt.Fprintf(w, "Keeping %s\n", r.DestPath)
+		}
+	}
+	kept := results[:0:0]
+	for _, r := range results {
+		if !declined[r.DestPath] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// importDir is the directory, within the templates root, that imported
+// files are copied into.
+const importDir = "templates/imported"
+
+// importedFile is a dotfile found by import and the mapping created for it.
+type importedFile struct {
+	Source  string // Path of the file in the imported directory
+	Dest    string // Destination relative to home
+	Content []byte
+	Render  bool // Whether the copy is rendered as a template (gets the template extension)
+	Review  string
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	layout := fs.String("layout", "plain", "Layout of the dotfiles directory: plain (mirrors home), stow (one package per subdirectory) or chezmoi")
+	out := fs.String("out", ".", "Templates root to copy files into, under templates/imported (e.g. cmd/homestruct)")
+	mappingsPath := fs.String("mappings", "", "Write the generated mappings to this file instead of stdout")
+	dryRun := fs.Bool("dry-run", false, "Show what would be imported without copying anything")
+	force := fs.Bool("force", false, "Overwrite files already in the templates directory")
+	templateExt := fs.String("template-ext", generator.DefaultTemplateExt, "Suffix given to imported files that are rendered as templates")
+
+	// Allow the directory before the flags
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		args = append(args[1:], args[0])
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: homestruct import <dir> [--layout plain|stow|chezmoi] [--out <dir>]")
+	}
+
+	ext, err := generator.ParseTemplateExt(*templateExt)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := generator.NewContext()
+	if err != nil {
+		return fmt.Errorf("failed to create context: %w", err)
+	}
+
+	files, err := scanDotfiles(fs.Arg(0), *layout)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files found in %s", fs.Arg(0))
+	}
+
+	builtin := make(map[string]string)
+	for _, m := range generator.FileMappings {
+		builtin[filepath.ToSlash(filepath.Clean(m.Destination()))] = m.Template
+	}
+
+	// Plan every file first so an existing template aborts before anything is written
+	var planned []importedFile
+	var conflicts int
+	for _, f := range files {
+		prepareImport(&f, ctx.Home)
+		if tmpl, ok := builtin[f.Dest]; ok {
+			fmt.Printf("[CONFLICT] %s is already generated by %s (skipped)\n", f.Dest, tmpl)
+			conflicts++
+			continue
+		}
+		if _, err := os.Stat(f.target(*out, ext)); err == nil && !*force {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", f.target(*out, ext))
+		}
+		planned = append(planned, f)
+	}
+
+	var mappings []string
+	for _, f := range planned {
+		target := f.target(*out, ext)
+		fmt.Printf("[IMPORT] %s -> %s\n", f.Source, target)
+		if f.Review != "" {
+			fmt.Printf("  Review: %s\n", f.Review)
+		}
+		if !*dryRun {
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to create template directory: %w", err)
+			}
+			if err := os.WriteFile(target, f.Content, 0644); err != nil {
+				return fmt.Errorf("failed to write template %s: %w", target, err)
+			}
+		}
+
+		line := fmt.Sprintf("{Template: %q, Dest: %q", f.template(ext), f.Dest)
+		if !f.Render && strings.HasSuffix(f.Dest, ext) {
+			line += ", Render: Bool(false)"
+		}
+		mappings = append(mappings, line+"},")
+	}
+
+	fmt.Printf("\nImported %d files", len(mappings))
+	if conflicts > 0 {
+		fmt.Printf(", %d conflicts with built-in mappings", conflicts)
+	}
+	fmt.Println()
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	snippet := "// Imported from " + fs.Arg(0) + "\n" + strings.Join(mappings, "\n") + "\n"
+	if *mappingsPath == "" || *dryRun {
+		fmt.Println("\nAdd these mappings to FileMappings in pkg/generator/map.go:")
+		fmt.Println()
+		fmt.Print(snippet)
+		return nil
+	}
+	if err := os.WriteFile(*mappingsPath, []byte(snippet), 0644); err != nil {
+		return fmt.Errorf("failed to write mappings %s: %w", *mappingsPath, err)
+	}
+	fmt.Printf("Wrote mappings to: %s (add them to FileMappings in pkg/generator/map.go)\n", *mappingsPath)
+	return nil
+}
+
+// template returns the path of the imported copy within the templates FS,
+// with the template extension ext if it is rendered.
+func (f importedFile) template(ext string) string {
+	template := path.Join(importDir, f.Dest)
+	if f.Render {
+		template += ext
+	}
+	return template
+}
+
+// target returns where the imported copy is written under the templates root.
+func (f importedFile) target(root, ext string) string {
+	return filepath.Join(root, filepath.FromSlash(f.template(ext)))
+}
+
+// scanDotfiles walks dir and returns the files it would place in home,
+// sorted by destination, according to layout.
+func scanDotfiles(dir, layout string) ([]importedFile, error) {
+	var destFor func(rel string) (string, bool)
+	switch layout {
+	case "plain":
+		destFor = func(rel string) (string, bool) { return rel, true }
+	case "stow":
+		// Each top-level directory is a package whose contents mirror home
+		destFor = func(rel string) (string, bool) {
+			_, dest, ok := strings.Cut(rel, "/")
+			return dest, ok
+		}
+	case "chezmoi":
+		destFor = chezmoiDest
+	default:
+		return nil, fmt.Errorf("unknown layout %q (expected plain, stow or chezmoi)", layout)
+	}
+
+	var files []importedFile
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (name == ".git" || strings.HasPrefix(name, ".chezmoi")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || name == ".stow-local-ignore" || strings.HasPrefix(name, ".chezmoi") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		dest, ok := destFor(filepath.ToSlash(rel))
+		if !ok {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		files = append(files, importedFile{Source: p, Dest: dest, Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Dest < files[j].Dest })
+	for i := 1; i < len(files); i++ {
+		if files[i].Dest == files[i-1].Dest {
+			return nil, fmt.Errorf("%s and %s both map to %s", files[i-1].Source, files[i].Source, files[i].Dest)
+		}
+	}
+	return files, nil
+}
+
+// chezmoiAttributes are the source-state prefixes chezmoi adds to names,
+// which do not appear in the target path.
+var chezmoiAttributes = []string{"private_", "readonly_", "empty_", "executable_", "exact_", "create_", "encrypted_"}
+
+// chezmoiDest translates a chezmoi source path (e.g. "private_dot_ssh/config")
+// into its target path (".ssh/config"). Scripts, symlinks, modify scripts and
+// encrypted files are not imported. A ".tmpl" suffix is kept on the result so
+// the file is rendered.
+func chezmoiDest(rel string) (string, bool) {
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "run_") || strings.HasPrefix(part, "symlink_") ||
+			strings.HasPrefix(part, "modify_") || strings.HasPrefix(part, "encrypted_") {
+			return "", false
+		}
+		for stripped := true; stripped; {
+			stripped = false
+			for _, attr := range chezmoiAttributes {
+				if strings.HasPrefix(part, attr) {
+					part = strings.TrimPrefix(part, attr)
+					stripped = true
+				}
+			}
+		}
+		if strings.HasPrefix(part, "dot_") {
+			part = "." + strings.TrimPrefix(part, "dot_")
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// prepareImport decides whether an imported file becomes a template. Files
+// that are already Go templates (chezmoi's .tmpl) are rendered; text files
+// mentioning the home directory get it replaced with {{ .Home }}; everything
+// else, including files containing "{{", is copied verbatim.
+func prepareImport(f *importedFile, home string) {
+	if strings.HasSuffix(f.Dest, ".tmpl") {
+		f.Dest = strings.TrimSuffix(f.Dest, ".tmpl")
+		f.Render = true
+		if bytes.Contains(f.Content, []byte(".chezmoi")) {
+			f.Review = "uses chezmoi template variables; replace them with homestruct's (.OS, .Home, .Set, ...)"
+		}
+		return
+	}
+	if !utf8.Valid(f.Content) || bytes.Contains(f.Content, []byte("{{")) || home == "" {
+		return
+	}
+	if bytes.Contains(f.Content, []byte(home)) {
+		f.Content = bytes.ReplaceAll(f.Content, []byte(home), []byte("{{ .Home }}"))
+		f.Render = true
+		f.Review = "replaced " + home + " with {{ .Home }}"
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/nabkey/home-files/pkg/backup"
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "Rewrite affected files with trailing whitespace and final newlines fixed")
+	var sets stringList
+	fs.Var(&sets, "set", "Set a template value as key=value (repeatable)")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable)")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable)")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays of the defaults and values files")
+	source := addTemplateSourceFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	gen, err := source.newGenerator(false)
+	if err != nil {
+		return err
+	}
+
+	// Lint every template, including those for tools that are not installed
+	gen.SetIgnoreRequires(true)
+
+	gen.SetProfile(*profile)
+	if err := gen.LoadValues(valuesFiles, sets); err != nil {
+		return err
+	}
+	if err := gen.LoadData(dataFiles); err != nil {
+		return err
+	}
+	ctx := gen.Context()
+
+	results, err := gen.Generate()
+	if err != nil {
+		return fmt.Errorf("failed to generate files: %w", err)
+	}
+
+	var remaining int
+	var fixed []generator.Result
+	for _, r := range results {
+		// Only files already on disk are rewritten by --fix
+		canFix := *fix && r.Exists
+		fixable := false
+		for _, issue := range generator.Lint(r.Content) {
+			fmt.Printf("%s:%d: %s\n", r.DestPath, issue.Line, issue.Message)
+			if issue.Fixable {
+				fixable = true
+			}
+			if !canFix || !issue.Fixable {
+				remaining++
+			}
+		}
+		if canFix && fixable {
+			r.Content = generator.FixLint(r.Content)
+			fixed = append(fixed, r)
+		}
+	}
+
+	if len(fixed) > 0 {
+		fmt.Println()
+		backupMgr := backup.New(ctx.Home)
+		defer backupMgr.Close()
+
+		opts := generator.ApplyOptions{Backup: backupMgr}
+		actions, err := gen.Apply(fixed, opts)
+		if err != nil {
+			return err
+		}
+		if err := backupMgr.Close(); err != nil {
+			return err
+		}
+		gen.PrintSummary(actions, opts)
+	}
+
+	if remaining > 0 {
+		return withExitCode(ExitValidation, fmt.Errorf("%d lint issues found", remaining))
+	}
+	if len(fixed) == 0 {
+		fmt.Println("No lint issues found")
+	}
+	return nil
+}
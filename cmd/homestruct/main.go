@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"embed"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/nabkey/home-files/pkg/backup"
 	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/manifest"
+	"github.com/nabkey/home-files/pkg/owner"
+	"github.com/nabkey/home-files/pkg/runlock"
 )
 
 //go:embed all:templates
@@ -16,21 +25,48 @@ var templates embed.FS
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(ExitValidation)
 	}
 
+	var err error
 	switch os.Args[1] {
 	case "generate":
-		if err := runGenerate(os.Args[2:]); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runGenerate(os.Args[2:])
+	case "undo":
+		err = runUndo(os.Args[2:])
+	case "backup":
+		err = runBackup(os.Args[2:])
+	case "render":
+		err = runRender(os.Args[2:])
+	case "resolve":
+		err = runResolve(os.Args[2:])
+	case "cat":
+		err = runCat(os.Args[2:])
+	case "which":
+		err = runWhich(os.Args[2:])
+	case "status":
+		err = runStatus(os.Args[2:])
+	case "lint":
+		err = runLint(os.Args[2:])
+	case "test":
+		err = runTest(os.Args[2:])
+	case "plan-diff":
+		err = runPlanDiff(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
 	case "help", "-h", "--help":
 		printUsage()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
 		printUsage()
-		os.Exit(1)
+		os.Exit(ExitValidation)
+	}
+	if err != nil {
+		exit(err)
 	}
 }
 
@@ -42,105 +78,996 @@ Usage:
 
 Commands:
   generate    Generate configuration files
+  undo        Revert the changes made by the last generate run
+  backup      Manage backup snapshots (list, restore, verify, prune)
+  render      Render a single template to stdout
+  cat         Print the generated content of a destination file to stdout
+  which       Show which template generates a destination file
+  resolve     Print a template's destination path, or a destination's template
+  status      Show whether each managed file is in sync with what was last
+              written, modified, missing, orphaned or unmanaged
+  lint        Check rendered files for whitespace problems
+  test        Compare the templates rendered with fixed contexts against
+              golden files in testdata/
+  plan-diff   Compare two plans saved with --dry-run --report
+  import      Copy an existing dotfiles directory (plain, stow or chezmoi)
+              into templates and print mappings for it
+  serve       Serve freshly rendered files over HTTP for previewing
+  diff        Show how template changes since a git revision change the
+              generated files
   help        Show this help message
 
 Generate Options:
   --dry-run   Preview changes without writing files
   --verbose   Show detailed output
-  --force     Skip backup and force overwrite`)
+  --force     Skip backup and force overwrite
+  --guard <mode>
+              Check managed files for edits made since the last run before
+              overwriting them: warn (report and continue), prompt (ask for
+              each file, keeping declined ones) or abort (write nothing)
+  --fail-if-exists
+              Only create files: abort before writing anything if any
+              destination (or the crontab) already exists, listing them
+  --backup-archive
+              Store this run's backups in a single .tar.gz instead of a directory
+  --backup-subdir <template>
+              Group snapshots in a subdirectory rendered from the context,
+              e.g. "{{ .Hostname }}" for .homestruct-backup/<host>/<timestamp>
+  --backup-exclude <glob>
+              Write but never back up files whose path relative to home or
+              file name matches the glob (repeatable)
+  --incremental
+              Only back up files that differ from their copy in the previous
+              snapshot; restore walks the chain of base snapshots
+  --backup-inplace
+              Back up each overwritten file next to itself as <file>.bak
+              (or .bak.N if that exists) instead of into a snapshot
+  --no-backup-gitignore
+              Do not write a .gitignore containing "*" into the backup
+              directory (written when missing so homes kept under git never
+              commit snapshots)
+  --confirm   Summarize the run and ask for confirmation before writing
+  --yes       Assume "yes" to the confirmation prompt (required without a TTY)
+  --review    Open the planned diffs in $EDITOR; delete the APPLY line to abort
+  --set k=v   Set a template value, exposed as {{ .Set.k }} (repeatable,
+              dotted keys create nested values)
+  --values <file>
+              Load template values from a JSON object or, if named .yaml or
+              .yml, a YAML mapping (repeatable); they override
+              templates/defaults.json (or .yaml) and are overridden by --set
+  --data <file>
+              Load structured template data, exposed as {{ .Data.key }}, from a
+              JSON or YAML file (repeatable); merged over templates/data.json
+              (or .yaml). Also accepted by render, cat, lint, serve and diff
+  --profile <name>
+              Also load the <name> overlay of the defaults and each values
+              file (values.<name>.json, next to values.json); the OS overlay
+              (values.linux.json, values.darwin.json, ...) is always loaded
+  --include-dir <dir>
+              Base directory for the include template function (default: home)
+  --chown user[:group]
+              Assign written files and backups to another user (e.g. when run as root)
+  --print-context-env
+              Print the detected context (os, arch, home, user, group,
+              hostname, shell, XDG directories, container/WSL/VM) as
+              "export HOMESTRUCT_*=..." lines for eval in shell scripts,
+              then exit
+  --lock <path>
+              Write the resolved template context (os, arch, home, user,
+              group, hostname, --set values) to a JSON lockfile
+  --locked <path>
+              Render with the context from a lockfile instead of detecting it;
+              differences from this machine are reported as warnings
+  --home <dir>
+              Target home directory to generate into (default: current user's home)
+  --backup-root <dir>
+              Keep backups and the undo log under <dir>/.homestruct-backup
+              instead of the target home
+  --users <list>
+              As root, generate into the home of each comma-separated user
+              with their context and ownership (unknown users are skipped
+              with a warning); --backup-root gets a subdirectory per user
+  --report <path>
+              Write a JSON report of the run (context, per-file actions,
+              durations, backup dir, errors) to a file
+  --report-append
+              Append the report as a single JSON line instead of overwriting
+  --json      Print the JSON report to stdout; all human-readable output
+              (progress, diffs, summary, prompts) goes to stderr
+  --quiet     Suppress progress, diffs and the summary; warnings, errors and
+              prompts still go to stderr (combine with --json for scripts)
+  --to-tmp    Write the generated files into a new temporary directory that
+              mirrors home and print its path, for comparing with tools like
+              meld; home is not modified (implies --dry-run)
+  --tar <path>
+              Pack the generated files into a tarball laid out relative to
+              home, gzip-compressed for .tar.gz/.tgz, to extract on another
+              machine; home is not modified (implies --dry-run)
+  --watch     Regenerate into --out whenever a file under --template-dir
+              changes, until interrupted; home is not modified
+  --out <dir> Directory --watch writes into (default: a new temporary dir)
+  --pre-hook <command>
+              Run a shell command before rendering, e.g. to pull the latest
+              templates; the last --template-dir is in $HOMESTRUCT_TEMPLATE_DIR
+              and a failure aborts the run
+  --ignore-prehook-errors
+              Warn and continue when --pre-hook fails
+  --bundle <path>
+              Write all rendered files into one file with "### <dest> ###"
+              separators (combine with --dry-run to only write the bundle)
+  --no-cache  Render every file, even when its template, mapping, context
+              and values and the destination are unchanged since the last run
+  --show-cache
+              Show for each file whether it was skipped as unchanged, and why
+              or why not (input hash and recorded hash)
+  --explain   Show why each file would be created or updated (missing
+              destination, lines changed, why it was not skipped as
+              unchanged) or skipped (required tool not found, unchanged
+              since the last run, missing template); implies --dry-run
+  --prune     Back up and remove files generated by earlier runs whose
+              mapping no longer exists (asks for confirmation unless --yes;
+              lists them with --dry-run)
+  --wait      If another run holds the lock (~/.config/homestruct/.lock),
+              wait for it instead of failing
+  --continue-on-error
+              Skip files that cannot be backed up or written (e.g. permission
+              denied) and continue; the run still exits non-zero
+  --emit-script <path>
+              Write a shell script (mkdir, cp backups, heredoc writes) that
+              reproduces the planned writes (combine with --dry-run to only
+              write the script)
+  --no-systemd-reload
+              Do not run "systemctl --user daemon-reload" (and enable/restart
+              where the mapping asks for it) after writing files under
+              systemd/user
+  --verify    After writing, re-read each file and fail on any content mismatch
+  --only <glob>
+              Only generate mappings whose destination (relative to home) or
+              template matches the glob (repeatable)
+  --ignore-requires
+              Generate mappings even when the tool they configure is not installed
+  --normalize <list>
+              Normalize rendered content before writing; comma-separated
+              transforms: lf (LF line endings), trim (trailing whitespace),
+              newline (final newline), blanks (collapse 3+ blank lines),
+              all (lf,trim,newline), or crlf (CRLF line endings, for
+              Windows tools)
+  --collapse-blanks
+              Collapse runs of three or more blank lines left by template
+              control structures into one (same as --normalize blanks)
+  --mappings-template
+              Also generate the mappings rendered from templates/mappings.tmpl,
+              a template producing a JSON array of mappings (e.g. one per
+              host in a values file); they are validated like built-in ones
+  --header    Prepend a "managed by homestruct - do not edit" comment naming
+              the source template to every generated file
+  --header-file <file>, --footer-file <file>
+              Prepend or append this template text instead, commented in
+              each file's syntax; it can use the context plus .Template,
+              .Dest and .Date
+  --parallel N
+              Render up to N templates concurrently (default: number of
+              CPUs, at most 4); output order is the same for any N, and 1
+              renders fully serially for debugging
+  --max-file-size <size>
+              Fail on templates and skip existing destinations larger than
+              <size> (K, M or G suffix; default 10M, 0 for no limit)
+  --strict    Treat warnings as errors (unmatched --only patterns, symlink
+              destinations, templates referencing unset values, locked
+              context mismatches, oversized destinations, missing templates,
+              XDG directories outside home)
+  --template-dir <dir>
+              Read templates from a directory on disk (one containing
+              templates/, or templates/ itself), falling back to the built-in
+              ones; repeat to stack directories, later ones winning; also
+              accepted by render, lint, serve and diff
+  --template-url <url>
+              Render templates from a .tar.gz downloaded over HTTP (with a
+              top-level templates/ directory) instead of the built-in ones;
+              also accepted by render, lint and serve
+  --template-sha256 <hex>
+              Fail unless the downloaded tarball has this SHA-256
+  --template-ttl <duration>
+              Reuse the cached download for this long (default 24h, 0 to
+              always download)
+  --template-ext <ext>
+              Render files with this suffix as templates instead of .tmpl
+              (e.g. .gotmpl or .tpl); also accepted by render, lint and import
+  --fetch-ttl <duration>
+              Reuse documents cached by the fetch template function for this
+              long (default 24h, 0 to always download)
+  --offline   Never download: use cached copies for fetch, --template-url
+              and --remote-values whatever their age, failing if there are
+              none; also accepted by render, cat, lint, serve and diff
+  --remote-values <url>
+              Expose values from a key-value store as {{ .Remote.key }}:
+              consul://host:8500/prefix, etcd://host:2379/prefix, or an
+              http(s) URL returning a JSON object; also accepted by render
+  --remote-allow-missing
+              Render with empty .Remote values when the store is unreachable
+              and no earlier fetch is cached (default: fail)
+
+Render Usage:
+  render <template> [options] Render a template (path within the templates
+                              FS, e.g. templates/git/.gitconfig.tmpl) to
+                              stdout without writing anything
+    --var k=v                 Set a template value, exposed as {{ .Set.k }}
+                              (repeatable)
+    --values <file>           Load template values from a JSON or YAML
+                              file (repeatable)
+    --profile <name>          Load values overlays for a profile, as for
+                              generate
+    --os, --arch, --user, --group, --home, --hostname
+                              Override the detected context values
+
+Which Usage:
+  which [--verbose] <dest>    Print the template that generates <dest>
+                              (absolute, ~/-prefixed, or relative to home)
+
+Status Usage:
+  status [--json] [--home <dir>]
+                              List every mapped and previously written file
+                              as in-sync, modified (edited since the last
+                              run), missing, orphaned (no longer mapped) or
+                              unmanaged (never written by homestruct),
+                              without rendering; exits 2 unless all are in
+                              sync
+    --json                    Print a JSON array of {dest, template, status,
+                              hash, mtime}; hash and mtime are "" and null
+                              for missing files
+    --mappings-template       Include mappings from templates/mappings.tmpl
+                              (with --template-dir, --values, --set, --profile)
+
+Test Usage:
+  test [options] [case...]    Render every mapping for each case in
+                              testdata/<case>/ with the context from its
+                              context.json lockfile, as if home were empty,
+                              and diff the output against the files in
+                              <case>/golden/ (laid out relative to home);
+                              exits 3 if any case fails
+    --update                  Rewrite the golden files from the output
+    --testdata <dir>          Test cases directory (default: testdata next to
+                              the last --template-dir, else ./testdata)
+    --template-dir <dir>, --template-ext <ext>, --mappings-template
+                              Same as for generate
+
+Resolve Usage:
+  resolve [--home <dir>] <template-or-dest>
+                              Print the absolute destination of a template
+                              (e.g. templates/zsh/.zshrc.tmpl), or the template
+                              of a destination (like which)
+
+Plan-diff Usage:
+  plan-diff <old.json> <new.json>
+                              Show files added (+), removed (-) and changed
+                              (~) between two --report files, plus context
+                              differences; timestamps and durations are ignored
+
+Import Usage:
+  import <dir> [options]      Copy dotfiles into <out>/templates/imported and
+                              print FileMappings entries for them; files whose
+                              destination a built-in mapping already generates
+                              are reported as conflicts and skipped
+    --layout <layout>         plain (mirrors home, default), stow (one package
+                              per subdirectory) or chezmoi (dot_/private_ names)
+    --out <dir>               Templates root (default: .; e.g. cmd/homestruct)
+    --mappings <file>         Write the mappings to a file instead of stdout
+    --dry-run                 Show what would be imported
+    --force                   Overwrite existing imported templates
+    --template-ext <ext>      Suffix for imported templates (default .tmpl)
+
+Serve Usage:
+  serve [options]             Serve every file, rendered afresh on each
+                              request, at http://<addr>/<dest relative to
+                              home> with an index at /; nothing is written
+    --addr <host:port>        Listen address (default 127.0.0.1:8080)
+    --set k=v, --values <file>, --profile <name>, --template-dir <dir>,
+    --template-url <url>      Same as for generate
+
+Diff Usage:
+  diff --template-rev <rev> --template-dir <dir>
+                              Render the templates in <dir> (inside a git
+                              checkout) as on disk and as of <rev>, e.g. HEAD,
+                              and print a diff per generated file that changes;
+                              requires git
+    --set k=v, --values <file>, --profile <name>, --template-ext <ext>
+                              Same as for generate
+
+Lint Options:
+  --fix       Rewrite affected files already in home (with backup), trimming
+              trailing whitespace and adding missing final newlines; mixed
+              indentation is only reported
+  --set k=v   Set a template value (repeatable)
+  --values <file>
+              Load template values from a JSON or YAML file (repeatable)
+  --profile <name>
+              Load values overlays for a profile, as for generate
+
+Undo Options:
+  --dry-run   Show what would be reverted without changing anything
+  --force     Also revert files changed since the run (left alone by
+              default), discarding those changes
+  --home, --backup-root
+              Same as for generate; also accepted by backup list and restore
+              (which also take --backup-subdir)
+  --wait      Wait for a concurrent run to finish (also for backup restore)
+
+Backup Subcommands:
+  backup list                 List backup snapshots
+  backup restore [options]    Restore a snapshot into the home directory
+    --timestamp <ts>          Snapshot to restore (default: most recent)
+    --dry-run                 Show what would be restored
+    --path <path>             Only restore this file or directory, relative
+                              to home, or files matching a glob (repeatable)
+  backup verify [options]     Check a snapshot's files against its .sha256
+                              checksum manifest; exits 5 on problems
+    --timestamp <ts>          Snapshot to verify (default: most recent)
+  backup prune [options]      Remove old snapshots; the most recent one and
+                              bases of kept incremental snapshots always stay
+    --keep <n>                Keep the n most recent snapshots regardless of age
+    --older-than <age>        Only remove snapshots older than age (30d, 2w,
+                              12h); with --keep, removes old snapshots beyond
+                              the n most recent
+    --dry-run                 List the snapshots that would be removed
+
+Exit Codes:
+  0  Success
+  1  Any other error
+  2  diff, plan-diff or status found differences
+  3  Invalid command, flags or arguments, invalid mappings, lint issues
+     or failing test cases
+  4  Another run holds the run lock (retry with --wait)
+  5  generate --verify or backup verify found mismatches`)
 }
 
 func runGenerate(args []string) error {
-	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	return generate(args, nil)
+}
+
+// generate runs generate with args. A non-nil target generates into that
+// user's home with their context and ownership, for --users.
+func generate(args []string, target *user.User) (err error) {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
 	dryRun := fs.Bool("dry-run", false, "Preview changes without writing files")
 	verbose := fs.Bool("verbose", false, "Show detailed output")
 	force := fs.Bool("force", false, "Skip backup and force overwrite")
+	failIfExists := fs.Bool("fail-if-exists", false, "Abort without writing anything if any destination already exists")
+	guard := fs.String("guard", "", "What to do about managed files edited since the last run: warn, prompt or abort")
+	backupInPlace := fs.Bool("backup-inplace", false, "Back up each overwritten file next to itself as file.bak instead of into a snapshot")
+	backupArchive := fs.Bool("backup-archive", false, "Store backups in a single .tar.gz per run")
+	noBackupGitignore := fs.Bool("no-backup-gitignore", false, "Do not write a .gitignore ignoring everything into the backup directory")
+	var backupExclude stringList
+	fs.Var(&backupExclude, "backup-exclude", "Never back up files matching this glob (repeatable)")
+	incremental := fs.Bool("incremental", false, "Only back up files that changed since the previous snapshot")
+	confirm := fs.Bool("confirm", false, "Summarize the run and ask for confirmation before writing")
+	yes := fs.Bool("yes", false, "Assume yes to the confirmation prompt")
+	review := fs.Bool("review", false, "Review the planned diffs in $EDITOR before writing")
+	var sets stringList
+	fs.Var(&sets, "set", "Set a template value as key=value (repeatable)")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable)")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable)")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays of the defaults and values files")
+	includeDir := fs.String("include-dir", "", "Base directory for the include template function (default: home)")
+	chown := fs.String("chown", "", "Assign written files and backups to user[:group]")
+	home := fs.String("home", "", "Target home directory to generate into (default: current user's home)")
+	backupRoot := fs.String("backup-root", "", "Directory to keep backups and the undo log under (default: target home)")
+	subdirTemplate := fs.String("backup-subdir", "", "Template for a snapshot subdirectory under the backup directory (e.g. {{ .Hostname }})")
+	printEnv := fs.Bool("print-context-env", false, "Print the resolved context as shell export lines and exit without generating")
+	lockPath := fs.String("lock", "", "Write the resolved template context to this lockfile")
+	lockedPath := fs.String("locked", "", "Load the template context from this lockfile instead of detecting it")
+	reportPath := fs.String("report", "", "Write a JSON report of the run to this file")
+	reportAppend := fs.Bool("report-append", false, "Append the report as a JSON line instead of overwriting")
+	jsonOut := fs.Bool("json", false, "Print the JSON run report to stdout; human-readable output goes to stderr")
+	quiet := fs.Bool("quiet", false, "Suppress progress and summary output; warnings and errors still go to stderr")
+	scriptPath := fs.String("emit-script", "", "Write a shell script that reproduces the planned writes")
+	toTmp := fs.Bool("to-tmp", false, "Write the generated files into a new temporary directory mirroring home instead of home (implies --dry-run)")
+	bundlePath := fs.String("bundle", "", "Write all rendered files concatenated into a single file for review")
+	tarPath := fs.String("tar", "", "Pack the generated files into this tarball, laid out relative to home, instead of writing them (implies --dry-run)")
+	prune := fs.Bool("prune", false, "Back up and remove previously generated files that no mapping produces any more")
+	wait := fs.Bool("wait", false, "Wait for another run holding the lock instead of failing")
+	continueOnError := fs.Bool("continue-on-error", false, "Skip files that cannot be written and continue with the rest")
+	noSystemd := fs.Bool("no-systemd-reload", false, "Do not run systemctl --user daemon-reload (and enable/restart) after writing systemd user units")
+	verify := fs.Bool("verify", false, "Re-read written files and check they match the generated content")
+	strict := fs.Bool("strict", false, "Treat warnings as errors")
+	ignoreRequires := fs.Bool("ignore-requires", false, "Generate mappings even when their required binary is missing")
+	normalize := fs.String("normalize", "", "Formatting transforms for rendered content: lf, trim, newline, blanks, crlf or all (comma-separated)")
+	collapseBlanks := fs.Bool("collapse-blanks", false, "Collapse runs of three or more blank lines in rendered content into one (same as --normalize blanks)")
+	header := fs.Bool("header", false, "Prepend a \"managed by homestruct\" comment to every generated file")
+	headerFile := fs.String("header-file", "", "Prepend this template text, commented, to every generated file")
+	footerFile := fs.String("footer-file", "", "Append this template text, commented, to every generated file")
+	parallel := fs.Int("parallel", generator.DefaultParallel(), "Render up to N templates concurrently (1 for fully serial)")
+	maxFileSize := fs.String("max-file-size", "10M", "Largest template or existing destination to handle (e.g. 512K, 10M; 0 for no limit)")
+	source := addTemplateSourceFlags(fs)
+	remoteOpts := addRemoteValuesFlags(fs)
+	var only stringList
+	fs.Var(&only, "only", "Only generate mappings matching a glob on destination or template (repeatable)")
+	noCache := fs.Bool("no-cache", false, "Render every mapping even if its input and destination are unchanged since the last run")
+	showCache := fs.Bool("show-cache", false, "Show why each file was or was not regenerated")
+	explain := fs.Bool("explain", false, "Show why each file would be created, updated or skipped, without writing (implies --dry-run)")
+	mappingsTemplate := fs.Bool("mappings-template", false, "Add the mappings rendered from templates/mappings.tmpl to the built-in ones")
+	users := fs.String("users", "", "Generate into the homes of these users (comma-separated; requires root)")
+	watch := fs.Bool("watch", false, "Regenerate into --out whenever a file under --template-dir changes, until interrupted")
+	watchOut := fs.String("out", "", "Directory --watch writes generated files into (default: a new temporary directory)")
+	preHook := fs.String("pre-hook", "", "Shell command to run before rendering, e.g. to pull the latest templates")
+	ignorePreHookErrors := fs.Bool("ignore-prehook-errors", false, "Continue with a warning when --pre-hook fails")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *watch {
+		if len(*source.dirs) == 0 {
+			return usageErrorf("--watch requires --template-dir")
+		}
+		if *users != "" || *toTmp || *tarPath != "" || *confirm || *review || *prune || *jsonOut {
+			return usageErrorf("--watch cannot be combined with --users, --to-tmp, --tar, --confirm, --review, --prune or --json")
+		}
+	}
+	// The hook updates the shared template source, so it runs once even
+	// when generating for several users
+	if *preHook != "" && target == nil {
+		hookOut := io.Writer(os.Stdout)
+		if *jsonOut || *quiet {
+			hookOut = os.Stderr
+		}
+		if err := runPreHook(*preHook, *source.dirs, hookOut); err != nil {
+			if !*ignorePreHookErrors {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %v; continuing (--ignore-prehook-errors)\n", err)
+		}
+	}
+	if *users != "" && target == nil {
+		return generateUsers(fs, args, *users)
+	}
+	// The temp tree and tarball replace writing to home, so home is only read
+	if *toTmp || *tarPath != "" {
+		*dryRun = true
+	}
+	if *explain {
+		*dryRun = true
+	}
+	if err := checkGuardMode(*guard); err != nil {
+		return err
+	}
+	if *force && *failIfExists {
+		return usageErrorf("--force cannot be combined with --fail-if-exists")
+	}
+	if *backupInPlace && (*backupArchive || *incremental) {
+		return usageErrorf("--backup-inplace cannot be combined with --backup-archive or --incremental")
+	}
 
-	if err := fs.Parse(args); err != nil {
+	// stdout carries only machine output with --json; human-readable
+	// progress moves to stderr, and --quiet drops it entirely. Prompts
+	// always need to be seen, so they fall back to stderr.
+	var out, prompt io.Writer = os.Stdout, os.Stdout
+	if *jsonOut {
+		out, prompt = os.Stderr, os.Stderr
+	}
+	if *quiet {
+		out, prompt = io.Discard, os.Stderr
+	}
+
+	gen, err := source.newGenerator(*verbose)
+	if err != nil {
 		return err
 	}
 
-	gen, err := generator.New(templates, *verbose)
+	if *lockedPath != "" {
+		lockedCtx, err := generator.LoadContext(*lockedPath)
+		if err != nil {
+			return err
+		}
+		gen.SetContext(lockedCtx)
+	}
+	if target != nil {
+		gen.SetUser(target)
+	} else if *home != "" {
+		gen.SetHome(*home)
+	}
+	if *includeDir != "" {
+		gen.SetIncludeDir(*includeDir)
+	}
+	gen.SetOutput(out)
+	gen.SetOnly(only)
+	gen.SetIgnoreRequires(*ignoreRequires)
+	gen.SetParallel(*parallel)
+
+	maxSize, err := parseSize(*maxFileSize)
 	if err != nil {
-		return fmt.Errorf("failed to initialize generator: %w", err)
+		return fmt.Errorf("invalid --max-file-size: %w", err)
+	}
+	gen.SetMaxFileSize(maxSize)
+
+	normalizeOpts, err := generator.ParseNormalize(*normalize)
+	if err != nil {
+		return err
+	}
+	if *collapseBlanks {
+		normalizeOpts.Blanks = true
+	}
+	gen.SetNormalize(normalizeOpts)
+	if err := setStamps(gen, *header, *headerFile, *footerFile); err != nil {
+		return err
 	}
 
+	var fileOwner *owner.Owner
+	if *chown != "" {
+		fileOwner, err = owner.Parse(*chown)
+		if err != nil {
+			return err
+		}
+		gen.SetOwner(fileOwner)
+	} else if target != nil {
+		if fileOwner, err = owner.Parse(target.Uid); err != nil {
+			return err
+		}
+		gen.SetOwner(fileOwner)
+	}
+
+	gen.SetProfile(*profile)
+	if err := gen.LoadValues(valuesFiles, sets); err != nil {
+		return err
+	}
+	if err := gen.LoadData(dataFiles); err != nil {
+		return err
+	}
 	ctx := gen.Context()
-	fmt.Printf("homestruct - generating for %s/%s\n", ctx.OS, ctx.Arch)
-	fmt.Printf("Home directory: %s\n", ctx.Home)
-	fmt.Printf("User: %s\n\n", ctx.User)
+	if err := remoteOpts.load(ctx, *source.offline); err != nil {
+		return err
+	}
+	if *printEnv {
+		printContextEnv(os.Stdout, ctx)
+		return nil
+	}
+	if *mappingsTemplate {
+		if err := gen.LoadMappingsTemplate(); err != nil {
+			return err
+		}
+	}
+	if *watch {
+		w, err := newTemplateWatcher(gen, *source.dirs, *watchOut, out)
+		if err != nil {
+			return err
+		}
+		w.mappingsTemplate = *mappingsTemplate
+		return w.run()
+	}
+	switch {
+	case *backupRoot == "":
+		*backupRoot = ctx.Home
+	case target != nil:
+		*backupRoot = filepath.Join(*backupRoot, target.Username)
+	}
+
+	if !*dryRun {
+		lock, err := acquireRunLock(ctx.Home, *wait, fileOwner)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	man, err := manifest.Load(ctx.Home)
+	if err != nil {
+		return err
+	}
+	// The temp tree and tarball must hold every file, including unchanged
+	// ones, and --fail-if-exists must see the files a previous run created
+	if !*noCache && !*toTmp && *tarPath == "" && !*failIfExists {
+		gen.SetCache(man)
+	}
+
+	var report *runReport
+	if *reportPath != "" || *jsonOut {
+		report = newRunReport(ctx, *dryRun)
+		defer func() {
+			report.finish(err)
+			if *reportPath != "" {
+				if writeErr := report.write(*reportPath, *reportAppend); writeErr != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", writeErr)
+				}
+			}
+			if *jsonOut {
+				if printErr := report.print(os.Stdout); printErr != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", printErr)
+				}
+			}
+		}()
+	}
+
+	if target != nil {
+		fmt.Fprintf(out, "=== %s (%s) ===\n", target.Username, ctx.Home)
+	}
+	gen.PrintHeader()
 
 	results, err := gen.Generate()
 	if err != nil {
 		return fmt.Errorf("failed to generate files: %w", err)
 	}
 
-	if *dryRun {
-		fmt.Println("=== DRY RUN MODE ===")
-		fmt.Println()
+	if *showCache {
+		printCacheStatuses(out, gen.CacheStatuses())
 	}
 
-	var backupMgr *backup.Manager
-	if !*force && !*dryRun {
-		backupMgr = backup.New(ctx.Home)
+	if *failIfExists {
+		if err := checkNoneExist(results); err != nil {
+			return err
+		}
+	}
+	if results, err = guardEdits(*guard, gen, results, man, prompt, *dryRun, *yes); err != nil {
+		return err
 	}
 
-	var backedUp []string
-	for _, r := range results {
-		status := "CREATE"
-		if r.Exists {
-			status = "UPDATE"
+	if warnings := gen.Warnings(); len(warnings) > 0 {
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+		if *strict {
+			return fmt.Errorf("%d warnings treated as errors (--strict)", len(warnings))
 		}
+		fmt.Fprintln(os.Stderr)
+	}
 
-		fmt.Printf("[%s] %s\n", status, r.DestPath)
+	if *lockPath != "" {
+		if err := ctx.Save(*lockPath); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote context lockfile: %s\n\n", *lockPath)
+	}
 
-		if *verbose {
-			fmt.Printf("  Source: %s\n", r.TemplatePath)
-			if *dryRun {
-				fmt.Println("  --- Content Preview ---")
-				// Show first 500 chars of content
-				preview := r.Content
-				if len(preview) > 500 {
-					preview = preview[:500] + "\n  ... (truncated)"
+	if *bundlePath != "" {
+		if err := writeBundle(*bundlePath, results); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote bundle of %d files to: %s\n\n", len(results), *bundlePath)
+	}
+
+	if *toTmp {
+		dir, err := writeTempTree(results, ctx.Home)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote %d generated files to: %s\n", len(results), dir)
+		fmt.Fprintf(out, "Compare with: diff -ru %s %s\n\n", ctx.Home, dir)
+	}
+
+	if *tarPath != "" {
+		if err := writeTarball(*tarPath, results, ctx.Home, fileOwner); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote tarball of %d files to: %s\n", len(results), *tarPath)
+		fmt.Fprintf(out, "Extract with: tar xf %s -C ~\n\n", *tarPath)
+	}
+
+	// In dry-run the manager is only used to compute backup paths; nothing is written
+	var backupMgr *backup.Manager
+	if !*force {
+		backupMgr = backup.New(ctx.Home)
+		backupMgr.SetRoot(*backupRoot)
+		subdir, err := backupSubdir(*subdirTemplate, ctx)
+		if err != nil {
+			return err
+		}
+		if err := backupMgr.SetSubdir(subdir); err != nil {
+			return err
+		}
+		backupMgr.SetOwner(fileOwner)
+		backupMgr.SetArchive(*backupArchive)
+		backupMgr.SetIncremental(*incremental)
+		backupMgr.SetInPlace(*backupInPlace)
+		backupMgr.SetExclude(backupExclude)
+		backupMgr.SetGitignore(!*noBackupGitignore)
+		defer backupMgr.Close()
+	}
+
+	if *scriptPath != "" {
+		var scriptBackupPath func(string) string
+		if backupMgr != nil {
+			scriptBackupPath = func(dest string) string {
+				if dest == generator.CrontabDest {
+					p, _ := backupMgr.ContentPath(backup.CrontabName)
+					return strings.Replace(p, backup.ArchiveExt+string(filepath.Separator), string(filepath.Separator), 1)
 				}
-				fmt.Println(preview)
-				fmt.Println("  --- End Preview ---")
+				if backupMgr.InPlace() {
+					p, _ := backupMgr.BackupPath(dest)
+					return p
+				}
+				rel, err := filepath.Rel(ctx.Home, dest)
+				if err != nil {
+					return ""
+				}
+				return filepath.Join(strings.TrimSuffix(backupMgr.BackupDir(), backup.ArchiveExt), rel)
 			}
 		}
+		if err := writeScript(*scriptPath, results, ctx, scriptBackupPath); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote script for %d files to: %s\n\n", len(results), *scriptPath)
+	}
+
+	if *confirm && !*dryRun {
+		ok, err := confirmRun(prompt, results, backupMgr, *yes)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, "Aborted - no changes made")
+			return nil
+		}
+	}
 
-		if *dryRun {
-			continue
+	if *review && !*dryRun {
+		ok, err := reviewRun(results)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(out, "Aborted during review - no changes made")
+			return nil
 		}
+	}
+
+	opts := generator.ApplyOptions{DryRun: *dryRun, Backup: backupMgr, ContinueOnError: *continueOnError, Explain: *explain}
+	actions, applyErr := gen.Apply(results, opts)
 
-		// Backup existing file if not forcing
-		if backupMgr != nil && r.Exists {
-			backupPath, err := backupMgr.BackupFile(r.DestPath)
-			if err != nil {
-				return fmt.Errorf("failed to backup %s: %w", r.DestPath, err)
+	var pruned []prunedFile
+	if *prune && applyErr == nil {
+		pruned, applyErr = pruneOrphans(gen, out, prompt, ctx.Home, man, backupMgr, *dryRun, *yes)
+	}
+
+	// Record what this run changed, even if it stopped early, so
+	// `homestruct undo` can revert it and later runs know which files
+	// they manage
+	if !*dryRun {
+		undoLog := backup.NewUndoLog()
+		for _, a := range actions {
+			// The crontab is only backed up; undo and the manifest track files
+			if a.Result.Crontab {
+				continue
+			}
+			switch a.Status {
+			case generator.StatusUpdate:
+				undoLog.RecordUpdate(a.Result.DestPath, a.BackupPath, a.Result.Content)
+			case generator.StatusCreate:
+				undoLog.RecordCreate(a.Result.DestPath, a.Result.Content)
 			}
-			if backupPath != "" {
-				backedUp = append(backedUp, backupPath)
-				if *verbose {
-					fmt.Printf("  Backed up to: %s\n", backupPath)
+			if rel, err := filepath.Rel(ctx.Home, a.Result.DestPath); err == nil {
+				// An unchanged file has nothing to undo
+				if prev, ok := man.Files[filepath.ToSlash(rel)]; ok && a.Status != generator.StatusUnchanged {
+					undoLog.RecordManifestEntry(a.Result.DestPath, prev)
 				}
+				man.Record(rel, a.Result.TemplatePath, a.Result.Content, a.Result.InputHash)
 			}
 		}
+		for _, p := range pruned {
+			undoLog.RecordRemove(p.Path, p.BackupPath)
+			undoLog.RecordManifestEntry(p.Path, p.Entry)
+		}
+		if !undoLog.Empty() {
+			// The undo log alone creates the backup directory with --force
+			if !*noBackupGitignore {
+				if err := backup.WriteGitignore(*backupRoot, fileOwner); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}
+			if err := undoLog.Save(*backupRoot, fileOwner); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		if err := man.Save(ctx.Home, fileOwner); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if report != nil {
+		for _, a := range actions {
+			report.addFile(a)
+			if a.BackupPath != "" {
+				report.BackupDir = backupMgr.BackupDir()
+			}
+		}
+		for _, f := range gen.Failures() {
+			report.Errors = append(report.Errors, f.Err.Error())
+		}
+	}
+
+	if applyErr != nil {
+		return applyErr
+	}
 
-		// Write the file
-		if err := gen.WriteFile(r); err != nil {
+	if backupMgr != nil {
+		if err := backupMgr.Close(); err != nil {
 			return err
 		}
 	}
 
-	fmt.Println()
-	if *dryRun {
-		fmt.Printf("Would process %d files (dry run - no changes made)\n", len(results))
-	} else {
-		fmt.Printf("Successfully generated %d files\n", len(results))
-		if len(backedUp) > 0 {
-			fmt.Printf("Backed up %d existing files to: %s\n", len(backedUp), backupMgr.BackupDir())
+	gen.PrintSummary(actions, opts)
+
+	if !*dryRun && !*noSystemd {
+		if err := gen.ReloadSystemd(actions); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if *verify && !*dryRun {
+		if err := gen.Verify(actions); err != nil {
+			return withExitCode(ExitVerify, err)
+		}
+	}
+
+	if failures := gen.Failures(); len(failures) > 0 {
+		errs := &generator.MultiError{Summary: fmt.Sprintf("%d files could not be written (--continue-on-error)", len(failures))}
+		for _, f := range failures {
+			errs.Append(f.Err)
+		}
+		return errs
+	}
+	return nil
+}
+
+// checkNoneExist returns an error listing every result whose destination
+// already exists, for --fail-if-exists.
+func checkNoneExist(results []generator.Result) error {
+	errs := &generator.MultiError{}
+	for _, r := range results {
+		if r.Exists {
+			errs.Append(fmt.Errorf("%s already exists", r.DestPath))
 		}
 	}
+	errs.Summary = fmt.Sprintf("%d destinations already exist (--fail-if-exists); nothing was written", len(errs.Errors))
+	return errs.ErrorOrNil()
+}
 
+// stringList is a flag.Value collecting repeated string flags.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
 	return nil
 }
+
+// confirmRun prints a summary of the planned run to w and asks the user to
+// confirm it. Without a TTY on stdin the run only proceeds when assumeYes is set.
+func confirmRun(w io.Writer, results []generator.Result, backupMgr *backup.Manager, assumeYes bool) (bool, error) {
+	var creates, updates int
+	for _, r := range results {
+		if r.Exists {
+			updates++
+		} else {
+			creates++
+		}
+	}
+
+	fmt.Fprintf(w, "Plan: %d creates, %d updates\n", creates, updates)
+	switch {
+	case backupMgr == nil:
+		fmt.Fprintln(w, "Backups: disabled (--force)")
+	case updates == 0:
+		fmt.Fprintln(w, "Backups: none needed")
+	case backupMgr.InPlace():
+		fmt.Fprintln(w, "Backups: next to the originals (.bak)")
+	default:
+		fmt.Fprintf(w, "Backups: %s\n", backupMgr.BackupDir())
+	}
+
+	return promptYesNo(w, "Proceed?", assumeYes)
+}
+
+// promptYesNo writes question to w, reads the answer from the terminal and
+// reports whether the user answered yes. assumeYes answers without prompting.
+func promptYesNo(w io.Writer, question string, assumeYes bool) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("confirmation required but stdin is not a terminal (use --yes to proceed)")
+	}
+
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// isTerminal reports whether f is attached to a character device such as a TTY.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// resolveHomes returns the target home directory and the directory backups
+// are kept under, defaulting to the current user's home and the target home.
+func resolveHomes(home, backupRoot string) (string, string, error) {
+	if home == "" {
+		var err error
+		home, err = os.UserHomeDir()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to determine home directory: %w", err)
+		}
+	}
+	if backupRoot == "" {
+		backupRoot = home
+	}
+	return home, backupRoot, nil
+}
+
+// setStamps configures the header and footer from --header, --header-file
+// and --footer-file. A header file takes precedence over --header.
+func setStamps(gen *generator.Generator, header bool, headerFile, footerFile string) error {
+	headerText := ""
+	if header {
+		headerText = generator.DefaultHeader
+	}
+	if headerFile != "" {
+		data, err := os.ReadFile(headerFile)
+		if err != nil {
+			return fmt.Errorf("failed to read header file: %w", err)
+		}
+		headerText = string(data)
+	}
+	if err := gen.SetHeader(headerText); err != nil {
+		return err
+	}
+
+	if footerFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(footerFile)
+	if err != nil {
+		return fmt.Errorf("failed to read footer file: %w", err)
+	}
+	return gen.SetFooter(string(data))
+}
+
+// parseSize parses a byte count with an optional K, M or G (binary) suffix.
+func parseSize(s string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+	orig := s
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		if u, ok := units[s[n-1:]]; ok {
+			mult = u
+			s = s[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", orig)
+	}
+	return n * mult, nil
+}
+
+// acquireRunLock takes the run lock of homeDir so concurrent runs cannot
+// interleave writes and backups. Unless wait is set, it fails fast when
+// another run holds the lock.
+func acquireRunLock(homeDir string, wait bool, o *owner.Owner) (*runlock.Lock, error) {
+	path := runlock.Path(homeDir)
+	if !wait {
+		return runlock.TryAcquire(path, o)
+	}
+	return runlock.Acquire(path, o, func(held *runlock.HeldError) {
+		fmt.Fprintf(os.Stderr, "Waiting for homestruct run (PID %d) to release %s...\n", held.PID, held.Path)
+	})
+}
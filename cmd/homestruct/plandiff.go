@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+func runPlanDiff(args []string) error {
+	fs := flag.NewFlagSet("plan-diff", flag.ContinueOnError)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return usageErrorf("usage: homestruct plan-diff <old.json> <new.json>")
+	}
+
+	oldReport, err := loadReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newReport, err := loadReport(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	lines := diffReports(oldReport, newReport)
+	if len(lines) == 0 {
+		fmt.Println("No differences")
+		return nil
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return errDrift
+}
+
+// loadReport reads a report written by --report. For files written with
+// --report-append, which hold one report per line, the last one is used.
+func loadReport(path string) (*runReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var report *runReport
+	for dec.More() {
+		var r runReport
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+		}
+		report = &r
+	}
+	if report == nil {
+		return nil, fmt.Errorf("plan %s is empty", path)
+	}
+	return report, nil
+}
+
+// diffReports describes how newReport differs from oldReport: the context
+// the plan was made for and, per destination, added, removed and changed
+// files. Timestamps and durations are ignored. Lines are sorted so the
+// output is stable.
+func diffReports(oldReport, newReport *runReport) []string {
+	var lines []string
+
+	if oldReport.Context != nil && newReport.Context != nil {
+		o, n := oldReport.Context, newReport.Context
+		for _, f := range []struct {
+			name     string
+			old, new string
+		}{
+			{"os", o.OS, n.OS},
+			{"arch", o.Arch, n.Arch},
+			{"home", o.Home, n.Home},
+			{"user", o.User, n.User},
+			{"group", o.Group, n.Group},
+			{"hostname", o.Hostname, n.Hostname},
+		} {
+			if f.old != f.new {
+				lines = append(lines, fmt.Sprintf("~ context %s: %q -> %q", f.name, f.old, f.new))
+			}
+		}
+		if !reflect.DeepEqual(o.Set, n.Set) {
+			lines = append(lines, "~ context set values changed")
+		}
+	}
+
+	oldFiles := make(map[string]fileReport)
+	for _, f := range oldReport.Files {
+		oldFiles[f.Dest] = f
+	}
+	newFiles := make(map[string]fileReport)
+	for _, f := range newReport.Files {
+		newFiles[f.Dest] = f
+	}
+
+	var fileLines []string
+	for dest, o := range oldFiles {
+		n, ok := newFiles[dest]
+		if !ok {
+			fileLines = append(fileLines, fmt.Sprintf("- %s (%s)", dest, o.Template))
+			continue
+		}
+		if o.Template != n.Template {
+			fileLines = append(fileLines, fmt.Sprintf("~ %s: template %s -> %s", dest, o.Template, n.Template))
+		}
+		if o.Action != n.Action {
+			fileLines = append(fileLines, fmt.Sprintf("~ %s: action %s -> %s", dest, o.Action, n.Action))
+		}
+		if o.SHA256 != n.SHA256 {
+			fileLines = append(fileLines, fmt.Sprintf("~ %s: content changed", dest))
+		}
+	}
+	for dest, n := range newFiles {
+		if _, ok := oldFiles[dest]; !ok {
+			fileLines = append(fileLines, fmt.Sprintf("+ %s (%s)", dest, n.Template))
+		}
+	}
+	sort.SliceStable(fileLines, func(i, j int) bool {
+		return fileLines[i][2:] < fileLines[j][2:]
+	})
+
+	return append(lines, fileLines...)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// runPreHook runs command through the shell before generating, for
+// --pre-hook, typically to update the template source (e.g. "git -C ~/dotfiles
+// pull --ff-only"). Its output goes to out and its errors to stderr. The
+// last --template-dir, if any, is passed as $HOMESTRUCT_TEMPLATE_DIR.
+func runPreHook(command string, templateDirs []string, out io.Writer) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if len(templateDirs) > 0 {
+		cmd.Env = append(cmd.Env, "HOMESTRUCT_TEMPLATE_DIR="+templateDirs[len(templateDirs)-1])
+	}
+
+	fmt.Fprintf(out, "Running pre-hook: %s\n", command)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("pre-hook %q exited with status %d", command, exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run pre-hook %q: %w", command, err)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nabkey/home-files/pkg/backup"
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// prunedFile is an orphaned file removed by --prune.
+type prunedFile struct {
+	Path       string
+	BackupPath string
+	Entry      manifest.Entry // Its manifest entry before it was pruned
+}
+
+// pruneOrphans removes files recorded in the manifest that none of gen's
+// mappings generates any more, backing them up first unless backupMgr is nil. In
+// dry-run mode the orphans are only listed to out; otherwise confirmation is
+// asked on prompt unless assumeYes is set. Orphans that no longer exist are
+// dropped from the manifest.
+func pruneOrphans(gen *generator.Generator, out, prompt io.Writer, homeDir string, man *manifest.Manifest, backupMgr *backup.Manager, dryRun, assumeYes bool) ([]prunedFile, error) {
+	var orphans []string
+	for _, rel := range gen.Orphans(man.Paths()) {
+		if _, err := os.Lstat(filepath.Join(homeDir, rel)); errors.Is(err, os.ErrNotExist) {
+			man.Remove(rel)
+			continue
+		}
+		orphans = append(orphans, rel)
+	}
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+
+	fmt.Fprintln(out)
+	for _, rel := range orphans {
+		fmt.Fprintf(out, "[PRUNE] %s\n", filepath.Join(homeDir, rel))
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "Would prune %d orphaned files\n", len(orphans))
+		return nil, nil
+	}
+
+	ok, err := promptYesNo(prompt, fmt.Sprintf("Remove %d orphaned files?", len(orphans)), assumeYes)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fmt.Fprintln(out, "Kept orphaned files")
+		return nil, nil
+	}
+
+	var pruned []prunedFile
+	for _, rel := range orphans {
+		path := filepath.Join(homeDir, rel)
+		var backupPath string
+		if backupMgr != nil {
+			if backupPath, err = backupMgr.BackupFile(path); err != nil {
+				return pruned, fmt.Errorf("failed to backup %s: %w", path, err)
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return pruned, fmt.Errorf("failed to remove orphaned file %s: %w", path, err)
+		}
+		entry := man.Files[filepath.ToSlash(rel)]
+		man.Remove(rel)
+		pruned = append(pruned, prunedFile{Path: path, BackupPath: backupPath, Entry: entry})
+	}
+
+	fmt.Fprintf(out, "Pruned %d orphaned files\n", len(pruned))
+	return pruned, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/remote"
+)
+
+// remoteValues holds the flags selecting a key-value store for .Remote.
+type remoteValues struct {
+	url          *string
+	allowMissing *bool
+}
+
+// addRemoteValuesFlags registers --remote-values and --remote-allow-missing
+// on flags.
+func addRemoteValuesFlags(flags *flag.FlagSet) *remoteValues {
+	return &remoteValues{
+		url:          flags.String("remote-values", "", "Read .Remote template values from a key-value store (consul://, etcd:// or an http(s) JSON URL)"),
+		allowMissing: flags.Bool("remote-allow-missing", false, "Render with empty .Remote values when the store is unreachable and nothing is cached"),
+	}
+}
+
+// load fetches the remote values into ctx.Remote. When the store cannot be
+// reached, or offline is set, the values cached by the last successful
+// fetch are used with a warning; without a cache this fails unless
+// --remote-allow-missing is set.
+func (r *remoteValues) load(ctx *generator.Context, offline bool) error {
+	if *r.url == "" {
+		return nil
+	}
+
+	store := remote.ValueStore{URL: *r.url}
+	var values map[string]any
+	err := fmt.Errorf("not fetching remote values from %s with --offline", *r.url)
+	if !offline {
+		values, err = store.Fetch()
+	}
+	if err == nil {
+		ctx.Remote = values
+		return nil
+	}
+
+	cached, fetched, cacheErr := store.Cached()
+	switch {
+	case cacheErr == nil:
+		fmt.Fprintf(os.Stderr, "Warning: %v; using values cached at %s\n", err, fetched.Format("2006-01-02 15:04:05"))
+		ctx.Remote = cached
+	case *r.allowMissing:
+		fmt.Fprintf(os.Stderr, "Warning: %v; rendering without remote values\n", err)
+		ctx.Remote = map[string]any{}
+	default:
+		return fmt.Errorf("%w (use --remote-allow-missing to render without them)", err)
+	}
+	return nil
+}
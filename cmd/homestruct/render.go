@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	var vars stringList
+	fs.Var(&vars, "var", "Set a template value as key=value, exposed as .Set (repeatable)")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable)")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable)")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays of the defaults and values files")
+	osName := fs.String("os", "", "Override .OS")
+	arch := fs.String("arch", "", "Override .Arch")
+	home := fs.String("home", "", "Override .Home")
+	userName := fs.String("user", "", "Override .User")
+	hostname := fs.String("hostname", "", "Override .Hostname")
+	group := fs.String("group", "", "Override .Group")
+	source := addTemplateSourceFlags(fs)
+	remoteOpts := addRemoteValuesFlags(fs)
+
+	// Allow the template path before the flags
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		args = append(args[1:], args[0])
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: homestruct render <template> [--var k=v] [--os os] [--arch arch]")
+	}
+
+	gen, err := source.newGenerator(false)
+	if err != nil {
+		return err
+	}
+
+	ctx := gen.Context()
+	for _, o := range []struct {
+		value string
+		field *string
+	}{
+		{*osName, &ctx.OS},
+		{*arch, &ctx.Arch},
+		{*userName, &ctx.User},
+		{*hostname, &ctx.Hostname},
+		{*group, &ctx.Group},
+	} {
+		if o.value != "" {
+			*o.field = o.value
+		}
+	}
+	if *home != "" {
+		gen.SetHome(*home)
+	}
+	gen.SetProfile(*profile)
+	if err := gen.LoadValues(valuesFiles, vars); err != nil {
+		return err
+	}
+	if err := gen.LoadData(dataFiles); err != nil {
+		return err
+	}
+	if err := remoteOpts.load(ctx, *source.offline); err != nil {
+		return err
+	}
+
+	content, err := gen.Render(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, w := range gen.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	fmt.Print(content)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// runReport is the machine-readable record of a generate run written by --report.
+type runReport struct {
+	Timestamp  time.Time          `json:"timestamp"`
+	DurationMs float64            `json:"duration_ms"`
+	DryRun     bool               `json:"dry_run"`
+	Context    *generator.Context `json:"context"`
+	BackupDir  string             `json:"backup_dir,omitempty"`
+	Files      []fileReport       `json:"files"`
+	Errors     []string           `json:"errors,omitempty"`
+
+	start time.Time
+}
+
+// fileReport records the action taken for a single destination.
+type fileReport struct {
+	Template   string  `json:"template"`
+	Dest       string  `json:"dest"`
+	Action     string  `json:"action"`
+	SHA256     string  `json:"sha256"` // Hash of the content written (or planned)
+	BackupPath string  `json:"backup_path,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+func newRunReport(ctx *generator.Context, dryRun bool) *runReport {
+	now := time.Now()
+	return &runReport{
+		Timestamp: now,
+		DryRun:    dryRun,
+		Context:   ctx,
+		Files:     []fileReport{},
+		start:     now,
+	}
+}
+
+// addFile records the action taken for a result and how long it took.
+func (r *runReport) addFile(a generator.Action) {
+	r.Files = append(r.Files, fileReport{
+		Template:   a.Result.TemplatePath,
+		Dest:       a.Result.DestPath,
+		Action:     strings.ToLower(string(a.Status)),
+		SHA256:     manifest.Hash([]byte(a.Result.Content)),
+		BackupPath: a.BackupPath,
+		DurationMs: milliseconds(a.Duration),
+	})
+}
+
+// finish records the run's duration and outcome.
+func (r *runReport) finish(runErr error) {
+	r.DurationMs = milliseconds(time.Since(r.start))
+	if runErr != nil {
+		r.Errors = append(r.Errors, runErr.Error())
+	}
+}
+
+// write writes the report to path. In append mode the report is added as a
+// single JSON line, so the file accumulates one report per run; otherwise the
+// file is replaced.
+func (r *runReport) write(path string, appendMode bool) error {
+	var data []byte
+	var err error
+	flags := os.O_CREATE | os.O_WRONLY
+	if appendMode {
+		data, err = json.Marshal(r)
+		flags |= os.O_APPEND
+	} else {
+		data, err = json.MarshalIndent(r, "", "  ")
+		flags |= os.O_TRUNC
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open report %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
+
+// print writes the report to w as indented JSON for --json.
+func (r *runReport) print(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to print report: %w", err)
+	}
+	return nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
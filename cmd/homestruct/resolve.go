@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+func runResolve(args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+
+	// Allow the template or destination before the flags
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		args = append(args[1:], args[0])
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: homestruct resolve <template-or-dest>")
+	}
+
+	gen, err := generator.New(templates, false)
+	if err != nil {
+		return fmt.Errorf("failed to initialize generator: %w", err)
+	}
+	if *home != "" {
+		gen.SetHome(*home)
+	}
+
+	// A template path resolves to its destination
+	arg := fs.Arg(0)
+	m, err := gen.Resolve(arg)
+	if err == nil {
+		fmt.Println(gen.DestPath(m))
+		return nil
+	}
+	if !errors.Is(err, generator.ErrNoMapping) {
+		return err
+	}
+
+	// Otherwise treat it as a destination and print its template
+	m, err = gen.Which(arg)
+	if err != nil {
+		return fmt.Errorf("%s is neither a mapped template nor a generated destination: %w", arg, err)
+	}
+	for _, t := range m.Templates() {
+		fmt.Println(t)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// reviewSentinel must remain in the review file for the run to proceed.
+const reviewSentinel = "APPLY"
+
+// reviewRun writes the planned diffs to a temporary file and opens it in the
+// user's editor. The run proceeds only if the sentinel line is kept.
+func reviewRun(results []generator.Result) (bool, error) {
+	f, err := os.CreateTemp("", "homestruct-review-*.diff")
+	if err != nil {
+		return false, fmt.Errorf("failed to create review file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	var sb strings.Builder
+	sb.WriteString("# homestruct review\n")
+	sb.WriteString("# Review the planned changes below, then save and close the editor.\n")
+	sb.WriteString("# To abort, delete the " + reviewSentinel + " line below (or empty the file).\n")
+	sb.WriteString(reviewSentinel + "\n\n")
+
+	changed := 0
+	for _, r := range results {
+		var existing string
+		if r.Exists {
+			data, err := r.ReadExisting()
+			if err != nil {
+				f.Close()
+				return false, err
+			}
+			existing = string(data)
+		}
+
+		if d := r.Diff(r.DestPath, r.DestPath+" (generated)", existing); d != "" {
+			sb.WriteString(d)
+			sb.WriteString("\n")
+			changed++
+		}
+	}
+	if changed == 0 {
+		sb.WriteString("# No changes - all files are up to date\n")
+	}
+
+	if _, err := f.WriteString(sb.String()); err != nil {
+		f.Close()
+		return false, fmt.Errorf("failed to write review file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("failed to write review file: %w", err)
+	}
+
+	if err := openEditor(f.Name()); err != nil {
+		return false, err
+	}
+
+	return hasSentinel(f.Name())
+}
+
+// openEditor opens path in $VISUAL or $EDITOR (falling back to vi, or notepad
+// on Windows) and waits for it to exit.
+func openEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// Allow editors configured with arguments, e.g. EDITOR="code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("editor %q exited with status %d - aborting", editor, exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run editor %q: %w", editor, err)
+	}
+	return nil
+}
+
+// hasSentinel reports whether the reviewed file still contains the sentinel line.
+func hasSentinel(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read review file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == reviewSentinel {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// scriptDelimiter terminates the heredocs in an emitted script. A numeric
+// suffix is added if a file contains it as a line.
+const scriptDelimiter = "HOMESTRUCT_EOF"
+
+// writeScript writes a POSIX shell script that reproduces the planned writes:
+// creating parent directories, backing up existing files to the path
+// returned by backupPath (nil to skip backups), and writing each file's
+// content via a heredoc.
+func writeScript(path string, results []generator.Result, ctx *generator.Context, backupPath func(dest string) string) error {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&sb, "# Generated by homestruct on %s for %s/%s\n", time.Now().Format(time.RFC3339), ctx.OS, ctx.Arch)
+	sb.WriteString("# Reproduces the writes planned by `homestruct generate`.\n")
+	sb.WriteString("set -eu\n")
+	sb.WriteString("umask 022\n")
+
+	for _, r := range results {
+		sb.WriteString("\n")
+		fmt.Fprintf(&sb, "# %s (source: %s)\n", r.DestPath, r.TemplatePath)
+
+		if r.Crontab {
+			writeScriptCrontab(&sb, r, backupPath)
+			continue
+		}
+
+		dirMode := r.DirMode
+		if dirMode == 0 {
+			dirMode = 0755
+		}
+		fmt.Fprintf(&sb, "(umask %03o && mkdir -p %s)\n", ^dirMode&0777, shellQuote(filepath.Dir(r.DestPath)))
+
+		if backupPath != nil {
+			if dst := backupPath(r.DestPath); dst != "" {
+				fmt.Fprintf(&sb, "if [ -f %s ]; then\n", shellQuote(r.DestPath))
+				fmt.Fprintf(&sb, "  mkdir -p %s\n", shellQuote(filepath.Dir(dst)))
+				fmt.Fprintf(&sb, "  cp -p %s %s\n", shellQuote(r.DestPath), shellQuote(dst))
+				sb.WriteString("fi\n")
+			}
+		}
+
+		if r.Sensitive {
+			// Restrict the file before the credentials are written to it
+			fmt.Fprintf(&sb, ": > %s && chmod 600 %s\n", shellQuote(r.DestPath), shellQuote(r.DestPath))
+		}
+		writeScriptContent(&sb, r.DestPath, r.Content)
+	}
+
+	if err := os.WriteFile(path, []byte(sb.String()), 0755); err != nil {
+		return fmt.Errorf("failed to write script %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeScriptCrontab emits commands saving the installed crontab (if
+// backups are enabled) and installing the generated one.
+func writeScriptCrontab(sb *strings.Builder, r generator.Result, backupPath func(dest string) string) {
+	if backupPath != nil {
+		if dst := backupPath(r.DestPath); dst != "" {
+			fmt.Fprintf(sb, "mkdir -p %s\n", shellQuote(filepath.Dir(dst)))
+			fmt.Fprintf(sb, "crontab -l > %s 2>/dev/null || rm -f %s\n", shellQuote(dst), shellQuote(dst))
+		}
+	}
+	fmt.Fprintf(sb, "crontab - <<'%s'\n", scriptDelimiter)
+	sb.WriteString(r.Content)
+	if !strings.HasSuffix(r.Content, "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(scriptDelimiter + "\n")
+}
+
+// writeScriptContent emits the command writing content to dest. Content
+// ending in a newline uses a quoted heredoc so it is written verbatim;
+// anything else uses printf to avoid adding a trailing newline.
+func writeScriptContent(sb *strings.Builder, dest, content string) {
+	if content == "" || !strings.HasSuffix(content, "\n") {
+		fmt.Fprintf(sb, "printf '%%s' %s > %s\n", shellQuote(content), shellQuote(dest))
+		return
+	}
+
+	delim := scriptDelimiter
+	lines := strings.Split(content, "\n")
+	for n := 1; containsLine(lines, delim); n++ {
+		delim = fmt.Sprintf("%s_%d", scriptDelimiter, n)
+	}
+
+	fmt.Fprintf(sb, "cat > %s <<'%s'\n", shellQuote(dest), delim)
+	sb.WriteString(content)
+	sb.WriteString(delim + "\n")
+}
+
+func containsLine(lines []string, s string) bool {
+	for _, line := range lines {
+		if line == s {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// previewServer renders every mapping on each request and serves the
+// results at paths mirroring their destinations relative to home, with
+// sensitive content redacted. Nothing is written to disk.
+type previewServer struct {
+	source      *templateSource
+	sets        []string
+	valuesFiles []string
+	dataFiles   []string
+	profile     string
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	var sets stringList
+	fs.Var(&sets, "set", "Set a template value as key=value (repeatable)")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable)")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable)")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays of the defaults and values files")
+	source := addTemplateSourceFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	s := &previewServer{source: source, sets: sets, valuesFiles: valuesFiles, dataFiles: dataFiles, profile: *profile}
+	// Fail on a bad template source or values before listening
+	if _, _, err := s.render(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Serving rendered files on http://%s/ (Ctrl-C to stop)\n", *addr)
+	server := &http.Server{Addr: *addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
+
+// render generates every mapping, including those whose required tool is
+// not installed, and returns the results keyed by URL path.
+func (s *previewServer) render() (map[string]generator.Result, []string, error) {
+	gen, err := s.source.newGenerator(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	gen.SetOutput(io.Discard)
+	gen.SetIgnoreRequires(true)
+	gen.SetProfile(s.profile)
+	if err := gen.LoadValues(s.valuesFiles, s.sets); err != nil {
+		return nil, nil, err
+	}
+	if err := gen.LoadData(s.dataFiles); err != nil {
+		return nil, nil, err
+	}
+
+	results, err := gen.Generate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate files: %w", err)
+	}
+
+	files := make(map[string]generator.Result, len(results))
+	var paths []string
+	for _, r := range results {
+		urlPath := r.DestPath
+		if rel, err := filepath.Rel(gen.Context().Home, r.DestPath); err == nil && !r.Crontab {
+			urlPath = filepath.ToSlash(rel)
+		}
+		files[urlPath] = r
+		paths = append(paths, urlPath)
+	}
+	return files, paths, nil
+}
+
+// ServeHTTP re-renders the templates and serves the requested file, or an
+// index of every file at "/".
+func (s *previewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, paths, err := s.render()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	urlPath := strings.TrimPrefix(r.URL.Path, "/")
+	if urlPath == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintln(w, "<!DOCTYPE html><title>homestruct</title><ul>")
+		for _, p := range paths {
+			fmt.Fprintf(w, "<li><a href=\"/%s\">%s</a> (%s)</li>\n", html.EscapeString(p), html.EscapeString(p), html.EscapeString(files[p].TemplatePath))
+		}
+		fmt.Fprintln(w, "</ul>")
+		return
+	}
+
+	result, ok := files[urlPath]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// Always plain text, so rendered HTML or scripts are shown rather than run
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Homestruct-Template", result.TemplatePath)
+	io.WriteString(w, result.Preview())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/remote"
+)
+
+// templateSource holds the flags selecting where templates are read from.
+type templateSource struct {
+	dirs   *stringList
+	url    *string
+	sha256 *string
+	ttl    *time.Duration
+	ext    *string
+
+	offline  *bool
+	fetchTTL *time.Duration
+}
+
+// addTemplateSourceFlags registers --template-dir, --template-url,
+// --template-sha256, --template-ttl, --template-ext, --offline and
+// --fetch-ttl on flags.
+func addTemplateSourceFlags(flags *flag.FlagSet) *templateSource {
+	dirs := &stringList{}
+	flags.Var(dirs, "template-dir", "Read templates from this directory on disk (containing templates/) before the built-in ones (repeatable, later wins)")
+	return &templateSource{
+		dirs:   dirs,
+		url:    flags.String("template-url", "", "Render templates from a .tar.gz downloaded from this URL instead of the built-in ones"),
+		sha256: flags.String("template-sha256", "", "Expected SHA-256 of the --template-url tarball"),
+		ttl:    flags.Duration("template-ttl", remote.DefaultTTL, "Reuse a cached --template-url download for this long (0 to always download)"),
+		ext:    flags.String("template-ext", generator.DefaultTemplateExt, "Suffix of files rendered as templates (e.g. .gotmpl or .tpl)"),
+
+		offline:  flags.Bool("offline", false, "Never download: use cached copies for fetch, --template-url and --remote-values, whatever their age"),
+		fetchTTL: flags.Duration("fetch-ttl", remote.DefaultTTL, "Reuse a document cached by the fetch template function for this long (0 to always download)"),
+	}
+}
+
+// open returns the templates to render: the directories given with
+// --template-dir stacked over the embedded templates, so each template is
+// read from the last directory that has it, the downloaded tarball when
+// --template-url is set, or the embedded templates.
+func (t *templateSource) open() (fs.FS, error) {
+	switch {
+	case len(*t.dirs) > 0 && *t.url != "":
+		return nil, usageErrorf("--template-dir cannot be combined with --template-url")
+	case len(*t.dirs) > 0:
+		layers := []fs.FS{generator.Layer("built-in templates", templates)}
+		for _, dir := range *t.dirs {
+			layer, err := openTemplateDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, generator.Layer(dir, layer))
+		}
+		return generator.Overlay(layers...), nil
+	case *t.url != "":
+		return remote.Source{URL: *t.url, SHA256: *t.sha256, TTL: *t.ttl, Offline: *t.offline}.Open()
+	default:
+		return templates, nil
+	}
+}
+
+// openTemplateDir returns the templates under dir, which is either a
+// directory containing templates/ (like cmd/homestruct) or the templates
+// directory itself. Files are read on each access, so edits show up without
+// restarting.
+func openTemplateDir(dir string) (fs.FS, error) {
+	root, err := templateRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return os.DirFS(root), nil
+}
+
+// templateRoot returns the directory containing templates/ for a
+// --template-dir value (see openTemplateDir).
+func templateRoot(dir string) (string, error) {
+	if info, err := os.Stat(filepath.Join(dir, "templates")); err == nil && info.IsDir() {
+		return dir, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve template directory: %w", err)
+	}
+	if info, err := os.Stat(abs); err == nil && info.IsDir() && filepath.Base(abs) == "templates" {
+		return filepath.Dir(abs), nil
+	}
+	return "", fmt.Errorf("no templates directory in %s", dir)
+}
+
+// newGenerator returns a generator for the selected templates and template
+// extension, fetching documents for templates as set by --offline and
+// --fetch-ttl.
+func (t *templateSource) newGenerator(verbose bool) (*generator.Generator, error) {
+	templateFS, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	gen, err := generator.New(templateFS, verbose)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize generator: %w", err)
+	}
+	if err := gen.SetTemplateExt(*t.ext); err != nil {
+		return nil, err
+	}
+	gen.SetFetcher(remote.Fetcher{TTL: *t.fetchTTL, Offline: *t.offline})
+	return gen, nil
+}
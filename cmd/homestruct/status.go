@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// statusOrder is the order statuses are counted in the summary.
+var statusOrder = []generator.SyncStatus{
+	generator.SyncInSync,
+	generator.SyncModified,
+	generator.SyncMissing,
+	generator.SyncOrphaned,
+	generator.SyncUnmanaged,
+}
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "Print the statuses as a JSON array of {dest, template, status, hash, mtime}")
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	var sets stringList
+	fs.Var(&sets, "set", "Set a template value as key=value (repeatable), for --mappings-template")
+	var valuesFiles stringList
+	fs.Var(&valuesFiles, "values", "Load template values from a JSON or YAML file (repeatable), for --mappings-template")
+	var dataFiles stringList
+	fs.Var(&dataFiles, "data", "Load template data (.Data) from a JSON or YAML file (repeatable), for --mappings-template")
+	profile := fs.String("profile", "", "Also load values.<profile>.json overlays, for --mappings-template")
+	mappingsTemplate := fs.Bool("mappings-template", false, "Add the mappings rendered from templates/mappings.tmpl to the built-in ones")
+	source := addTemplateSourceFlags(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageErrorf("usage: homestruct status [--json] [--home <dir>]")
+	}
+
+	gen, err := source.newGenerator(false)
+	if err != nil {
+		return err
+	}
+	if *home != "" {
+		gen.SetHome(*home)
+	}
+	if *mappingsTemplate {
+		gen.SetProfile(*profile)
+		if err := gen.LoadValues(valuesFiles, sets); err != nil {
+			return err
+		}
+		if err := gen.LoadData(dataFiles); err != nil {
+			return err
+		}
+		if err := gen.LoadMappingsTemplate(); err != nil {
+			return err
+		}
+	}
+
+	man, err := manifest.Load(gen.Context().Home)
+	if err != nil {
+		return err
+	}
+	statuses, err := gen.Status(man)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		if statuses == nil {
+			statuses = []generator.FileStatus{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(statuses); err != nil {
+			return fmt.Errorf("failed to encode statuses: %w", err)
+		}
+	} else {
+		printStatuses(os.Stdout, statuses)
+	}
+
+	for _, s := range statuses {
+		if s.Status != generator.SyncInSync {
+			return errDrift
+		}
+	}
+	return nil
+}
+
+// printStatuses lists each destination with its status, then counts them.
+func printStatuses(w io.Writer, statuses []generator.FileStatus) {
+	counts := make(map[generator.SyncStatus]int)
+	for _, s := range statuses {
+		counts[s.Status]++
+		fmt.Fprintf(w, "%-12s %s\n", "["+strings.ToUpper(string(s.Status))+"]", s.Dest)
+	}
+
+	var parts []string
+	for _, status := range statusOrder {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if len(parts) == 0 {
+		fmt.Fprintln(w, "No managed files")
+		return
+	}
+	fmt.Fprintf(w, "\n%s\n", strings.Join(parts, ", "))
+}
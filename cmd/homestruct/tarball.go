@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/generator"
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// writeTarball packs every result into a tar archive at dest for --tar,
+// laid out relative to home so it can be extracted there on another machine.
+// Files get the mode generate would create them with and directories their
+// mapping's DirMode; entries are owned by o, or uid and gid 0 if nil. A
+// .gz or .tgz name is gzip-compressed. Nothing under home is touched.
+func writeTarball(dest string, results []generator.Result, home string, o *owner.Owner) (err error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create tarball: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("failed to write tarball: %w", cerr)
+		}
+	}()
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(dest, ".gz") || strings.HasSuffix(dest, ".tgz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	var uid, gid int
+	if o != nil {
+		uid, gid = o.UID, o.GID
+	}
+	now := time.Now()
+	dirs := make(map[string]bool)
+
+	for _, r := range results {
+		rel, err := treePath(r, home)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		// Parent directories come first so extraction creates them with the
+		// mapping's permissions
+		dirMode := r.DirMode.Perm()
+		if dirMode == 0 {
+			dirMode = 0755
+		}
+		var parents []string
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			parents = append(parents, dir)
+		}
+		for i := len(parents) - 1; i >= 0; i-- {
+			if dirs[parents[i]] {
+				continue
+			}
+			dirs[parents[i]] = true
+			hdr := &tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     parents[i] + "/",
+				Mode:     int64(dirMode),
+				Uid:      uid,
+				Gid:      gid,
+				ModTime:  now,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return fmt.Errorf("failed to write tarball: %w", err)
+			}
+		}
+
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     int64(r.FileMode()),
+			Size:     int64(len(r.Content)),
+			Uid:      uid,
+			Gid:      gid,
+			ModTime:  now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tarball: %w", err)
+		}
+		if _, err := io.WriteString(tw, r.Content); err != nil {
+			return fmt.Errorf("failed to write tarball: %w", err)
+		}
+	}
+
+	closeErr := tw.Close()
+	if gz != nil {
+		closeErr = errors.Join(closeErr, gz.Close())
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to write tarball: %w", closeErr)
+	}
+	return nil
+}
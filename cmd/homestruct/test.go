@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+const (
+	// testContextFile is the lockfile holding a test case's fixed context.
+	testContextFile = "context.json"
+	// testGoldenDir holds a test case's expected files, laid out relative to home.
+	testGoldenDir = "golden"
+)
+
+func runTest(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	update := flags.Bool("update", false, "Rewrite the golden files from the rendered output instead of comparing")
+	testdata := flags.String("testdata", "", "Directory of test cases (default: testdata next to the last --template-dir's templates/, else ./testdata)")
+	mappingsTemplate := flags.Bool("mappings-template", false, "Add the mappings rendered from templates/mappings.tmpl to the built-in ones")
+	source := addTemplateSourceFlags(flags)
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	dir := *testdata
+	if dir == "" {
+		dir = "testdata"
+		if len(*source.dirs) > 0 {
+			root, err := templateRoot((*source.dirs)[len(*source.dirs)-1])
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(root, "testdata")
+		}
+	}
+	cases, err := testCases(dir, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, name := range cases {
+		caseDir := filepath.Join(dir, name)
+		results, home, err := renderTestCase(source, caseDir, *mappingsTemplate)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		if *update {
+			if err := updateGoldens(name, caseDir, home, results); err != nil {
+				return err
+			}
+			continue
+		}
+		ok, err := compareGoldens(os.Stdout, name, caseDir, home, results)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return withExitCode(ExitValidation, fmt.Errorf("%d of %d test cases failed", failed, len(cases)))
+	}
+	return nil
+}
+
+// testCases returns the named test cases, or every directory in dir that
+// has a context.json when none are named.
+func testCases(dir string, names []string) ([]string, error) {
+	if len(names) > 0 {
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dir, name, testContextFile)); err != nil {
+				return nil, usageErrorf("no test case %s: %s/%s not found", name, filepath.Join(dir, name), testContextFile)
+			}
+		}
+		return names, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test cases: %w", err)
+	}
+	var cases []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, e.Name(), testContextFile)); err == nil {
+			cases = append(cases, e.Name())
+		}
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no test cases in %s (each is a directory with a %s lockfile)", dir, testContextFile)
+	}
+	return cases, nil
+}
+
+// renderTestCase renders every mapping with the case's context, as if home
+// were empty, so the output depends only on the templates and the context.
+// It also returns the context's home, which destinations are under.
+func renderTestCase(source *templateSource, caseDir string, mappingsTemplate bool) ([]generator.Result, string, error) {
+	gen, err := source.newGenerator(false)
+	if err != nil {
+		return nil, "", err
+	}
+	ctx, err := generator.LoadContext(filepath.Join(caseDir, testContextFile))
+	if err != nil {
+		return nil, "", err
+	}
+	gen.SetContext(ctx)
+	gen.SetOutput(io.Discard)
+	gen.SetIgnoreRequires(true)
+	gen.SetIgnoreExisting(true)
+
+	if err := gen.LoadValues(nil, nil); err != nil {
+		return nil, "", err
+	}
+	if err := gen.LoadData(nil); err != nil {
+		return nil, "", err
+	}
+	if mappingsTemplate {
+		if err := gen.LoadMappingsTemplate(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	results, err := gen.Generate()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate files: %w", err)
+	}
+	return results, ctx.Home, nil
+}
+
+// compareGoldens prints a diff for each rendered file that differs from its
+// golden file, and reports whether all of them match.
+func compareGoldens(w io.Writer, name, caseDir, home string, results []generator.Result) (bool, error) {
+	goldenDir := filepath.Join(caseDir, testGoldenDir)
+	goldens, err := goldenFiles(goldenDir)
+	if err != nil {
+		return false, err
+	}
+
+	var problems []string
+	for _, r := range results {
+		rel, err := treePath(r, home)
+		if err != nil {
+			return false, err
+		}
+		key := filepath.ToSlash(rel)
+		if !goldens[key] {
+			problems = append(problems, fmt.Sprintf("%s has no golden file", key))
+			continue
+		}
+		delete(goldens, key)
+
+		data, err := os.ReadFile(filepath.Join(goldenDir, rel))
+		if err != nil {
+			return false, fmt.Errorf("failed to read golden file: %w", err)
+		}
+		if d := r.Diff("golden/"+key, "rendered/"+key, string(data)); d != "" {
+			fmt.Fprint(w, d)
+			problems = append(problems, fmt.Sprintf("%s differs from its golden file", key))
+		}
+	}
+	for _, key := range sortedKeys(goldens) {
+		problems = append(problems, fmt.Sprintf("%s has a golden file but is not generated", key))
+	}
+
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "PASS %s (%d files)\n", name, len(results))
+		return true, nil
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "FAIL %s: %s\n", name, p)
+	}
+	return false, nil
+}
+
+// updateGoldens replaces the case's golden files with the rendered output,
+// removing golden files of destinations that are no longer generated.
+func updateGoldens(name, caseDir, home string, results []generator.Result) error {
+	goldenDir := filepath.Join(caseDir, testGoldenDir)
+	goldens, err := goldenFiles(goldenDir)
+	if err != nil {
+		return err
+	}
+
+	var changed int
+	for _, r := range results {
+		rel, err := treePath(r, home)
+		if err != nil {
+			return err
+		}
+		delete(goldens, filepath.ToSlash(rel))
+		if data, err := os.ReadFile(filepath.Join(goldenDir, rel)); err == nil && string(data) == r.Content {
+			continue
+		}
+		if err := writeTreeFile(goldenDir, rel, r.Content); err != nil {
+			return err
+		}
+		changed++
+	}
+	for key := range goldens {
+		if err := os.Remove(filepath.Join(goldenDir, filepath.FromSlash(key))); err != nil {
+			return fmt.Errorf("failed to remove golden file: %w", err)
+		}
+	}
+
+	fmt.Printf("Updated %s: %d of %d golden files written, %d removed\n", name, changed, len(results), len(goldens))
+	return nil
+}
+
+// goldenFiles returns the slash-separated paths of the files under dir.
+func goldenFiles(dir string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list golden files: %w", err)
+	}
+	return files, nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
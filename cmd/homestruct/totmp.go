@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nabkey/home-files/pkg/backup"
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// writeTempTree writes every result into a new temporary directory at its
+// path relative to home, for --to-tmp, and returns the directory. The
+// crontab is written as .crontab at the top. Nothing under home is touched.
+func writeTempTree(results []generator.Result, home string) (string, error) {
+	dir, err := os.MkdirTemp("", "homestruct-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	for _, r := range results {
+		rel, err := treePath(r, home)
+		if err != nil {
+			return dir, err
+		}
+		if err := writeTreeFile(dir, rel, r.Content); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+// treePath returns the path of a result within a tree mirroring home.
+func treePath(r generator.Result, home string) (string, error) {
+	if r.Crontab {
+		return backup.CrontabName, nil
+	}
+	rel, err := filepath.Rel(home, r.DestPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("destination %s is outside %s", r.DestPath, home)
+	}
+	return rel, nil
+}
+
+// writeTreeFile writes content to rel under dir, creating parent directories.
+func writeTreeFile(dir, rel, content string) error {
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nabkey/home-files/pkg/backup"
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+func runUndo(args []string) error {
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Show what would be reverted without changing anything")
+	force := fs.Bool("force", false, "Also revert files changed since the run, discarding those changes")
+
+	home := fs.String("home", "", "Target home directory (default: current user's home)")
+	backupRoot := fs.String("backup-root", "", "Directory backups are kept under (default: target home)")
+	wait := fs.Bool("wait", false, "Wait for another run holding the lock instead of failing")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	homeDir, root, err := resolveHomes(*home, *backupRoot)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		lock, err := acquireRunLock(homeDir, *wait, nil)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	undoLog, err := backup.LoadUndoLog(root)
+	if err != nil {
+		return err
+	}
+	if undoLog == nil || undoLog.Empty() {
+		fmt.Println("Nothing to undo")
+		return nil
+	}
+
+	fmt.Printf("Reverting run from %s\n", undoLog.Timestamp)
+	if *dryRun {
+		fmt.Println("=== DRY RUN MODE ===")
+	}
+	fmt.Println()
+
+	actions, err := undoLog.Revert(root, *dryRun, *force)
+	var reverted, modified int
+	for _, a := range actions {
+		switch {
+		case a.Modified:
+			modified++
+			fmt.Printf("[MODIFIED] %s (changed since the run, left alone; use --force to revert it anyway)\n", a.Path)
+		case a.Deleted:
+			reverted++
+			fmt.Printf("[DELETE] %s\n", a.Path)
+		case a.Skipped:
+			fmt.Printf("[SKIP] %s (overwritten without backup)\n", a.Path)
+		default:
+			reverted++
+			fmt.Printf("[RESTORE] %s\n", a.Path)
+			fmt.Printf("  From: %s\n", a.BackupPath)
+		}
+	}
+	if !*dryRun {
+		if manErr := revertManifest(homeDir, undoLog, actions); manErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", manErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if *dryRun {
+		fmt.Printf("Would revert %d files (dry run - no changes made)\n", reverted)
+	} else {
+		fmt.Printf("Reverted %d files\n", reverted)
+	}
+	if modified > 0 {
+		fmt.Printf("Left %d changed files alone (use --force to revert them too)\n", modified)
+	}
+	return nil
+}
+
+// revertManifest gives each reverted file the manifest entry it had before
+// the run, or removes it when it was not managed then, so status and --guard
+// agree with the reverted files.
+func revertManifest(homeDir string, undoLog *backup.UndoLog, actions []backup.UndoAction) error {
+	man, err := manifest.Load(homeDir)
+	if err != nil {
+		return err
+	}
+	for _, a := range actions {
+		if a.Modified || a.Skipped {
+			continue
+		}
+		rel, err := filepath.Rel(homeDir, a.Path)
+		if err != nil {
+			continue
+		}
+		if prev, ok := undoLog.Manifest[a.Path]; ok {
+			man.Files[filepath.ToSlash(rel)] = prev
+		} else {
+			man.Remove(rel)
+		}
+	}
+	return man.Save(homeDir, nil)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// perRunFlags write a single output per run, which would be overwritten by
+// each user, or pin the target home that --users sets per user.
+var perRunFlags = []string{"home", "lock", "locked", "bundle", "emit-script", "json"}
+
+// generateUsers runs generate once per user in names (comma-separated), each
+// with the user's home, context and ownership. Users that do not exist are
+// skipped with a warning; a failure for one user does not stop the others.
+func generateUsers(fs *flag.FlagSet, args []string, names string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("--users requires running as root")
+	}
+
+	var conflicts []string
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range perRunFlags {
+			if f.Name == name {
+				conflicts = append(conflicts, "--"+name)
+			}
+		}
+	})
+	if fs.Lookup("report").Value.String() != "" && fs.Lookup("report-append").Value.String() != "true" {
+		conflicts = append(conflicts, "--report (without --report-append)")
+	}
+	if len(conflicts) > 0 {
+		return usageErrorf("--users cannot be combined with %s", strings.Join(conflicts, ", "))
+	}
+
+	var targets []*user.User
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		u, err := user.Lookup(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping user %s: %v\n", name, err)
+			continue
+		}
+		if u.HomeDir == "" {
+			fmt.Fprintf(os.Stderr, "Warning: skipping user %s: no home directory\n", name)
+			continue
+		}
+		targets = append(targets, u)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("none of the users in --users %s exist", names)
+	}
+
+	errs := &generator.MultiError{}
+	for _, u := range targets {
+		if err := generate(args, u); err != nil {
+			errs.Append(fmt.Errorf("user %s: %w", u.Username, err))
+		}
+	}
+	errs.Summary = fmt.Sprintf("%d of %d users failed", len(errs.Errors), len(targets))
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+// The template tree is polled rather than watched with inotify and its
+// equivalents, which would need a dependency; a tree of templates is small
+// enough to stat a few times a second.
+const (
+	watchInterval = 250 * time.Millisecond // How often the template tree is scanned
+	watchDebounce = 500 * time.Millisecond // How long the tree must be unchanged before regenerating
+)
+
+// templateWatcher regenerates every mapping into a directory mirroring home
+// whenever a file in the template tree changes, for generate --watch. Home
+// itself is never written.
+type templateWatcher struct {
+	gen              *generator.Generator
+	roots            []string // Template trees polled for changes
+	dir              string   // Directory the generated files are written into
+	mappingsTemplate bool     // Reload templates/mappings.tmpl on each cycle
+	out              io.Writer
+
+	files map[string]string // Content written by the last successful cycle, by path under dir
+}
+
+// fileStamp is what a scan of the template tree compares to detect changes.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// newTemplateWatcher returns a watcher for the templates in templateDirs
+// (--template-dir values) writing into dir, or a new temporary directory if
+// dir is empty. dir must not be the generator's home.
+func newTemplateWatcher(gen *generator.Generator, templateDirs []string, dir string, out io.Writer) (*templateWatcher, error) {
+	var roots []string
+	for _, templateDir := range templateDirs {
+		root, err := templateRoot(templateDir)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, filepath.Join(root, "templates"))
+	}
+
+	var err error
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "homestruct-watch-*"); err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+	} else {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve output directory: %w", err)
+		}
+		if abs == filepath.Clean(gen.Context().Home) {
+			return nil, fmt.Errorf("--out must not be the home directory")
+		}
+		dir = abs
+	}
+
+	return &templateWatcher{
+		gen:   gen,
+		roots: roots,
+		dir:   dir,
+		out:   out,
+		files: map[string]string{},
+	}, nil
+}
+
+// run generates once, then again each time the template tree changes and
+// has been quiet for watchDebounce, until interrupted. Failed cycles are
+// reported and leave the previous output in place.
+func (w *templateWatcher) run() error {
+	last, err := w.scan()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(w.out, "Watching %s, writing to %s (Ctrl-C to stop)\n\n", strings.Join(w.roots, ", "), w.dir)
+	w.cycle(1, nil)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var pending []string
+	var changedAt time.Time
+	for n := 2; ; {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(w.out, "Stopped watching; generated files are in %s\n", w.dir)
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := w.scan()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		if changed := changedFiles(last, current); len(changed) > 0 {
+			for _, path := range changed {
+				if !slices.Contains(pending, path) {
+					pending = append(pending, path)
+				}
+			}
+			last, changedAt = current, time.Now()
+			continue
+		}
+		if len(pending) > 0 && time.Since(changedAt) >= watchDebounce {
+			sort.Strings(pending)
+			w.cycle(n, pending)
+			pending = nil
+			n++
+		}
+	}
+}
+
+// cycle regenerates every mapping, writes the files whose content changed
+// since the last cycle and removes those no longer generated.
+func (w *templateWatcher) cycle(n int, changed []string) {
+	start := time.Now()
+	fmt.Fprintf(w.out, "[%s] Cycle %d", start.Format(time.TimeOnly), n)
+	if len(changed) > 0 {
+		fmt.Fprintf(w.out, ": %s changed", strings.Join(changed, ", "))
+	}
+	fmt.Fprintln(w.out)
+
+	if w.mappingsTemplate {
+		if err := w.gen.LoadMappingsTemplate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			return
+		}
+	}
+	results, err := w.gen.Generate()
+	for _, warning := range w.gen.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to generate files: %v\n\n", err)
+		return
+	}
+
+	files := make(map[string]string, len(results))
+	written := 0
+	for _, r := range results {
+		rel, err := treePath(r, w.gen.Context().Home)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		files[rel] = r.Content
+
+		previous, existed := w.files[rel]
+		if existed && previous == r.Content {
+			continue
+		}
+		if err := writeTreeFile(w.dir, rel, r.Content); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			delete(files, rel)
+			continue
+		}
+		written++
+		if existed {
+			fmt.Fprintf(w.out, "[UPDATE] %s\n", rel)
+		} else {
+			fmt.Fprintf(w.out, "[CREATE] %s\n", rel)
+		}
+	}
+
+	var gone []string
+	for rel := range w.files {
+		if _, ok := files[rel]; !ok {
+			gone = append(gone, rel)
+		}
+	}
+	sort.Strings(gone)
+	removed := 0
+	for _, rel := range gone {
+		if err := os.Remove(filepath.Join(w.dir, rel)); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: failed to remove %s: %v\n", rel, err)
+			continue
+		}
+		removed++
+		fmt.Fprintf(w.out, "[REMOVE] %s\n", rel)
+	}
+	w.files = files
+
+	fmt.Fprintf(w.out, "Cycle %d: %d files generated, %d written, %d removed in %s\n\n",
+		n, len(results), written, removed, time.Since(start).Round(time.Millisecond))
+}
+
+// scan scans every template tree. With several trees, paths are prefixed
+// with their tree so the same template in two layers is told apart.
+func (w *templateWatcher) scan() (map[string]fileStamp, error) {
+	if len(w.roots) == 1 {
+		return scanTree(w.roots[0])
+	}
+	stamps := map[string]fileStamp{}
+	for _, root := range w.roots {
+		tree, err := scanTree(root)
+		if err != nil {
+			return nil, err
+		}
+		for rel, stamp := range tree {
+			stamps[filepath.ToSlash(filepath.Join(root, rel))] = stamp
+		}
+	}
+	return stamps, nil
+}
+
+// scanTree returns the size and modification time of every file under root,
+// by path relative to root.
+func scanTree(root string) (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear between listing and stat while being saved
+			if os.IsNotExist(err) && path != root {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		stamps[filepath.ToSlash(rel)] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan templates: %w", err)
+	}
+	return stamps, nil
+}
+
+// changedFiles returns the files added, removed or modified between two
+// scans, sorted.
+func changedFiles(before, after map[string]fileStamp) []string {
+	var changed []string
+	for path, stamp := range after {
+		if prev, ok := before[path]; !ok || prev.size != stamp.size || !prev.modTime.Equal(stamp.modTime) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/nabkey/home-files/pkg/generator"
+)
+
+func runWhich(args []string) error {
+	fs := flag.NewFlagSet("which", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "Show the full mapping")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageErrorf("usage: homestruct which <dest>")
+	}
+
+	gen, err := generator.New(templates, *verbose)
+	if err != nil {
+		return fmt.Errorf("failed to initialize generator: %w", err)
+	}
+
+	m, err := gen.Which(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, t := range m.Templates() {
+		fmt.Println(t)
+	}
+	if *verbose {
+		fmt.Printf("  Dest: %s\n", gen.DestPath(m))
+		if m.Mode != generator.ModeOverwrite {
+			fmt.Printf("  Mode: %s\n", m.Mode)
+		}
+	}
+	return nil
+}
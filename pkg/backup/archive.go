@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// ArchiveExt is the extension of snapshots stored as a single archive.
+const ArchiveExt = ".tar.gz"
+
+// archiveWriter lazily creates a snapshot archive and appends backed up files to it.
+type archiveWriter struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+// add appends srcPath to the archive under the entry named by backupPath.
+func (a *archiveWriter) add(backupPath, srcPath string, info os.FileInfo, o *owner.Owner) error {
+	if a.tw == nil {
+		if err := o.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+			return err
+		}
+		f, err := os.Create(a.path)
+		if err != nil {
+			return err
+		}
+		if err := o.Chown(a.path); err != nil {
+			f.Close()
+			return err
+		}
+		a.file = f
+		a.gz = gzip.NewWriter(f)
+		a.tw = tar.NewWriter(a.gz)
+	}
+
+	_, name := splitArchivePath(backupPath)
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(a.tw, src)
+	return err
+}
+
+// close flushes and closes the archive if it was created.
+func (a *archiveWriter) close() error {
+	if a.tw == nil {
+		return nil
+	}
+	err := errors.Join(a.tw.Close(), a.gz.Close(), a.file.Close())
+	a.tw, a.gz, a.file = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to finalize backup archive %s: %w", a.path, err)
+	}
+	return nil
+}
+
+// splitArchivePath splits a backup path of the form "<snapshot>.tar.gz/<rel>"
+// into the archive path and the slash-separated entry name. For paths outside
+// an archive it returns an empty archive path.
+func splitArchivePath(backupPath string) (archivePath, name string) {
+	marker := ArchiveExt + string(filepath.Separator)
+	i := strings.Index(backupPath, marker)
+	if i < 0 {
+		return "", ""
+	}
+	return backupPath[:i+len(ArchiveExt)], filepath.ToSlash(backupPath[i+len(marker):])
+}
+
+// openBackup opens a backed up file, whether it lives in a snapshot directory
+// or inside a snapshot archive, returning its content and permissions.
+func openBackup(backupPath string) (io.ReadCloser, os.FileMode, error) {
+	archivePath, name := splitArchivePath(backupPath)
+	if archivePath == "" {
+		f, err := os.Open(backupPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, info.Mode(), nil
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, 0, fmt.Errorf("%s not found in archive %s", name, archivePath)
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+		}
+		if hdr.Name == name {
+			return archiveEntry{Reader: tr, file: f}, hdr.FileInfo().Mode(), nil
+		}
+	}
+}
+
+// archiveEntry reads a single entry and closes the underlying archive file.
+type archiveEntry struct {
+	io.Reader
+	file *os.File
+}
+
+func (e archiveEntry) Close() error {
+	return e.file.Close()
+}
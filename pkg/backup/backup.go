@@ -1,33 +1,126 @@
 package backup
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/nabkey/home-files/pkg/owner"
 )
 
-// Manager handles file backups.
+// DirName is the directory under home where backup snapshots are stored.
+const DirName = ".homestruct-backup"
+
+// CrontabName is the name the user's crontab is saved under in a snapshot.
+const CrontabName = ".crontab"
+
+// timestampLayout names each snapshot after the time of its run.
+const timestampLayout = "20060102-150405"
+
+// Manager handles file backups. BackupFile, BackupContent and Close are
+// safe for concurrent use; the setters must be called before any of them.
 type Manager struct {
+	mu sync.Mutex // Serializes backups, which share the archive, manifests and .bak names
+
 	homeDir   string
+	root      string // Directory holding DirName, the home directory by default
+	subdir    string // Subdirectory of DirName that snapshots are grouped in
+	timestamp string
 	backupDir string
+	owner     *owner.Owner   // Owner assigned to backup copies, nil to leave as-is
+	archive   *archiveWriter // Set in archive mode, where backups go into a single .tar.gz
+	inPlace   bool           // Back up files next to themselves as file.bak instead of into a snapshot
+	gitignore bool           // Write a .gitignore into the backup directory (see SetGitignore)
+
+	exclude   []string                // Glob patterns of files never backed up
+	checksums map[string]string       // SHA-256 of each file backed up in this run, by home-relative path
+	metadata  map[string]FileMetadata // Mode, owner and times of each file backed up in this run
+
+	incremental bool              // Skip files unchanged since the base snapshot's chain
+	base        *Snapshot         // Most recent snapshot before this run, in incremental mode
+	chain       map[string]string // Latest backup path in the base chain by home-relative path
+	baseWritten bool              // Whether this run's base sidecar file has been written
 }
 
 // New creates a new backup Manager.
 func New(homeDir string) *Manager {
-	timestamp := time.Now().Format("20060102-150405")
-	backupDir := filepath.Join(homeDir, ".homestruct-backup", timestamp)
+	timestamp := time.Now().Format(timestampLayout)
+	backupDir := filepath.Join(homeDir, DirName, timestamp)
 
 	return &Manager{
 		homeDir:   homeDir,
+		root:      homeDir,
+		timestamp: timestamp,
 		backupDir: backupDir,
+		gitignore: true,
 	}
 }
 
-// BackupFile creates a backup of the given file if it exists.
+// SetRoot stores snapshots under root/.homestruct-backup instead of under the
+// home directory. Paths within a snapshot stay relative to home.
+// It must be called before SetArchive.
+func (m *Manager) SetRoot(root string) {
+	m.root = root
+	m.backupDir = filepath.Join(root, DirName, m.subdir, m.timestamp)
+}
+
+// SetSubdir groups snapshots in a subdirectory of the backup directory, e.g.
+// per hostname, keeping the timestamp as the leaf. The subdirectory must be a
+// relative path that stays within the backup directory.
+// It must be called before SetArchive.
+func (m *Manager) SetSubdir(subdir string) error {
+	dir, err := SnapshotsDir(m.root, subdir)
+	if err != nil {
+		return err
+	}
+	m.subdir = subdir
+	m.backupDir = filepath.Join(dir, m.timestamp)
+	return nil
+}
+
+// SnapshotsDir returns the directory holding the snapshots under root for the
+// given subdirectory, which may be empty. It rejects subdirectories that are
+// absolute or escape the backup directory.
+func SnapshotsDir(root, subdir string) (string, error) {
+	if subdir != "" && !filepath.IsLocal(subdir) {
+		return "", fmt.Errorf("backup subdirectory %q must be a relative path within %s", subdir, DirName)
+	}
+	return filepath.Join(root, DirName, subdir), nil
+}
+
+// Contains reports whether path is the backup directory (root/DirName) or
+// inside it. Files there must never be generated or backed up.
+func (m *Manager) Contains(path string) bool {
+	dir, err := filepath.Abs(filepath.Join(m.root, DirName))
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, abs)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// BackupFile creates a backup of the given file if it exists and is not
+// excluded (see SetExclude). Files inside the backup directory are refused.
 // Returns the backup path if a backup was created, empty string otherwise.
 func (m *Manager) BackupFile(filePath string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Contains(filePath) {
+		return "", fmt.Errorf("refusing to back up %s: it is inside the backup directory %s", filePath, filepath.Join(m.root, DirName))
+	}
+	if m.Excluded(filePath) {
+		return "", nil
+	}
+
 	// Check if file exists
 	info, err := os.Stat(filePath)
 	if os.IsNotExist(err) {
@@ -42,16 +135,49 @@ func (m *Manager) BackupFile(filePath string) (string, error) {
 		return "", nil
 	}
 
-	// Calculate relative path from home for backup structure
-	relPath, err := filepath.Rel(m.homeDir, filePath)
+	if m.inPlace {
+		return m.backupInPlace(filePath)
+	}
+
+	backupPath, err := m.BackupPath(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get relative path: %w", err)
+		return "", err
+	}
+	rel, _ := filepath.Rel(m.homeDir, filePath)
+
+	if err := m.writeGitignore(); err != nil {
+		return "", err
+	}
+
+	if m.incremental {
+		prev, err := m.chainBackup(filePath, rel)
+		if err != nil {
+			return "", fmt.Errorf("failed to compare with previous backup: %w", err)
+		}
+		if prev != "" {
+			return prev, nil
+		}
+		if err := m.writeBase(); err != nil {
+			return "", err
+		}
 	}
 
-	backupPath := filepath.Join(m.backupDir, relPath)
+	sum, err := hashFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file %s: %w", filePath, err)
+	}
+
+	if m.archive != nil {
+		if err := m.archive.add(backupPath, filePath, info, m.owner); err != nil {
+			return "", fmt.Errorf("failed to add file to backup archive: %w", err)
+		}
+		m.recordChecksum(rel, sum)
+		m.recordMetadata(rel, info)
+		return backupPath, nil
+	}
 
 	// Create backup directory structure
-	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+	if err := m.owner.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
 		return "", fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
@@ -60,14 +186,101 @@ func (m *Manager) BackupFile(filePath string) (string, error) {
 		return "", fmt.Errorf("failed to copy file to backup: %w", err)
 	}
 
+	if err := m.owner.Chown(backupPath); err != nil {
+		return "", err
+	}
+
+	m.recordChecksum(rel, sum)
+	m.recordMetadata(rel, info)
 	return backupPath, nil
 }
 
-// BackupDir returns the backup directory path.
+// SetOwner assigns backup copies and the directories created for them to o.
+func (m *Manager) SetOwner(o *owner.Owner) {
+	m.owner = o
+}
+
+// BackupPath returns the path filePath would be backed up to, without
+// touching the filesystem.
+func (m *Manager) BackupPath(filePath string) (string, error) {
+	if m.inPlace {
+		return inPlacePath(filePath)
+	}
+
+	// Calculate relative path from home for backup structure
+	relPath, err := filepath.Rel(m.homeDir, filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path: %w", err)
+	}
+
+	return filepath.Join(m.BackupDir(), relPath), nil
+}
+
+// SetArchive switches the manager to writing all backups of the run into a
+// single <timestamp>.tar.gz archive instead of a directory tree.
+// Close must be called to finalize the archive.
+func (m *Manager) SetArchive(enabled bool) {
+	m.archive = nil
+	if enabled {
+		m.archive = &archiveWriter{path: m.backupDir + ArchiveExt}
+	}
+}
+
+// Close finalizes the backup archive, if any, and writes the checksum and
+// metadata manifests of the snapshot. It is safe to call more than once.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.archive != nil {
+		if err := m.archive.close(); err != nil {
+			return err
+		}
+	}
+	if err := m.writeChecksums(); err != nil {
+		return err
+	}
+	return m.writeMetadata()
+}
+
+// BackupDir returns the backup directory path, or the archive path in archive
+// mode. It is empty in in-place mode, where backups sit next to the originals.
 func (m *Manager) BackupDir() string {
+	if m.inPlace {
+		return ""
+	}
+	if m.archive != nil {
+		return m.archive.path
+	}
 	return m.backupDir
 }
 
+// restoreFile copies a backed up file (from a snapshot directory or archive)
+// to dst, creating parent directories and preserving its permissions.
+func restoreFile(backupPath, dst string) error {
+	src, mode, err := openBackup(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if _, err := io.Copy(destFile, src); err != nil {
+		return err
+	}
+
+	return os.Chmod(dst, mode)
+}
+
 // copyFile copies a file from src to dst.
 func copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
@@ -94,3 +307,70 @@ func copyFile(src, dst string) error {
 
 	return os.Chmod(dst, sourceInfo.Mode())
 }
+
+// ContentPath returns where BackupContent would save content named name.
+func (m *Manager) ContentPath(name string) (string, error) {
+	if m.inPlace {
+		return inPlacePath(filepath.Join(m.homeDir, name))
+	}
+	return filepath.Join(m.BackupDir(), name), nil
+}
+
+// BackupContent saves content that does not live in a file under home, such
+// as the user's crontab, in the snapshot under name (e.g. CrontabName).
+// Returns the backup path.
+func (m *Manager) BackupContent(name string, content []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backupPath, err := m.ContentPath(name)
+	if err != nil {
+		return "", err
+	}
+	if !m.inPlace {
+		if err := m.writeGitignore(); err != nil {
+			return "", err
+		}
+	}
+
+	if m.archive != nil {
+		tmp, err := os.CreateTemp("", "homestruct-backup-")
+		if err != nil {
+			return "", fmt.Errorf("failed to stage backup of %s: %w", name, err)
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(content)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to stage backup of %s: %w", name, err)
+		}
+		info, err := os.Stat(tmp.Name())
+		if err != nil {
+			return "", fmt.Errorf("failed to stage backup of %s: %w", name, err)
+		}
+		if err := m.archive.add(backupPath, tmp.Name(), info, m.owner); err != nil {
+			return "", fmt.Errorf("failed to add %s to backup archive: %w", name, err)
+		}
+	} else {
+		if err := m.owner.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		if err := os.WriteFile(backupPath, content, 0600); err != nil {
+			return "", fmt.Errorf("failed to write backup of %s: %w", name, err)
+		}
+		if err := m.owner.Chown(backupPath); err != nil {
+			return "", err
+		}
+	}
+
+	if !m.inPlace {
+		sum, err := hashReader(bytes.NewReader(content))
+		if err != nil {
+			return "", err
+		}
+		m.recordChecksum(name, sum)
+	}
+	return backupPath, nil
+}
@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// writeHome creates n files under home, spread over a few directories, and
+// returns their contents by home-relative path.
+func writeHome(t *testing.T, home string, n int) map[string]string {
+	t.Helper()
+	files := make(map[string]string, n)
+	for i := range n {
+		rel := filepath.Join(fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%d.conf", i))
+		content := fmt.Sprintf("content of file %d\n", i)
+		path := filepath.Join(home, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[rel] = content
+	}
+	return files
+}
+
+func TestBackupFileConcurrent(t *testing.T) {
+	for _, archive := range []bool{false, true} {
+		t.Run(fmt.Sprintf("archive=%v", archive), func(t *testing.T) {
+			home := t.TempDir()
+			files := writeHome(t, home, 64)
+
+			m := New(home)
+			m.SetArchive(archive)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, len(files))
+			for rel := range files {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := m.BackupFile(filepath.Join(home, rel)); err != nil {
+						errs <- err
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Errorf("BackupFile: %v", err)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			s, err := FindSnapshot(filepath.Join(home, DirName), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Archive != archive {
+				t.Errorf("snapshot Archive = %v, want %v", s.Archive, archive)
+			}
+
+			got, err := s.Files()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]string, 0, len(files))
+			for rel := range files {
+				want = append(want, rel)
+			}
+			sort.Strings(got)
+			sort.Strings(want)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("snapshot files = %v, want %v", got, want)
+			}
+
+			for rel, content := range files {
+				src, _, err := openBackup(s.BackupPath(rel))
+				if err != nil {
+					t.Fatalf("open backup of %s: %v", rel, err)
+				}
+				data, err := io.ReadAll(src)
+				src.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Errorf("backup of %s = %q, want %q", rel, data, content)
+				}
+			}
+
+			sums, err := readChecksums(s.Path)
+			if err != nil {
+				t.Fatalf("read checksum manifest: %v", err)
+			}
+			if len(sums) != len(files) {
+				t.Errorf("checksum manifest has %d entries, want %d", len(sums), len(files))
+			}
+			for rel, content := range files {
+				sum := sha256.Sum256([]byte(content))
+				if got := sums[filepath.ToSlash(rel)]; got != hex.EncodeToString(sum[:]) {
+					t.Errorf("checksum of %s = %q, want %x", rel, got, sum)
+				}
+			}
+
+			problems, err := s.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) > 0 {
+				t.Errorf("Verify reported problems: %v", problems)
+			}
+		})
+	}
+}
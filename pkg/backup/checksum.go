@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumExt names the checksum manifest of a snapshot, stored next to it as
+// "<timestamp>.sha256" in sha256sum format with paths relative to home.
+const checksumExt = ".sha256"
+
+// recordChecksum remembers the hash of a file backed up in this run.
+func (m *Manager) recordChecksum(relPath, sum string) {
+	if m.checksums == nil {
+		m.checksums = map[string]string{}
+	}
+	m.checksums[filepath.ToSlash(relPath)] = sum
+}
+
+// writeChecksums writes the checksum manifest for the files backed up in
+// this run, if any. It is only written once.
+func (m *Manager) writeChecksums() error {
+	if len(m.checksums) == 0 {
+		return nil
+	}
+
+	rels := make([]string, 0, len(m.checksums))
+	for rel := range m.checksums {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var sb strings.Builder
+	for _, rel := range rels {
+		fmt.Fprintf(&sb, "%s  %s\n", m.checksums[rel], rel)
+	}
+
+	path := m.backupDir + checksumExt
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write backup checksums: %w", err)
+	}
+	m.checksums = nil
+	return m.owner.Chown(path)
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readChecksums parses the checksum manifest of the snapshot at path.
+func readChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(strings.TrimSuffix(path, ArchiveExt) + checksumExt)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		sum, rel, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("malformed checksum manifest line %d", line)
+		}
+		sums[rel] = sum
+	}
+	return sums, scanner.Err()
+}
+
+// Verify recomputes the hash of every file recorded in the snapshot's
+// checksum manifest and returns a description of each file that is missing,
+// corrupted, or not listed in the manifest. An error is returned if the
+// snapshot has no manifest or cannot be read.
+func (s Snapshot) Verify() ([]string, error) {
+	sums, err := readChecksums(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("snapshot %s has no checksum manifest", s.Timestamp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksums of snapshot %s: %w", s.Timestamp, err)
+	}
+
+	files, err := s.Files()
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	for _, rel := range files {
+		present[filepath.ToSlash(rel)] = true
+	}
+
+	rels := make([]string, 0, len(sums))
+	for rel := range sums {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var problems []string
+	for _, rel := range rels {
+		if !present[rel] {
+			problems = append(problems, fmt.Sprintf("%s: missing", rel))
+			continue
+		}
+		src, _, err := openBackup(s.BackupPath(filepath.FromSlash(rel)))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", rel, err))
+			continue
+		}
+		sum, err := hashReader(src)
+		src.Close()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", rel, err))
+			continue
+		}
+		if sum != sums[rel] {
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", rel))
+		}
+	}
+
+	for _, rel := range files {
+		if _, ok := sums[filepath.ToSlash(rel)]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: not in checksum manifest", rel))
+		}
+	}
+	return problems, nil
+}
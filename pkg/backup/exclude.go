@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SetExclude skips backing up files matching any of the glob patterns.
+// Patterns are matched against the path relative to home (a pattern naming a
+// directory matches everything beneath it) and against the file name, so
+// "*.cache" excludes such files anywhere.
+func (m *Manager) SetExclude(patterns []string) {
+	m.exclude = patterns
+}
+
+// Excluded reports whether filePath is excluded from backup.
+func (m *Manager) Excluded(filePath string) bool {
+	if len(m.exclude) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(m.homeDir, filePath)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range m.exclude {
+		pattern = filepath.Clean(strings.TrimPrefix(pattern, "~/"))
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+		if strings.HasPrefix(rel, pattern+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// gitignoreContent ignores everything in the backup directory, so a home
+// kept under git never commits snapshots or the undo log.
+const gitignoreContent = "# Written by homestruct: backups are never committed\n*\n"
+
+// WriteGitignore creates root/.homestruct-backup if needed and writes a
+// .gitignore ignoring its content there, unless one already exists. What it
+// creates is assigned to o.
+func WriteGitignore(root string, o *owner.Owner) error {
+	dir := filepath.Join(root, DirName)
+	path := filepath.Join(dir, ".gitignore")
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := o.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(gitignoreContent), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return o.Chown(path)
+}
+
+// SetGitignore controls whether the backup directory gets a .gitignore
+// (see WriteGitignore) when a backup is first written into it. Enabled by
+// default.
+func (m *Manager) SetGitignore(enabled bool) {
+	m.gitignore = enabled
+}
+
+// writeGitignore writes the backup directory's .gitignore if enabled.
+func (m *Manager) writeGitignore() error {
+	if !m.gitignore {
+		return nil
+	}
+	return WriteGitignore(m.root, m.owner)
+}
@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// baseExt names the sidecar file recording the base of an incremental
+// snapshot, stored next to the snapshot as "<timestamp>.base".
+const baseExt = ".base"
+
+// SetIncremental makes the manager store only files that differ from their
+// latest copy in the previous snapshot's chain. Unchanged files are not
+// copied again; BackupFile returns the path of the existing copy instead.
+func (m *Manager) SetIncremental(enabled bool) {
+	m.incremental = enabled
+	m.chain = nil
+	m.base = nil
+}
+
+// chainBackup returns the latest backup of filePath in the base snapshot's
+// chain if its content matches the current file.
+func (m *Manager) chainBackup(filePath, relPath string) (string, error) {
+	if m.chain == nil {
+		m.chain = map[string]string{}
+		snapshots, err := ListSnapshots(filepath.Dir(m.backupDir))
+		if err != nil {
+			return "", err
+		}
+		if len(snapshots) > 0 {
+			m.base = &snapshots[len(snapshots)-1]
+			if m.chain, err = m.base.chainFiles(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	prev, ok := m.chain[relPath]
+	if !ok {
+		return "", nil
+	}
+	same, err := sameContent(prev, filePath)
+	if err != nil || !same {
+		return "", err
+	}
+	return prev, nil
+}
+
+// writeBase records the base snapshot of this run's snapshot, once.
+func (m *Manager) writeBase() error {
+	if m.base == nil || m.baseWritten {
+		return nil
+	}
+	path := m.backupDir + baseExt
+	if err := m.owner.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(m.base.Timestamp+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record base snapshot: %w", err)
+	}
+	m.baseWritten = true
+	return m.owner.Chown(path)
+}
+
+// readBase returns the base timestamp of the snapshot at path, or "" for a
+// full snapshot.
+func readBase(path string) (string, error) {
+	data, err := os.ReadFile(strings.TrimSuffix(path, ArchiveExt) + baseExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read base of snapshot %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// chain returns the snapshot followed by its chain of bases, newest first.
+func (s Snapshot) chain() ([]Snapshot, error) {
+	chain := []Snapshot{s}
+	root := filepath.Dir(s.Path)
+
+	for cur := s; cur.Base != ""; {
+		if cur.Base >= cur.Timestamp {
+			return nil, fmt.Errorf("snapshot %s has invalid base %s", cur.Timestamp, cur.Base)
+		}
+		base, err := FindSnapshot(root, cur.Base)
+		if err != nil {
+			return nil, fmt.Errorf("base snapshot %s of %s is missing: %w", cur.Base, cur.Timestamp, err)
+		}
+		cur = *base
+		chain = append(chain, cur)
+	}
+	return chain, nil
+}
+
+// chainFiles maps each file in the snapshot and its chain of bases, relative
+// to home, to the path of its most recent backup.
+func (s Snapshot) chainFiles() (map[string]string, error) {
+	chain, err := s.chain()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, cur := range chain {
+		rels, err := cur.Files()
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range rels {
+			if _, ok := files[rel]; !ok {
+				files[rel] = cur.BackupPath(rel)
+			}
+		}
+	}
+	return files, nil
+}
+
+// chainMetadata maps each file in the snapshot and its chain of bases to its
+// most recently recorded metadata. Files backed up before metadata was
+// recorded have none.
+func (s Snapshot) chainMetadata() (map[string]FileMetadata, error) {
+	chain, err := s.chain()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := map[string]FileMetadata{}
+	for _, cur := range chain {
+		recorded, err := readMetadata(cur.Path)
+		if err != nil {
+			return nil, err
+		}
+		for rel, m := range recorded {
+			if _, ok := meta[rel]; !ok {
+				meta[rel] = m
+			}
+		}
+	}
+	return meta, nil
+}
+
+// sameContent reports whether the backup at backupPath matches the file at path.
+func sameContent(backupPath, path string) (bool, error) {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	src, _, err := openBackup(backupPath)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	previous, err := io.ReadAll(src)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, previous), nil
+}
@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// inPlaceExt is appended to a destination to name its in-place backup.
+const inPlaceExt = ".bak"
+
+// SetInPlace switches the manager to backing up each file next to itself as
+// file.bak (or file.bak.N when that exists) instead of into a snapshot.
+// In-place backups are not archived, checksummed or incremental.
+func (m *Manager) SetInPlace(enabled bool) {
+	m.inPlace = enabled
+}
+
+// InPlace reports whether backups are written next to the original files.
+func (m *Manager) InPlace() bool {
+	return m.inPlace
+}
+
+// inPlacePath returns the first of filePath.bak, filePath.bak.1, ... that
+// does not exist yet, so earlier backups are never clobbered.
+func inPlacePath(filePath string) (string, error) {
+	candidate := filePath + inPlaceExt
+	for n := 1; ; n++ {
+		_, err := os.Lstat(candidate)
+		if os.IsNotExist(err) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to check backup path %s: %w", candidate, err)
+		}
+		candidate = filePath + inPlaceExt + "." + strconv.Itoa(n)
+	}
+}
+
+// backupInPlace copies filePath to its next free .bak path.
+func (m *Manager) backupInPlace(filePath string) (string, error) {
+	backupPath, err := inPlacePath(filePath)
+	if err != nil {
+		return "", err
+	}
+	if err := copyFile(filePath, backupPath); err != nil {
+		return "", fmt.Errorf("failed to copy file to backup: %w", err)
+	}
+	if err := m.owner.Chown(backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
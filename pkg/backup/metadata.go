@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// metadataExt names the metadata manifest of a snapshot, stored next to it
+// as "<timestamp>.meta": a JSON object of the mode, owner and modification
+// time of each backed up file, by path relative to home.
+const metadataExt = ".meta"
+
+// FileMetadata is the metadata of a backed up file, reapplied on restore.
+type FileMetadata struct {
+	Mode    os.FileMode  `json:"mode"`
+	Owner   *owner.Owner `json:"owner,omitempty"` // Nil where the platform has no Unix ownership
+	ModTime time.Time    `json:"mtime"`
+}
+
+// recordMetadata remembers the metadata of a file backed up in this run.
+func (m *Manager) recordMetadata(relPath string, info os.FileInfo) {
+	if m.metadata == nil {
+		m.metadata = map[string]FileMetadata{}
+	}
+	m.metadata[filepath.ToSlash(relPath)] = FileMetadata{
+		Mode:    info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		Owner:   owner.Of(info),
+		ModTime: info.ModTime(),
+	}
+}
+
+// writeMetadata writes the metadata manifest for the files backed up in
+// this run, if any. It is only written once.
+func (m *Manager) writeMetadata() error {
+	if len(m.metadata) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup metadata: %w", err)
+	}
+
+	path := m.backupDir + metadataExt
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write backup metadata: %w", err)
+	}
+	m.metadata = nil
+	return m.owner.Chown(path)
+}
+
+// readMetadata reads the metadata manifest of the snapshot at path. Snapshots
+// written before metadata was recorded have none.
+func readMetadata(path string) (map[string]FileMetadata, error) {
+	data, err := os.ReadFile(strings.TrimSuffix(path, ArchiveExt) + metadataExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of snapshot %s: %w", path, err)
+	}
+	var meta map[string]FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata of snapshot %s: %w", path, err)
+	}
+	return meta, nil
+}
+
+// applyMetadata sets the mode, owner and modification time of a restored
+// file. Ownership that cannot be restored without privileges is returned as
+// a warning rather than an error, leaving the file owned by the caller.
+func applyMetadata(path string, meta FileMetadata) (string, error) {
+	var warning string
+	if meta.Owner != nil {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		if current := owner.Of(info); current == nil || *current != *meta.Owner {
+			if err := os.Lchown(path, meta.Owner.UID, meta.Owner.GID); err != nil {
+				if !errors.Is(err, os.ErrPermission) {
+					return "", err
+				}
+				warning = fmt.Sprintf("could not restore owner %d:%d of %s without privileges", meta.Owner.UID, meta.Owner.GID, path)
+			}
+		}
+	}
+
+	// Changing the owner can clear setuid bits, so the mode comes after it
+	if err := os.Chmod(path, meta.Mode); err != nil {
+		return "", err
+	}
+	if err := os.Chtimes(path, time.Time{}, meta.ModTime); err != nil {
+		return "", err
+	}
+	return warning, nil
+}
@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// PruneOptions selects the snapshots Prune removes. A snapshot is removed
+// only if it is outside the Keep most recent ones and older than OlderThan;
+// a zero field does not restrict. The most recent snapshot, which undo
+// restores from, and the bases of kept incremental snapshots are never
+// removed.
+type PruneOptions struct {
+	Keep      int           // Number of most recent snapshots to keep regardless of age
+	OlderThan time.Duration // Minimum age, from the snapshot's timestamp, of removed snapshots
+	Now       time.Time     // Reference time for OlderThan; zero uses the current time
+}
+
+// Prune removes the snapshots in dir (see SnapshotsDir) selected by opts,
+// along with their checksum manifests and base files, and returns them
+// oldest first. With dryRun set, nothing is removed.
+func Prune(dir string, opts PruneOptions, dryRun bool) ([]Snapshot, error) {
+	if opts.Keep < 0 || opts.OlderThan < 0 {
+		return nil, fmt.Errorf("invalid prune options: keep and age must not be negative")
+	}
+	if opts.Keep == 0 && opts.OlderThan == 0 {
+		return nil, fmt.Errorf("invalid prune options: set a number of snapshots to keep or a minimum age")
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool)
+	byTimestamp := make(map[string]Snapshot)
+	for i, s := range snapshots {
+		byTimestamp[s.Timestamp] = s
+		recent := i >= len(snapshots)-max(opts.Keep, 1)
+		if recent || !olderThan(s, now, opts.OlderThan) {
+			keep[s.Timestamp] = true
+		}
+	}
+	// Incremental snapshots need their whole chain of bases to restore
+	for ts := range keep {
+		for base := byTimestamp[ts].Base; base != "" && !keep[base]; base = byTimestamp[base].Base {
+			keep[base] = true
+		}
+	}
+
+	var pruned []Snapshot
+	for _, s := range snapshots {
+		if keep[s.Timestamp] {
+			continue
+		}
+		if !dryRun {
+			if err := s.remove(); err != nil {
+				return pruned, err
+			}
+		}
+		pruned = append(pruned, s)
+	}
+	return pruned, nil
+}
+
+// olderThan reports whether the snapshot was taken more than age before now.
+// Any age matches when age is zero.
+func olderThan(s Snapshot, now time.Time, age time.Duration) bool {
+	if age == 0 {
+		return true
+	}
+	taken, err := time.ParseInLocation(timestampLayout, s.Timestamp, time.Local)
+	if err != nil {
+		return false
+	}
+	return now.Sub(taken) > age
+}
+
+// remove deletes the snapshot and the files stored next to it.
+func (s Snapshot) remove() error {
+	if err := os.RemoveAll(s.Path); err != nil {
+		return fmt.Errorf("failed to remove snapshot %s: %w", s.Timestamp, err)
+	}
+	base := strings.TrimSuffix(s.Path, ArchiveExt)
+	for _, sidecar := range []string{base + checksumExt, base + baseExt, base + metadataExt} {
+		if err := os.Remove(sidecar); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", sidecar, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RestoreOptions selects what Manager.Restore restores.
+type RestoreOptions struct {
+	Timestamp string       // Snapshot to restore; empty for the most recent
+	Paths     []string     // Files or directories to restore, relative to home or absolute within it, or filepath.Match globs; empty for all
+	DryRun    bool         // Report what would be restored without writing
+	Warn      func(string) // Called with problems that do not stop the restore; nil ignores them
+}
+
+// Restore copies files from a snapshot of this manager's backup directory
+// (see SetRoot and SetSubdir) back into home and returns their destination
+// paths. Incremental snapshots are restored with their chain of bases, and
+// recorded metadata is reapplied; owners that cannot be restored without
+// privileges are passed to opts.Warn, if set. A path in opts.Paths that
+// matches no file in the snapshot is an error, reported before anything is
+// written. If restoring a file fails, the paths restored so far are
+// returned with the error. A backed up crontab is not restored: restoring
+// everything reports how to reinstall it through opts.Warn.
+func (m *Manager) Restore(opts RestoreOptions) ([]string, error) {
+	dir, err := SnapshotsDir(m.root, m.subdir)
+	if err != nil {
+		return nil, err
+	}
+	s, err := FindSnapshot(dir, opts.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return s.restore(m.homeDir, opts)
+}
+
+// restore implements Restore and Manager.Restore for the snapshot.
+func (s Snapshot) restore(homeDir string, opts RestoreOptions) ([]string, error) {
+	files, err := s.chainFiles()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.chainMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	// The crontab is saved in the snapshot but does not live under home
+	if path, ok := files[CrontabName]; ok {
+		delete(files, CrontabName)
+		if len(opts.Paths) == 0 && opts.Warn != nil {
+			opts.Warn(crontabWarning(s, path))
+		}
+	}
+
+	rels, err := selectFiles(files, homeDir, opts.Paths)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", s.Timestamp, err)
+	}
+
+	var restored []string
+	for _, rel := range rels {
+		dest := filepath.Join(homeDir, rel)
+		if !opts.DryRun {
+			if err := restoreFile(files[rel], dest); err != nil {
+				return restored, fmt.Errorf("failed to restore %s: %w", dest, err)
+			}
+			if m, ok := meta[filepath.ToSlash(rel)]; ok {
+				warning, err := applyMetadata(dest, m)
+				if err != nil {
+					return restored, fmt.Errorf("failed to restore metadata of %s: %w", dest, err)
+				}
+				if warning != "" && opts.Warn != nil {
+					opts.Warn(warning)
+				}
+			}
+		}
+		restored = append(restored, dest)
+	}
+	return restored, nil
+}
+
+// crontabWarning tells how to reinstall the crontab backed up at path in the
+// snapshot (or its chain), which Restore leaves alone.
+func crontabWarning(s Snapshot, path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Sprintf("the crontab backed up in snapshot %s is not restored; reinstall it with: crontab %s", s.Timestamp, path)
+	}
+	return fmt.Sprintf("the crontab backed up in snapshot %s is not restored; extract %s from the snapshot archive and reinstall it with crontab", s.Timestamp, CrontabName)
+}
+
+// selectFiles returns the sorted home-relative paths in files matching any
+// of paths, or all of them when paths is empty. A path matches a file it
+// names, the files under a directory it names, or the files its glob
+// matches.
+func selectFiles(files map[string]string, homeDir string, paths []string) ([]string, error) {
+	patterns := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if filepath.IsAbs(p) {
+			rel, err := filepath.Rel(homeDir, p)
+			if err != nil || !filepath.IsLocal(rel) {
+				return nil, fmt.Errorf("%s is not inside home directory %s", p, homeDir)
+			}
+			p = rel
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid restore path %q: %w", p, err)
+		}
+		patterns = append(patterns, filepath.Clean(p))
+	}
+
+	matched := make(map[string]bool)
+	var rels []string
+	for rel := range files {
+		selected := len(patterns) == 0
+		for _, p := range patterns {
+			if matchPath(p, rel) {
+				selected, matched[p] = true, true
+			}
+		}
+		if selected {
+			rels = append(rels, rel)
+		}
+	}
+
+	for _, p := range patterns {
+		if !matched[p] {
+			return nil, fmt.Errorf("no backed up files match %s", p)
+		}
+	}
+	sort.Strings(rels)
+	return rels, nil
+}
+
+// matchPath reports whether the pattern selects the file at rel.
+func matchPath(pattern, rel string) bool {
+	if pattern == "." || rel == pattern || strings.HasPrefix(rel, pattern+string(filepath.Separator)) {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, rel)
+	return ok
+}
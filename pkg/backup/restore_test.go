@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restoreFiles are backed up by newRestoreHome, then changed in home.
+var restoreFiles = map[string]string{
+	"a.conf":                          "a\n",
+	filepath.Join("b", "one.conf"):    "one\n",
+	filepath.Join("b", "two.conf"):    "two\n",
+	filepath.Join("c", "d", "e.txt"):  "e\n",
+	filepath.Join("c", "d", "f.conf"): "f\n",
+}
+
+// newRestoreHome backs up restoreFiles into a snapshot of a new home and
+// then overwrites each of them with "changed\n".
+func newRestoreHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	for rel, content := range restoreFiles {
+		path := filepath.Join(home, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := New(home)
+	for rel := range restoreFiles {
+		if _, err := m.BackupFile(filepath.Join(home, rel)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for rel := range restoreFiles {
+		if err := os.WriteFile(filepath.Join(home, rel), []byte("changed\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, home string) // Runs before Restore, if set
+		opts    func(home string) RestoreOptions
+		want    []string // Restored paths, relative to home
+		wantErr string   // Substring of the expected error, "" for none
+	}{
+		{
+			name: "everything",
+			opts: func(string) RestoreOptions { return RestoreOptions{} },
+			want: []string{"a.conf", "b/one.conf", "b/two.conf", "c/d/e.txt", "c/d/f.conf"},
+		},
+		{
+			name: "single file",
+			opts: func(string) RestoreOptions { return RestoreOptions{Paths: []string{"a.conf"}} },
+			want: []string{"a.conf"},
+		},
+		{
+			name: "directory prefix",
+			opts: func(string) RestoreOptions { return RestoreOptions{Paths: []string{"c"}} },
+			want: []string{"c/d/e.txt", "c/d/f.conf"},
+		},
+		{
+			name: "directory prefix with trailing slash",
+			opts: func(string) RestoreOptions { return RestoreOptions{Paths: []string{"b/"}} },
+			want: []string{"b/one.conf", "b/two.conf"},
+		},
+		{
+			name: "glob does not cross directories",
+			opts: func(string) RestoreOptions { return RestoreOptions{Paths: []string{"*.conf"}} },
+			want: []string{"a.conf"},
+		},
+		{
+			name: "glob in a directory",
+			opts: func(string) RestoreOptions { return RestoreOptions{Paths: []string{"c/d/*.conf", "b/t*"}} },
+			want: []string{"b/two.conf", "c/d/f.conf"},
+		},
+		{
+			name: "absolute path inside home",
+			opts: func(home string) RestoreOptions {
+				return RestoreOptions{Paths: []string{filepath.Join(home, "b", "one.conf")}}
+			},
+			want: []string{"b/one.conf"},
+		},
+		{
+			name: "absolute path outside home",
+			opts: func(string) RestoreOptions {
+				return RestoreOptions{Paths: []string{filepath.Join(os.TempDir(), "elsewhere")}}
+			},
+			wantErr: "is not inside home directory",
+		},
+		{
+			name:    "unmatched path restores nothing",
+			opts:    func(string) RestoreOptions { return RestoreOptions{Paths: []string{"a.conf", "missing.conf"}} },
+			wantErr: "no backed up files match missing.conf",
+		},
+		{
+			name:    "invalid glob",
+			opts:    func(string) RestoreOptions { return RestoreOptions{Paths: []string{"[a"}} },
+			wantErr: "invalid restore path",
+		},
+		{
+			name:    "missing snapshot",
+			opts:    func(string) RestoreOptions { return RestoreOptions{Timestamp: "20000101-000000"} },
+			wantErr: "no backup found with timestamp 20000101-000000",
+		},
+		{
+			name: "no snapshots",
+			setup: func(t *testing.T, home string) {
+				if err := os.RemoveAll(filepath.Join(home, DirName)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			opts:    func(string) RestoreOptions { return RestoreOptions{} },
+			wantErr: "no backups found",
+		},
+		{
+			name: "dry run",
+			opts: func(string) RestoreOptions { return RestoreOptions{Paths: []string{"b"}, DryRun: true} },
+			want: []string{"b/one.conf", "b/two.conf"},
+		},
+		{
+			name: "failure returns the files restored so far",
+			setup: func(t *testing.T, home string) {
+				// A file where the directory b should be makes b/one.conf fail
+				if err := os.RemoveAll(filepath.Join(home, "b")); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(home, "b"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			opts:    func(string) RestoreOptions { return RestoreOptions{} },
+			want:    []string{"a.conf"},
+			wantErr: "failed to restore",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := newRestoreHome(t)
+			if tt.setup != nil {
+				tt.setup(t, home)
+			}
+			opts := tt.opts(home)
+
+			restored, err := New(home).Restore(opts)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Restore: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Restore error = %v, want one containing %q", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, path := range restored {
+				rel, err := filepath.Rel(home, path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("restored %v, want %v", got, tt.want)
+			}
+
+			// Only the reported files have their backed up content again
+			written := make(map[string]bool)
+			if !opts.DryRun {
+				for _, rel := range tt.want {
+					written[filepath.FromSlash(rel)] = true
+				}
+			}
+			for rel, content := range restoreFiles {
+				data, err := os.ReadFile(filepath.Join(home, rel))
+				if err != nil {
+					continue // Replaced by the test's setup
+				}
+				want := "changed\n"
+				if written[rel] {
+					want = content
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", rel, data, want)
+				}
+			}
+		})
+	}
+}
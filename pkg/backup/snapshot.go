@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is the set of backups taken by a single run, stored either as a
+// directory tree or as a single archive.
+type Snapshot struct {
+	Timestamp string
+	Path      string
+	Archive   bool
+	Base      string // Timestamp of the base snapshot for incremental snapshots
+}
+
+// ListSnapshots returns the snapshots in dir (see SnapshotsDir), oldest first.
+func ListSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		archive := !e.IsDir() && strings.HasSuffix(name, ArchiveExt)
+		timestamp := strings.TrimSuffix(name, ArchiveExt)
+		if !e.IsDir() && !archive {
+			continue
+		}
+		if _, err := time.Parse(timestampLayout, timestamp); err != nil {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		base, err := readBase(path)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, Snapshot{
+			Timestamp: timestamp,
+			Path:      path,
+			Archive:   archive,
+			Base:      base,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp < snapshots[j].Timestamp
+	})
+	return snapshots, nil
+}
+
+// FindSnapshot returns the snapshot in dir with the given timestamp, or the most
+// recent snapshot when timestamp is empty.
+func FindSnapshot(dir, timestamp string) (*Snapshot, error) {
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("no backups found in %s", dir)
+	}
+
+	if timestamp == "" {
+		return &snapshots[len(snapshots)-1], nil
+	}
+	for i := range snapshots {
+		if snapshots[i].Timestamp == timestamp {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no backup found with timestamp %s", timestamp)
+}
+
+// Files returns the paths of the backed up files, relative to home.
+func (s Snapshot) Files() ([]string, error) {
+	if s.Archive {
+		return s.archiveFiles()
+	}
+
+	var files []string
+	err := filepath.WalkDir(s.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Path, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", s.Timestamp, err)
+	}
+	return files, nil
+}
+
+// archiveFiles lists the regular files stored in a snapshot archive.
+func (s Snapshot) archiveFiles() ([]string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot %s: %w", s.Timestamp, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", s.Timestamp, err)
+	}
+
+	var files []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot %s: %w", s.Timestamp, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			files = append(files, filepath.FromSlash(hdr.Name))
+		}
+	}
+}
+
+// BackupPath returns the backup path of a file in the snapshot, given its path relative to home.
+func (s Snapshot) BackupPath(relPath string) string {
+	return filepath.Join(s.Path, relPath)
+}
+
+// Restore copies every file in the snapshot back into the home directory.
+// Incremental snapshots are restored together with their chain of bases,
+// using the most recent copy of each file. The recorded mode, owner and
+// modification time of each file are reapplied; owners that cannot be
+// restored without privileges are reported as warnings. With dryRun set,
+// nothing is written. Returns the restored destination paths and warnings.
+func (s Snapshot) Restore(homeDir string, dryRun bool) ([]string, []string, error) {
+	var warnings []string
+	restored, err := s.restore(homeDir, RestoreOptions{
+		DryRun: dryRun,
+		Warn:   func(w string) { warnings = append(warnings, w) },
+	})
+	return restored, warnings, err
+}
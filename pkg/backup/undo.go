@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/manifest"
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// undoFileName is the name of the undo log within the backup directory.
+const undoFileName = "undo.json"
+
+// UndoLog records the changes made by the last run so they can be reverted.
+type UndoLog struct {
+	Timestamp string      `json:"timestamp"`
+	Created   []string    `json:"created"`
+	Updated   []UndoEntry `json:"updated"`
+
+	// Written holds the SHA-256 of the content the run left at each path,
+	// or "" for a file it removed, so Revert can tell whether the file was
+	// changed since. Logs of older versions have none and are not checked.
+	Written map[string]string `json:"written,omitempty"`
+
+	// Manifest holds the manifest entry of each path from before the run,
+	// restored when the path is reverted. Paths without one were not managed.
+	Manifest map[string]manifest.Entry `json:"manifest,omitempty"`
+}
+
+// UndoEntry records an overwritten file and where its previous content was backed up.
+// BackupPath is empty when the run skipped backups (--force).
+type UndoEntry struct {
+	Path       string `json:"path"`
+	BackupPath string `json:"backup_path,omitempty"`
+}
+
+// UndoAction describes a single step taken (or that would be taken) when reverting.
+type UndoAction struct {
+	Path       string
+	BackupPath string // Set when the file is restored from a backup
+	Deleted    bool   // The file was created by the run and is removed
+	Skipped    bool   // The file was overwritten without a backup and cannot be restored
+	Modified   bool   // The file changed since the run and was left alone (see Revert)
+}
+
+// NewUndoLog creates an empty undo log for a run starting now.
+func NewUndoLog() *UndoLog {
+	return &UndoLog{Timestamp: time.Now().Format("20060102-150405")}
+}
+
+// RecordCreate records a file that did not exist before the run, created
+// with content.
+func (l *UndoLog) RecordCreate(path, content string) {
+	l.Created = append(l.Created, path)
+	l.recordWritten(path, manifest.Hash([]byte(content)))
+}
+
+// RecordUpdate records a file overwritten with content and its backup path,
+// if any.
+func (l *UndoLog) RecordUpdate(path, backupPath, content string) {
+	l.Updated = append(l.Updated, UndoEntry{Path: path, BackupPath: backupPath})
+	l.recordWritten(path, manifest.Hash([]byte(content)))
+}
+
+// RecordRemove records a file the run removed and its backup path, if any.
+func (l *UndoLog) RecordRemove(path, backupPath string) {
+	l.Updated = append(l.Updated, UndoEntry{Path: path, BackupPath: backupPath})
+	l.recordWritten(path, "")
+}
+
+// RecordManifestEntry records the manifest entry path had before the run.
+func (l *UndoLog) RecordManifestEntry(path string, e manifest.Entry) {
+	if l.Manifest == nil {
+		l.Manifest = make(map[string]manifest.Entry)
+	}
+	l.Manifest[path] = e
+}
+
+func (l *UndoLog) recordWritten(path, hash string) {
+	if l.Written == nil {
+		l.Written = make(map[string]string)
+	}
+	l.Written[path] = hash
+}
+
+// modified reports whether the file at path differs from what the run left
+// there: changed content, or a file where the run removed one. A file that
+// is missing now has nothing to lose.
+func (l *UndoLog) modified(path string) (bool, error) {
+	want, ok := l.Written[path]
+	if !ok {
+		return false, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return want == "" || manifest.Hash(data) != want, nil
+}
+
+// Empty reports whether the log records no changes.
+func (l *UndoLog) Empty() bool {
+	return len(l.Created) == 0 && len(l.Updated) == 0
+}
+
+// UndoLogPath returns the location of the undo log for the given home directory.
+func UndoLogPath(homeDir string) string {
+	return filepath.Join(homeDir, DirName, undoFileName)
+}
+
+// Save writes the undo log, replacing the log of any previous run.
+// The log and any directories created for it are assigned to o.
+func (l *UndoLog) Save(homeDir string, o *owner.Owner) error {
+	path := UndoLogPath(homeDir)
+	if err := o.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := l.write(path); err != nil {
+		return err
+	}
+	return o.Chown(path)
+}
+
+// write encodes the undo log to path.
+func (l *UndoLog) write(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode undo log: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write undo log: %w", err)
+	}
+	return nil
+}
+
+// LoadUndoLog reads the undo log for the given home directory.
+// Returns nil without error if there is nothing to undo.
+func LoadUndoLog(homeDir string) (*UndoLog, error) {
+	data, err := os.ReadFile(UndoLogPath(homeDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo log: %w", err)
+	}
+
+	var l UndoLog
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse undo log: %w", err)
+	}
+	return &l, nil
+}
+
+// Revert deletes the files the run created and restores the files it
+// overwrote or removed from their backups. A file changed since the run is
+// left alone and reported as Modified, so edits made afterwards are not
+// lost, unless force is set. With dryRun set, only the planned actions are
+// returned. On error, the actions completed so far are returned alongside
+// it. After a successful revert the undo log is removed, or keeps just the
+// modified files when some were left alone.
+func (l *UndoLog) Revert(homeDir string, dryRun, force bool) ([]UndoAction, error) {
+	var actions []UndoAction
+	remaining := &UndoLog{Timestamp: l.Timestamp, Written: l.Written, Manifest: l.Manifest}
+
+	for _, path := range l.Created {
+		modified, err := l.modified(path)
+		if err != nil {
+			return actions, err
+		}
+		if modified && !force {
+			actions = append(actions, UndoAction{Path: path, Deleted: true, Modified: true})
+			remaining.Created = append(remaining.Created, path)
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return actions, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+		actions = append(actions, UndoAction{Path: path, Deleted: true})
+	}
+
+	for _, entry := range l.Updated {
+		if entry.BackupPath == "" {
+			actions = append(actions, UndoAction{Path: entry.Path, Skipped: true})
+			continue
+		}
+		modified, err := l.modified(entry.Path)
+		if err != nil {
+			return actions, err
+		}
+		if modified && !force {
+			actions = append(actions, UndoAction{Path: entry.Path, BackupPath: entry.BackupPath, Modified: true})
+			remaining.Updated = append(remaining.Updated, entry)
+			continue
+		}
+		if !dryRun {
+			if err := restoreFile(entry.BackupPath, entry.Path); err != nil {
+				return actions, fmt.Errorf("failed to restore %s from %s: %w", entry.Path, entry.BackupPath, err)
+			}
+		}
+		actions = append(actions, UndoAction{Path: entry.Path, BackupPath: entry.BackupPath})
+	}
+
+	if dryRun {
+		return actions, nil
+	}
+
+	// Keep what was left alone so a later undo --force can still revert it
+	path := UndoLogPath(homeDir)
+	if !remaining.Empty() {
+		return actions, remaining.write(path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return actions, fmt.Errorf("failed to remove undo log: %w", err)
+	}
+	return actions, nil
+}
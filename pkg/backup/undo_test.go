@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes content to path, creating its directory.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevertLeavesModifiedFiles(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		name := "default"
+		if force {
+			name = "force"
+		}
+		t.Run(name, func(t *testing.T) {
+			home := t.TempDir()
+			created := filepath.Join(home, "created.conf")
+			edited := filepath.Join(home, "edited.conf")
+			updated := filepath.Join(home, "updated.conf")
+			pruned := filepath.Join(home, "pruned.conf")
+
+			// Back up the previous content of the files the run replaces
+			writeFile(t, updated, "old updated\n")
+			writeFile(t, pruned, "old pruned\n")
+			m := New(home)
+			updatedBackup, err := m.BackupFile(updated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prunedBackup, err := m.BackupFile(pruned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The run
+			l := NewUndoLog()
+			writeFile(t, created, "created\n")
+			l.RecordCreate(created, "created\n")
+			writeFile(t, edited, "generated\n")
+			l.RecordCreate(edited, "generated\n")
+			writeFile(t, updated, "new updated\n")
+			l.RecordUpdate(updated, updatedBackup, "new updated\n")
+			if err := os.Remove(pruned); err != nil {
+				t.Fatal(err)
+			}
+			l.RecordRemove(pruned, prunedBackup)
+			if err := l.Save(home, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// Changes made after the run
+			writeFile(t, edited, "generated\nuser edit\n")
+			writeFile(t, pruned, "recreated by the user\n")
+
+			actions, err := l.Revert(home, false, force)
+			if err != nil {
+				t.Fatalf("Revert: %v", err)
+			}
+			modified := map[string]bool{}
+			for _, a := range actions {
+				if a.Modified {
+					modified[filepath.Base(a.Path)] = true
+				}
+			}
+			if force && len(modified) > 0 {
+				t.Errorf("forced Revert left %v alone", modified)
+			}
+			if !force && (len(modified) != 2 || !modified["edited.conf"] || !modified["pruned.conf"]) {
+				t.Errorf("Revert left %v alone, want edited.conf and pruned.conf", modified)
+			}
+
+			want := map[string]string{
+				created: "",
+				edited:  "",
+				updated: "old updated\n",
+				pruned:  "old pruned\n",
+			}
+			if !force {
+				want[edited] = "generated\nuser edit\n"
+				want[pruned] = "recreated by the user\n"
+			}
+			for path, content := range want {
+				data, err := os.ReadFile(path)
+				switch {
+				case content == "" && !os.IsNotExist(err):
+					t.Errorf("%s still exists", filepath.Base(path))
+				case content != "" && string(data) != content:
+					t.Errorf("%s = %q (%v), want %q", filepath.Base(path), data, err, content)
+				}
+			}
+
+			remaining, err := LoadUndoLog(home)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case force && remaining != nil:
+				t.Errorf("undo log kept after a complete revert: %+v", remaining)
+			case !force && (remaining == nil || len(remaining.Created) != 1 || len(remaining.Updated) != 1):
+				t.Errorf("undo log after a partial revert = %+v, want edited.conf and pruned.conf", remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// Op is the kind of a single line edit.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is a single line of an edit script.
+type Edit struct {
+	Op   Op
+	Line string
+}
+
+// MaxEdits bounds the edit distance Lines searches for. Memory grows with
+// its square, so contents differing in more lines get a valid but not
+// minimal script, and Unified only reports that they differ.
+const MaxEdits = 2000
+
+// Lines computes the shortest edit script turning a into b using Myers'
+// algorithm. Beyond MaxEdits changed lines it falls back to deleting and
+// inserting everything between the common prefix and suffix.
+func Lines(a, b []string) []Edit {
+	edits, _ := lines(a, b)
+	return edits
+}
+
+// lines is Lines, also reporting whether the script is minimal.
+func lines(a, b []string) ([]Edit, bool) {
+	// The common prefix and suffix match without searching
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var edits []Edit
+	for _, line := range a[:pre] {
+		edits = append(edits, Edit{Op: Equal, Line: line})
+	}
+	middle, ok := myers(a[pre:len(a)-suf], b[pre:len(b)-suf])
+	edits = append(edits, middle...)
+	for _, line := range a[len(a)-suf:] {
+		edits = append(edits, Edit{Op: Equal, Line: line})
+	}
+	return edits, ok
+}
+
+// myers runs Myers' algorithm for up to MaxEdits steps. The trace keeps only
+// the diagonals each step can read, so memory is quadratic in the edit
+// distance rather than in the length of the contents.
+func myers(a, b []string) ([]Edit, bool) {
+	n, m := len(a), len(b)
+	max := min(n+m, MaxEdits)
+	if n+m == 0 {
+		return nil, true
+	}
+
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b), true
+			}
+		}
+	}
+
+	edits := make([]Edit, 0, n+m)
+	for _, line := range a {
+		edits = append(edits, Edit{Op: Delete, Line: line})
+	}
+	for _, line := range b {
+		edits = append(edits, Edit{Op: Insert, Line: line})
+	}
+	return edits, false
+}
+
+// backtrack walks the Myers trace backwards to build the edit script. Step
+// d of the trace holds diagonals -d-1 to d+1.
+func backtrack(trace [][]int, a, b []string) []Edit {
+	var edits []Edit
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[k-1+d+1] < v[k+1+d+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, Edit{Op: Equal, Line: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, Edit{Op: Insert, Line: b[y-1]})
+			} else {
+				edits = append(edits, Edit{Op: Delete, Line: a[x-1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// SplitLines splits content into lines, dropping the empty element after a trailing newline.
+func SplitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// Unified returns a unified diff between two contents, or "" if they are equal.
+func Unified(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	fromLines, toLines := SplitLines(from), SplitLines(to)
+	edits, ok := lines(fromLines, toLines)
+	if !ok {
+		return fmt.Sprintf("--- %s\n+++ %s\n\\ Files differ in more than %d lines (%d lines -> %d lines); too many changes to show\n",
+			fromName, toName, MaxEdits, len(fromLines), len(toLines))
+	}
+
+	// Record the 0-based position in each side before every edit
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.Op != Insert {
+			aPos[i+1]++
+		}
+		if e.Op != Delete {
+			bPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	hunks := 0
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Op == Equal {
+				run++
+			}
+			if run == len(edits) || run-end > 2*contextLines {
+				end += contextLines
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = run
+		}
+
+		writeHunk(&sb, edits[start:end], aPos[start], bPos[start], aPos[end]-aPos[start], bPos[end]-bPos[start])
+		hunks++
+		i = end
+	}
+
+	// Content differing only in a trailing newline produces no line edits
+	if hunks == 0 {
+		sb.WriteString("\\ Files differ only in trailing newline\n")
+	}
+
+	return sb.String()
+}
+
+// writeHunk writes a single hunk with its header.
+func writeHunk(sb *strings.Builder, edits []Edit, aStart, bStart, aLen, bLen int) {
+	if aLen > 0 {
+		aStart++
+	}
+	if bLen > 0 {
+		bStart++
+	}
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+
+	for _, e := range edits {
+		switch e.Op {
+		case Equal:
+			sb.WriteString(" " + e.Line + "\n")
+		case Delete:
+			sb.WriteString("-" + e.Line + "\n")
+		case Insert:
+			sb.WriteString("+" + e.Line + "\n")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []Edit
+	}{
+		{name: "empty"},
+		{
+			name: "insert only",
+			b:    []string{"a", "b"},
+			want: []Edit{{Insert, "a"}, {Insert, "b"}},
+		},
+		{
+			name: "delete only",
+			a:    []string{"a", "b"},
+			want: []Edit{{Delete, "a"}, {Delete, "b"}},
+		},
+		{
+			name: "equal",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: []Edit{{Equal, "a"}, {Equal, "b"}},
+		},
+		{
+			name: "insert in the middle",
+			a:    []string{"a", "c"},
+			b:    []string{"a", "b", "c"},
+			want: []Edit{{Equal, "a"}, {Insert, "b"}, {Equal, "c"}},
+		},
+		{
+			name: "replace",
+			a:    []string{"a", "x", "c", "y"},
+			b:    []string{"a", "b", "c"},
+			want: []Edit{{Equal, "a"}, {Delete, "x"}, {Insert, "b"}, {Equal, "c"}, {Delete, "y"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{name: "equal", from: "a\n", to: "a\n", want: ""},
+		{
+			name: "new file",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "removed file",
+			from: "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "trailing newline only",
+			from: "a\nb",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n\\ Files differ only in trailing newline\n",
+		},
+		{
+			name: "context around a change",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.from, tt.to); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/backup"
+)
+
+// Status describes what happens to a destination file.
+type Status string
+
+const (
+	StatusCreate    Status = "CREATE"
+	StatusUpdate    Status = "UPDATE"
+	StatusUnchanged Status = "UNCHANGED" // The destination already has the content; nothing is written
+)
+
+// Action records what was done (or would be done, in a dry run) for a single result.
+type Action struct {
+	Result     Result
+	Status     Status
+	BackupPath string        // Where the existing file was (or would be) backed up
+	Duration   time.Duration // Time spent backing up and writing the file
+}
+
+// Failure records a result that could not be backed up or written when
+// ApplyOptions.ContinueOnError is set.
+type Failure struct {
+	Result Result
+	Err    error
+}
+
+// ApplyOptions controls how Apply writes results.
+type ApplyOptions struct {
+	DryRun bool
+	Backup *backup.Manager // Backs up existing files before overwriting; nil disables backups
+
+	// ContinueOnError skips results that fail to back up or write, recording
+	// them (see Failures), instead of stopping at the first error.
+	ContinueOnError bool
+
+	// Explain appends to each file's line why it is created, updated or
+	// skipped, and lists the files skipped as unchanged.
+	Explain bool
+}
+
+// Apply writes results to disk, backing up existing files first, and reports
+// progress to the generator's output, listing the mappings Generate skipped
+// among the results in mapping order. A destination that already has its
+// content is left alone, with a StatusUnchanged action. In dry-run mode
+// nothing is written and the planned actions are returned. On error, the
+// actions completed so far are returned alongside it.
+func (g *Generator) Apply(results []Result, opts ApplyOptions) ([]Action, error) {
+	g.failures = nil
+
+	if opts.DryRun {
+		fmt.Fprintln(g.out, "=== DRY RUN MODE ===")
+		fmt.Fprintln(g.out)
+	}
+
+	// printSkips lists the skipped mappings that come before position
+	skips := g.skipped
+	printSkips := func(position int) {
+		for len(skips) > 0 && g.position(skips[0].DestPath, -1) < position {
+			g.printSkip(skips[0], opts.Explain)
+			skips = skips[1:]
+		}
+	}
+	defer printSkips(math.MaxInt)
+
+	var actions []Action
+	for _, r := range results {
+		printSkips(g.position(r.DestPath, math.MaxInt))
+
+		started := time.Now()
+		action := Action{Result: r, Status: StatusCreate}
+		if r.Exists {
+			action.Status = StatusUpdate
+		}
+
+		// Rewriting a file that already has the content would only add a
+		// duplicate backup and an undo entry
+		if r.Exists && identicalContent(r) {
+			action.Status = StatusUnchanged
+			switch {
+			case opts.Explain:
+				fmt.Fprintf(g.out, "[%s] %s because %s\n", action.Status, r.DestPath, g.explain(r))
+			case g.verbose:
+				fmt.Fprintf(g.out, "[%s] %s\n", action.Status, r.DestPath)
+			}
+			action.Duration = time.Since(started)
+			actions = append(actions, action)
+			g.emit(Event{Kind: EventSkipped, Template: r.TemplatePath, DestPath: r.DestPath, Reason: "content unchanged"})
+			continue
+		}
+
+		if opts.Explain {
+			fmt.Fprintf(g.out, "[%s] %s because %s\n", action.Status, r.DestPath, g.explain(r))
+		} else {
+			fmt.Fprintf(g.out, "[%s] %s\n", action.Status, r.DestPath)
+		}
+
+		if g.verbose {
+			templates := []string{r.TemplatePath}
+			if m, err := g.Resolve(r.TemplatePath); err == nil {
+				templates = m.Templates()
+			}
+			for _, t := range templates {
+				fmt.Fprintf(g.out, "  Source: %s%s\n", t, g.templateOrigin(t))
+			}
+			if opts.DryRun {
+				fmt.Fprintln(g.out, "  --- Content Preview ---")
+				// Show first 500 chars of content
+				preview := r.Preview()
+				if len(preview) > 500 {
+					preview = preview[:500] + "\n  ... (truncated)"
+				}
+				fmt.Fprintln(g.out, preview)
+				fmt.Fprintln(g.out, "  --- End Preview ---")
+			}
+		}
+
+		// Writing into the backup directory could clobber snapshots or the undo log
+		if opts.Backup != nil && !r.Crontab && opts.Backup.Contains(r.DestPath) {
+			return actions, fmt.Errorf("refusing to write %s: it is inside the backup directory", r.DestPath)
+		}
+
+		excluded := opts.Backup != nil && r.Exists && opts.Backup.Excluded(r.DestPath)
+		if excluded && g.verbose {
+			fmt.Fprintln(g.out, "  Backup skipped (excluded)")
+		}
+
+		if opts.DryRun {
+			if r.Crontab {
+				g.printCrontabDiff(r)
+			}
+			if opts.Backup != nil && r.Exists && !excluded {
+				backupPath, err := g.backupPath(opts.Backup, r)
+				if err != nil {
+					return actions, fmt.Errorf("failed to compute backup path for %s: %w", r.DestPath, err)
+				}
+				action.BackupPath = backupPath
+				fmt.Fprintf(g.out, "  Would back up to: %s\n", backupPath)
+			}
+			action.Duration = time.Since(started)
+			actions = append(actions, action)
+			g.emit(Event{Kind: EventPlanned, Template: r.TemplatePath, DestPath: r.DestPath, BackupPath: action.BackupPath})
+			continue
+		}
+
+		// Backup existing file if not forcing
+		if opts.Backup != nil && r.Exists && !excluded {
+			backupPath, err := g.backup(opts.Backup, r)
+			if err != nil {
+				err = fmt.Errorf("failed to backup %s: %w", r.DestPath, err)
+				if !opts.ContinueOnError {
+					g.emit(Event{Kind: EventFailed, Template: r.TemplatePath, DestPath: r.DestPath, Err: err})
+					return actions, err
+				}
+				g.fail(r, err)
+				continue
+			}
+			action.BackupPath = backupPath
+			if backupPath != "" {
+				if g.verbose {
+					fmt.Fprintf(g.out, "  Backed up to: %s\n", backupPath)
+				}
+				g.emit(Event{Kind: EventBackedUp, Template: r.TemplatePath, DestPath: r.DestPath, BackupPath: backupPath})
+			}
+		}
+
+		// Write the file
+		if err := g.WriteFile(r); err != nil {
+			if !opts.ContinueOnError {
+				g.emit(Event{Kind: EventFailed, Template: r.TemplatePath, DestPath: r.DestPath, Err: err})
+				return actions, err
+			}
+			g.fail(r, err)
+			continue
+		}
+
+		action.Duration = time.Since(started)
+		actions = append(actions, action)
+		g.emit(Event{Kind: EventWritten, Template: r.TemplatePath, DestPath: r.DestPath, BackupPath: action.BackupPath})
+	}
+
+	return actions, nil
+}
+
+// printSkip reports a mapping that Generate skipped.
+func (g *Generator) printSkip(skip Skip, explain bool) {
+	switch {
+	case explain && skip.Unchanged:
+		fmt.Fprintf(g.out, "[UNCHANGED] %s because %s\n", skip.DestPath, skip.Reason)
+	case explain:
+		fmt.Fprintf(g.out, "[SKIPPED] %s because %s\n", skip.DestPath, skip.Reason)
+	case !skip.Unchanged:
+		fmt.Fprintf(g.out, "[SKIPPED] %s (%s)\n", skip.DestPath, skip.Reason)
+	case g.verbose:
+		fmt.Fprintf(g.out, "[UNCHANGED] %s\n", skip.DestPath)
+	}
+}
+
+// position returns the index in mapping order of the mapping the last
+// Generate call handled for destPath, or def if it handled none.
+func (g *Generator) position(destPath string, def int) int {
+	if i, ok := g.positions[destPath]; ok {
+		return i
+	}
+	return def
+}
+
+// backupPath returns where r's destination would be backed up to.
+func (g *Generator) backupPath(m *backup.Manager, r Result) (string, error) {
+	if r.Crontab {
+		return m.ContentPath(backup.CrontabName)
+	}
+	return m.BackupPath(r.DestPath)
+}
+
+// backup backs up r's destination, reading the installed crontab for
+// crontab results.
+func (g *Generator) backup(m *backup.Manager, r Result) (string, error) {
+	if !r.Crontab {
+		return m.BackupFile(r.DestPath)
+	}
+	existing, err := r.ReadExisting()
+	if err != nil {
+		return "", err
+	}
+	return m.BackupContent(backup.CrontabName, existing)
+}
+
+// printCrontabDiff shows how a dry run would change the installed crontab,
+// which cannot be inspected as a file.
+func (g *Generator) printCrontabDiff(r Result) {
+	existing, err := r.ReadExisting()
+	if err != nil {
+		fmt.Fprintf(g.out, "  %v\n", err)
+		return
+	}
+	if d := r.Diff("crontab (installed)", "crontab (generated)", string(existing)); d != "" {
+		fmt.Fprint(g.out, d)
+	} else {
+		fmt.Fprintln(g.out, "  No changes")
+	}
+}
+
+// identicalContent reports whether the result's destination already holds
+// exactly the generated content. A sensitive file readable by others is
+// never identical, so writing it restricts its permissions.
+func identicalContent(r Result) bool {
+	if r.Sensitive && !r.Crontab {
+		info, err := os.Stat(r.DestPath)
+		if err != nil || info.Mode().Perm()&^r.FileMode() != 0 {
+			return false
+		}
+	}
+	existing, err := r.ReadExisting()
+	return err == nil && existing != nil && string(existing) == r.Content
+}
+
+// fail records a result skipped after an error and reports it.
+func (g *Generator) fail(r Result, err error) {
+	g.failures = append(g.failures, Failure{Result: r, Err: err})
+	fmt.Fprintf(g.out, "  [FAILED] %v\n", err)
+	g.emit(Event{Kind: EventFailed, Template: r.TemplatePath, DestPath: r.DestPath, Err: err})
+}
+
+// Failures returns the results skipped after errors by the last call to
+// Apply with ContinueOnError set.
+func (g *Generator) Failures() []Failure {
+	return g.failures
+}
+
+// Verify re-reads each written destination and checks that its content
+// matches what was intended, returning a *MultiError listing every mismatch.
+func (g *Generator) Verify(actions []Action) error {
+	errs := &MultiError{}
+	for _, a := range actions {
+		content, err := a.Result.ReadExisting()
+		if err == nil && content == nil {
+			err = os.ErrNotExist
+		}
+		if err != nil {
+			errs.Append(fmt.Errorf("%s: %w", a.Result.DestPath, err))
+			continue
+		}
+		if string(content) != a.Result.Content {
+			errs.Append(fmt.Errorf("%s: content does not match (%d bytes on disk, %d expected)", a.Result.DestPath, len(content), len(a.Result.Content)))
+		}
+	}
+
+	if len(errs.Errors) > 0 {
+		errs.Summary = fmt.Sprintf("verification failed for %d files", len(errs.Errors))
+		return errs
+	}
+
+	fmt.Fprintf(g.out, "Verified %d files\n", len(actions))
+	return nil
+}
+
+// PrintHeader writes the context the run is generating for.
+func (g *Generator) PrintHeader() {
+	fmt.Fprintf(g.out, "homestruct - generating for %s/%s\n", g.ctx.OS, g.ctx.Arch)
+	fmt.Fprintf(g.out, "Home directory: %s\n", g.ctx.Home)
+	fmt.Fprintf(g.out, "User: %s\n\n", g.ctx.User)
+}
+
+// PrintSummary writes the outcome of an Apply call.
+func (g *Generator) PrintSummary(actions []Action, opts ApplyOptions) {
+	backedUp, same := 0, 0
+	for _, a := range actions {
+		if a.BackupPath != "" {
+			backedUp++
+		}
+		if a.Status == StatusUnchanged {
+			same++
+		}
+	}
+
+	where := ""
+	if backedUp > 0 {
+		where = " to: " + opts.Backup.BackupDir()
+		if opts.Backup.InPlace() {
+			where = " next to the originals (.bak)"
+		}
+	}
+
+	fmt.Fprintln(g.out)
+	if opts.DryRun {
+		fmt.Fprintf(g.out, "Would process %d files (dry run - no changes made)\n", len(actions)-same)
+		if backedUp > 0 {
+			fmt.Fprintf(g.out, "Would back up %d existing files%s\n", backedUp, where)
+		}
+	} else {
+		fmt.Fprintf(g.out, "Successfully generated %d files\n", len(actions)-same)
+		if backedUp > 0 {
+			fmt.Fprintf(g.out, "Backed up %d existing files%s\n", backedUp, where)
+		}
+	}
+	var skipped, unchanged int
+	hint := ""
+	for _, skip := range g.skipped {
+		if skip.Unchanged {
+			unchanged++
+			continue
+		}
+		skipped++
+		if strings.HasPrefix(skip.Reason, "requires ") {
+			hint = " (use --ignore-requires to generate them anyway)"
+		}
+	}
+	if unchanged > 0 {
+		fmt.Fprintf(g.out, "Unchanged %d files since the last run (use --no-cache to regenerate them)\n", unchanged)
+	}
+	if same > 0 {
+		fmt.Fprintf(g.out, "Left %d files that already have the generated content\n", same)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(g.out, "Skipped %d files%s\n", skipped, hint)
+	}
+	if len(g.failures) > 0 {
+		fmt.Fprintf(g.out, "Failed to write %d files\n", len(g.failures))
+	}
+}
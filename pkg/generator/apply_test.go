@@ -0,0 +1,271 @@
+package generator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nabkey/home-files/pkg/backup"
+)
+
+func TestApplyOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ApplyOptions // Backup is set to a manager for home if backup is true
+		backup  bool
+		skipped []Skip   // DestPath is relative to home
+		order   []string // Destinations in mapping order, relative to home; none lists skips first
+		same    bool     // Add a result whose destination already has its content
+		blocked bool     // Add a result whose parent directory is a file
+		want    string   // Output, with {home}, {backup} and {err} for the home directory, snapshot and write errors
+		written bool     // Whether the results are on disk afterwards
+	}{
+		{
+			name:   "dry run",
+			opts:   ApplyOptions{DryRun: true},
+			backup: true,
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+=== DRY RUN MODE ===
+
+[CREATE] {home}/new.conf
+[UPDATE] {home}/old.conf
+  Would back up to: {backup}/old.conf
+
+Would process 2 files (dry run - no changes made)
+Would back up 1 existing files to: {backup}
+`,
+		},
+		{
+			name:   "write",
+			backup: true,
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+[CREATE] {home}/new.conf
+[UPDATE] {home}/old.conf
+
+Successfully generated 2 files
+Backed up 1 existing files to: {backup}
+`,
+			written: true,
+		},
+		{
+			name: "write without backups",
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+[CREATE] {home}/new.conf
+[UPDATE] {home}/old.conf
+
+Successfully generated 2 files
+`,
+			written: true,
+		},
+		{
+			name: "skipped and unchanged",
+			skipped: []Skip{
+				{DestPath: "tool.conf", Reason: "requires tool"},
+				{DestPath: "same.conf", Reason: "template and context unchanged", Unchanged: true},
+			},
+			order: []string{"new.conf", "tool.conf", "same.conf", "old.conf"},
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+[CREATE] {home}/new.conf
+[SKIPPED] {home}/tool.conf (requires tool)
+[UPDATE] {home}/old.conf
+
+Successfully generated 2 files
+Unchanged 1 files since the last run (use --no-cache to regenerate them)
+Skipped 1 files (use --ignore-requires to generate them anyway)
+`,
+			written: true,
+		},
+		{
+			name:    "skipped without mapping order",
+			skipped: []Skip{{DestPath: "tool.conf", Reason: "requires tool"}},
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+[SKIPPED] {home}/tool.conf (requires tool)
+[CREATE] {home}/new.conf
+[UPDATE] {home}/old.conf
+
+Successfully generated 2 files
+Skipped 1 files (use --ignore-requires to generate them anyway)
+`,
+			written: true,
+		},
+		{
+			name:    "identical content",
+			opts:    ApplyOptions{Explain: true},
+			backup:  true,
+			skipped: []Skip{{DestPath: "tool.conf", Reason: "requires tool"}},
+			order:   []string{"new.conf", "same.conf", "old.conf", "tool.conf"},
+			same:    true,
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+[CREATE] {home}/new.conf because the destination does not exist
+[UNCHANGED] {home}/same.conf because the destination already has the generated content
+[UPDATE] {home}/old.conf because content differs (+1 -1 lines)
+[SKIPPED] {home}/tool.conf because requires tool
+
+Successfully generated 2 files
+Backed up 1 existing files to: {backup}
+Left 1 files that already have the generated content
+Skipped 1 files (use --ignore-requires to generate them anyway)
+`,
+			written: true,
+		},
+		{
+			name:    "continue on error",
+			opts:    ApplyOptions{ContinueOnError: true},
+			blocked: true,
+			want: `homestruct - generating for linux/amd64
+Home directory: {home}
+User: alice
+
+[CREATE] {home}/new.conf
+[UPDATE] {home}/old.conf
+[CREATE] {home}/blocker/file.conf
+  [FAILED] {err}
+
+Successfully generated 2 files
+Failed to write 1 files
+`,
+			written: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGenerator(t, fstest.MapFS{})
+			home := g.Context().Home
+			var out bytes.Buffer
+			g.SetOutput(&out)
+
+			oldPath := filepath.Join(home, "old.conf")
+			if err := os.WriteFile(oldPath, []byte("old\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			results := []Result{
+				{TemplatePath: "templates/new.conf", DestPath: filepath.Join(home, "new.conf"), Content: "new\n"},
+				{TemplatePath: "templates/old.conf", DestPath: oldPath, Content: "updated\n", Exists: true},
+			}
+			samePath := filepath.Join(home, "same.conf")
+			if tt.same {
+				if err := os.WriteFile(samePath, []byte("same\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				results = []Result{results[0],
+					{TemplatePath: "templates/same.conf", DestPath: samePath, Content: "same\n", Exists: true},
+					results[1]}
+			}
+			if tt.blocked {
+				if err := os.WriteFile(filepath.Join(home, "blocker"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				results = append(results, Result{
+					TemplatePath: "templates/file.conf",
+					DestPath:     filepath.Join(home, "blocker", "file.conf"),
+					Content:      "blocked\n",
+				})
+			}
+			for _, skip := range tt.skipped {
+				skip.DestPath = filepath.Join(home, skip.DestPath)
+				g.skipped = append(g.skipped, skip)
+			}
+			for i, dest := range tt.order {
+				if g.positions == nil {
+					g.positions = map[string]int{}
+				}
+				g.positions[filepath.Join(home, dest)] = i
+			}
+
+			opts := tt.opts
+			if tt.backup {
+				opts.Backup = backup.New(home)
+			}
+
+			g.PrintHeader()
+			actions, err := g.Apply(results, opts)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			g.PrintSummary(actions, opts)
+			if opts.Backup != nil {
+				if err := opts.Backup.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := out.String()
+			for _, f := range g.Failures() {
+				got = strings.ReplaceAll(got, f.Err.Error(), "{err}")
+			}
+			if opts.Backup != nil {
+				got = strings.ReplaceAll(got, opts.Backup.BackupDir(), "{backup}")
+			}
+			got = filepath.ToSlash(strings.ReplaceAll(got, home, "{home}"))
+			if got != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", got, tt.want)
+			}
+
+			wantActions := 2
+			if tt.same {
+				wantActions = 3
+				if actions[1].Status != StatusUnchanged || actions[1].BackupPath != "" {
+					t.Errorf("same.conf has status %s and backup %q, want %s without backup",
+						actions[1].Status, actions[1].BackupPath, StatusUnchanged)
+				}
+				if _, err := os.Stat(filepath.Join(opts.Backup.BackupDir(), "same.conf")); err == nil {
+					t.Errorf("Apply backed up same.conf although its content is unchanged")
+				}
+			}
+			if len(actions) != wantActions {
+				t.Errorf("Apply returned %d actions, want %d", len(actions), wantActions)
+			}
+			wantFailures := 0
+			if tt.blocked {
+				wantFailures = 1
+			}
+			if len(g.Failures()) != wantFailures {
+				t.Errorf("Apply recorded %d failures, want %d", len(g.Failures()), wantFailures)
+			}
+
+			newContent, newErr := os.ReadFile(filepath.Join(home, "new.conf"))
+			oldContent, err := os.ReadFile(oldPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.written && (newErr != nil || string(newContent) != "new\n" || string(oldContent) != "updated\n"):
+				t.Errorf("after a write run new.conf = %q (%v), old.conf = %q", newContent, newErr, oldContent)
+			case !tt.written && (newErr == nil || string(oldContent) != "old\n"):
+				t.Errorf("a dry run wrote new.conf = %q, old.conf = %q", newContent, oldContent)
+			}
+
+			if tt.backup {
+				backedUp, err := os.ReadFile(filepath.Join(opts.Backup.BackupDir(), "old.conf"))
+				switch {
+				case tt.written && (err != nil || string(backedUp) != "old\n"):
+					t.Errorf("backup of old.conf = %q (%v), want %q", backedUp, err, "old\n")
+				case !tt.written && err == nil:
+					t.Errorf("a dry run backed up old.conf")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// blockMarkers returns the begin and end marker lines for a named managed
+// block, commented with prefix.
+func blockMarkers(name, prefix string) (begin, end string) {
+	label := "homestruct"
+	if name != "" {
+		label += " " + name
+	}
+	return prefix + " BEGIN " + label, prefix + " END " + label
+}
+
+// insertBlockContent inserts rendered content into existing between BEGIN/END
+// marker lines commented with prefix. An existing block is replaced in place;
+// otherwise the block is appended to the end of the file. Content outside the
+// markers is untouched. Markers written with "#" before the block used the
+// destination's comment syntax are recognized too. A BEGIN without its END, an
+// END before its BEGIN, or a second block is an error rather than a guess that
+// could delete the user's lines between them.
+func insertBlockContent(existing, rendered, name, prefix string) (string, error) {
+	begin, end := blockMarkers(name, prefix)
+	legacyBegin, legacyEnd := blockMarkers(name, "#")
+
+	block := []string{begin}
+	if body := strings.TrimRight(rendered, "\n"); body != "" {
+		block = append(block, strings.Split(body, "\n")...)
+	}
+	block = append(block, end)
+
+	var lines []string
+	if existing != "" {
+		lines = strings.Split(strings.TrimSuffix(existing, "\n"), "\n")
+	}
+
+	start, stop := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == begin || trimmed == legacyBegin:
+			if start >= 0 && stop < 0 {
+				return "", fmt.Errorf("%q on line %d is inside the block started on line %d; remove one of them", trimmed, i+1, start+1)
+			}
+			if stop >= 0 {
+				return "", fmt.Errorf("%q appears again on line %d after the block on lines %d-%d; remove the duplicate block", trimmed, i+1, start+1, stop+1)
+			}
+			start = i
+		case trimmed == end || trimmed == legacyEnd:
+			if start < 0 || stop >= 0 {
+				return "", fmt.Errorf("%q on line %d has no %q line before it; add it or remove the marker", trimmed, i+1, begin)
+			}
+			stop = i
+		}
+	}
+	if start >= 0 && stop < 0 {
+		return "", fmt.Errorf("%q on line %d has no %q line after it; add it or remove the marker", strings.TrimSpace(lines[start]), start+1, end)
+	}
+
+	var out []string
+	if start >= 0 {
+		out = append(out, lines[:start]...)
+		out = append(out, block...)
+		out = append(out, lines[stop+1:]...)
+	} else {
+		out = append(out, lines...)
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, block...)
+	}
+
+	return strings.Join(out, "\n") + "\n", nil
+}
@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInsertBlockContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		prefix   string
+		want     string
+		wantErr  string // Substring of the expected error, "" for none
+	}{
+		{
+			name:   "empty file",
+			prefix: "#",
+			want:   "# BEGIN homestruct aliases\nalias ll='ls -la'\n# END homestruct aliases\n",
+		},
+		{
+			name:     "appended after user content",
+			existing: "export EDITOR=vim\n",
+			prefix:   "#",
+			want:     "export EDITOR=vim\n\n# BEGIN homestruct aliases\nalias ll='ls -la'\n# END homestruct aliases\n",
+		},
+		{
+			name:     "replaced in place",
+			existing: "before\n# BEGIN homestruct aliases\nold\n# END homestruct aliases\nafter\n",
+			prefix:   "#",
+			want:     "before\n# BEGIN homestruct aliases\nalias ll='ls -la'\n# END homestruct aliases\nafter\n",
+		},
+		{
+			name:     "comment prefix",
+			existing: "vim.o.number = true\n",
+			prefix:   "--",
+			want:     "vim.o.number = true\n\n-- BEGIN homestruct aliases\nalias ll='ls -la'\n-- END homestruct aliases\n",
+		},
+		{
+			name:     "legacy markers are replaced",
+			existing: "before\n# BEGIN homestruct aliases\nold\n# END homestruct aliases\n",
+			prefix:   "--",
+			want:     "before\n-- BEGIN homestruct aliases\nalias ll='ls -la'\n-- END homestruct aliases\n",
+		},
+		{
+			name:     "other blocks are left alone",
+			existing: "# BEGIN homestruct path\nexport PATH\n# END homestruct path\n",
+			prefix:   "#",
+			want:     "# BEGIN homestruct path\nexport PATH\n# END homestruct path\n\n# BEGIN homestruct aliases\nalias ll='ls -la'\n# END homestruct aliases\n",
+		},
+		{
+			name:     "begin without end",
+			existing: "# BEGIN homestruct aliases\nalias user=kept\n",
+			prefix:   "#",
+			wantErr:  `"# BEGIN homestruct aliases" on line 1 has no "# END homestruct aliases" line after it`,
+		},
+		{
+			name:     "end before begin",
+			existing: "# END homestruct aliases\nalias user=kept\n# BEGIN homestruct aliases\n",
+			prefix:   "#",
+			wantErr:  `"# END homestruct aliases" on line 1 has no "# BEGIN homestruct aliases" line before it`,
+		},
+		{
+			name:     "nested begin",
+			existing: "# BEGIN homestruct aliases\n# BEGIN homestruct aliases\n# END homestruct aliases\n",
+			prefix:   "#",
+			wantErr:  "is inside the block started on line 1",
+		},
+		{
+			name:     "duplicate block",
+			existing: "# BEGIN homestruct aliases\n# END homestruct aliases\nkept\n# BEGIN homestruct aliases\n# END homestruct aliases\n",
+			prefix:   "#",
+			wantErr:  "appears again on line 4 after the block on lines 1-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := insertBlockContent(tt.existing, "alias ll='ls -la'\n", "aliases", tt.prefix)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("insertBlockContent error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("insertBlockContent: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("insertBlockContent =\n%s\nwant:\n%s", got, tt.want)
+			}
+
+			// Running again leaves the file as it is
+			again, err := insertBlockContent(got, "alias ll='ls -la'\n", "aliases", tt.prefix)
+			if err != nil || again != got {
+				t.Errorf("second run = %q, %v; want %q", again, err, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template/parse"
+
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// cacheVersion is part of every input hash, so changing how inputs are
+// hashed or rendered invalidates hashes recorded by older versions.
+const cacheVersion = 1
+
+// CacheStatus explains the change-detection decision for one mapping.
+type CacheStatus struct {
+	Template string
+	DestPath string
+	Input    string // Hash of the current render input, empty if not cacheable
+	Stored   string // Input hash recorded by the last run, empty if none
+	Hit      bool   // Whether rendering was skipped as unchanged
+	Reason   string
+}
+
+// renderInput is everything that determines a mapping's rendered output,
+// hashed to detect whether it needs rendering again.
+type renderInput struct {
+	Version   int            `json:"version"`
+	Template  string         `json:"template"`            // SHA-256 of the template content
+	Fragments []string       `json:"fragments,omitempty"` // SHA-256 of each fragment's content
+	Mapping   Mapping        `json:"mapping"`
+	Context   *Context       `json:"context"`          // Includes --set and values files
+	Remote    map[string]any `json:"remote,omitempty"` // Context.Remote, which Context does not serialize
+	Normalize Normalize      `json:"normalize"`
+	Ext       string         `json:"ext"`
+	Header    string         `json:"header,omitempty"`
+	Footer    string         `json:"footer,omitempty"`
+}
+
+// SetCache enables change detection against the manifest of the last run:
+// a mapping whose render input hash and destination content both match the
+// manifest entry is skipped as unchanged instead of rendered. Nil (the
+// default) renders every mapping.
+func (g *Generator) SetCache(man *manifest.Manifest) {
+	g.cache = man
+}
+
+// CacheStatuses returns the change-detection decision for each mapping
+// checked by the last call to Generate, in mapping order.
+func (g *Generator) CacheStatuses() []CacheStatus {
+	return g.cacheStatuses
+}
+
+// inputHash returns the hash of everything that determines m's output, or ""
+// with the reason when the output also depends on inputs that cannot be
+// hashed: included files, the environment, or custom template functions.
+func (g *Generator) inputHash(m Mapping) (string, string, error) {
+	var hashes []string
+	for _, templatePath := range m.Templates() {
+		name, content, err := g.readTemplate(templatePath)
+		if err != nil {
+			return "", "", err
+		}
+		if reason := g.uncacheable(m, name, string(content)); reason != "" {
+			return "", reason, nil
+		}
+		hashes = append(hashes, manifest.Hash(content))
+	}
+
+	data, err := json.Marshal(renderInput{
+		Version:   cacheVersion,
+		Template:  hashes[0],
+		Fragments: hashes[1:],
+		Mapping:   m,
+		Context:   g.ctx,
+		Remote:    g.ctx.Remote,
+		Normalize: g.normalize,
+		Ext:       g.ext,
+		Header:    g.header,
+		Footer:    g.footer,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash input of %s: %w", m.Template, err)
+	}
+	return manifest.Hash(data), "", nil
+}
+
+// uncacheable returns why the output of m's template name cannot be
+// predicted from its hashed input, or "" if it can: the template calls
+// include, rendered, fetch or a custom template function, or reads .Env.
+// Only calls and fields count, so e.g. a literal "[fetch]" section does not.
+// Files copied verbatim are always cacheable.
+func (g *Generator) uncacheable(m Mapping, name, content string) string {
+	if !m.renders(name, g.ext) {
+		return ""
+	}
+	tmpl, err := g.parseTemplate(&m, name, content)
+	if err != nil {
+		// Rendering reports the error
+		return "does not parse"
+	}
+
+	customFuncsMu.RLock()
+	defer customFuncsMu.RUnlock()
+	var reason string
+	walkTemplate(tmpl, func(node parse.Node) {
+		if reason != "" {
+			return
+		}
+		switch n := node.(type) {
+		case *parse.IdentifierNode:
+			switch _, custom := customFuncs[n.Ident]; {
+			case n.Ident == "include" || n.Ident == "rendered" || n.Ident == "fetch":
+				reason = "uses " + n.Ident
+			case custom:
+				reason = "uses custom function " + n.Ident
+			}
+		case *parse.FieldNode:
+			if n.Ident[0] == "Env" {
+				reason = "uses .Env"
+			}
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" && n.Ident[1] == "Env" {
+				reason = "uses .Env"
+			}
+		}
+	})
+	return reason
+}
+
+// checkCache decides whether m can be skipped as unchanged: its input hash
+// must match the one recorded by the last run, and the destination must
+// still have the content written then.
+func (g *Generator) checkCache(m Mapping, destPath string) (CacheStatus, error) {
+	status := CacheStatus{Template: m.Template, DestPath: destPath}
+
+	input, reason, err := g.inputHash(m)
+	if err != nil {
+		return status, err
+	}
+	status.Input = input
+	if input == "" {
+		status.Reason = reason + ", always rendered"
+		return status, nil
+	}
+	if g.cache == nil {
+		status.Reason = "cache disabled"
+		return status, nil
+	}
+
+	rel, err := filepath.Rel(g.ctx.Home, destPath)
+	if err != nil {
+		status.Reason = "destination outside home"
+		return status, nil
+	}
+	entry, ok := g.cache.Files[filepath.ToSlash(rel)]
+	status.Stored = entry.Input
+	switch {
+	case !ok || entry.Input == "":
+		status.Reason = "no input hash recorded"
+		return status, nil
+	case entry.Input != input:
+		status.Reason = "input changed"
+		return status, nil
+	}
+
+	info, err := os.Stat(destPath)
+	if err != nil {
+		status.Reason = "destination missing"
+		return status, nil
+	}
+	if g.maxSize > 0 && info.Size() > g.maxSize {
+		status.Reason = "destination too large to compare"
+		return status, nil
+	}
+	data, err := os.ReadFile(destPath)
+	if err != nil || manifest.Hash(data) != entry.SHA256 {
+		status.Reason = "destination modified since last run"
+		return status, nil
+	}
+
+	status.Hit = true
+	status.Reason = "input and destination unchanged"
+	return status, nil
+}
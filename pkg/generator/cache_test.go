@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func init() {
+	if err := RegisterFunc("cacheTestFunc", func() string { return "" }); err != nil {
+		panic(err)
+	}
+}
+
+func TestUncacheable(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain.tmpl", "user = {{ .User }}\n", ""},
+		{"gitconfig.tmpl", "[fetch]\n\tprune = true\n[include]\n\tpath = ~/.gitconfig.local\n", ""},
+		{"words.tmpl", "{{/* fetch and include are cached */}}{{ .Set.rendered }} {{ .Data.Env }}\n", ""},
+		{"verbatim.conf", "{{ include \".local\" }}", ""},
+		{"include.tmpl", "{{ include \".gitconfig.local\" }}", "uses include"},
+		{"pipe.tmpl", "{{ \".local\" | include | printf \"%s\" }}", "uses include"},
+		{"rendered.tmpl", "{{ if .IsWSL }}{{ rendered \".zshrc\" | len }}{{ end }}", "uses rendered"},
+		{"fetch.tmpl", "{{ define \"remote\" }}{{ fetch \"https://example.com\" }}{{ end }}{{ template \"remote\" }}", "uses fetch"},
+		{"env.tmpl", "PATH={{ .Env.PATH }}", "uses .Env"},
+		{"env-with.tmpl", "{{ with .Env }}{{ .PATH }}{{ end }}", "uses .Env"},
+		{"env-root.tmpl", "{{ range .Data.hosts }}{{ $.Env.HOME }}{{ end }}", "uses .Env"},
+		{"custom.tmpl", "{{ cacheTestFunc }}", "uses custom function cacheTestFunc"},
+		{"broken.tmpl", "{{ .User", "does not parse"},
+	}
+
+	g := newTestGenerator(t, fstest.MapFS{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Mapping{Template: "templates/" + tt.name}
+			if got := g.uncacheable(m, m.Template, tt.content); got != tt.want {
+				t.Errorf("uncacheable(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputHashRemote(t *testing.T) {
+	g := newTestGenerator(t, fstest.MapFS{
+		"templates/proxy.tmpl": {Data: []byte("proxy = {{ .Remote.proxy }}\n")},
+	})
+	m := Mapping{Template: "templates/proxy.tmpl", Dest: ".proxy"}
+
+	hash := func() string {
+		t.Helper()
+		h, reason, err := g.inputHash(m)
+		if err != nil || reason != "" {
+			t.Fatalf("inputHash = %q, %q, %v", h, reason, err)
+		}
+		return h
+	}
+
+	g.ctx.Remote = map[string]any{"proxy": "http://a"}
+	first := hash()
+	g.ctx.Remote = map[string]any{"proxy": "http://b"}
+	if hash() == first {
+		t.Error("input hash ignores .Remote values")
+	}
+
+	// The values stay out of lockfiles
+	path := filepath.Join(t.TempDir(), "context.json")
+	if err := g.ctx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "http://b") {
+		t.Errorf("lockfile contains the remote values:\n%s", data)
+	}
+}
@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// commentPrefixes maps file extensions (or extension-less dotfile names) to
+// their line comment syntax. Anything not listed uses "#".
+var commentPrefixes = map[string]string{
+	".lua":  "--",
+	".sql":  "--",
+	".kdl":  "//",
+	".js":   "//",
+	".ts":   "//",
+	".go":   "//",
+	".vim":  "\"",
+	".ini":  ";",
+	".zsh":  "#",
+	".sh":   "#",
+	".bash": "#",
+	".toml": "#",
+	".yaml": "#",
+	".yml":  "#",
+	".conf": "#",
+}
+
+// commentPrefix returns the line comment syntax for a destination path.
+func commentPrefix(dest string) string {
+	if prefix, ok := commentPrefixes[strings.ToLower(filepath.Ext(dest))]; ok {
+		return prefix
+	}
+	return "#"
+}
+
+// commentPrefix returns the line comment syntax of the mapping's destination,
+// honoring the CommentPrefix override.
+func (m Mapping) commentPrefix() string {
+	if m.CommentPrefix != "" {
+		return m.CommentPrefix
+	}
+	return commentPrefix(m.Destination())
+}
+
+// annotationPrefix returns the prefix of template annotation lines for a
+// mapping, e.g. "##homestruct" for shell files or "--#homestruct" for Lua.
+func (m Mapping) annotationPrefix() string {
+	return m.commentPrefix() + "#homestruct"
+}
+
+// banner returns a "managed by homestruct" header for the template of m,
+// commented in its destination's syntax, followed by any extra lines. It has
+// no trailing newline.
+func banner(m *Mapping, extra ...string) string {
+	prefix, source := "#", ""
+	if m != nil {
+		prefix, source = m.commentPrefix(), m.Template
+	}
+
+	lines := []string{"Managed by homestruct - do not edit, changes will be overwritten"}
+	if source != "" {
+		lines = append(lines, "Source: "+source)
+	}
+	lines = append(lines, extra...)
+
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(prefix+" "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripLines removes every line whose first non-blank text starts with prefix.
+func stripLines(content, prefix string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var sb strings.Builder
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), prefix) {
+			continue
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
@@ -1,31 +1,80 @@
 package generator
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/user"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 // Context provides template variables for rendering.
 type Context struct {
-	OS   string // "darwin" or "linux"
-	Arch string // "amd64" or "arm64"
-	Home string // User home directory path
-	User string // Current username
+	OS   string `json:"os"`   // "darwin" or "linux"
+	Arch string `json:"arch"` // "amd64" or "arm64"
+	Home string `json:"home"` // User home directory path
+	User string `json:"user"` // Current username
+
+	Group string `json:"group"` // Current user's primary group name, or numeric gid if unknown
+
+	Hostname string `json:"hostname"` // Machine hostname, empty if unknown
+	Shell    string `json:"shell"`    // Login shell path from $SHELL or /etc/passwd, empty if unknown
+
+	// XDG base directories from $XDG_CONFIG_HOME etc., or the spec defaults
+	// under Home (~/.config, ~/.local/share, ~/.local/state, ~/.cache)
+	ConfigHome string `json:"config_home"`
+	DataHome   string `json:"data_home"`
+	StateHome  string `json:"state_home"`
+	CacheHome  string `json:"cache_home"`
+
+	// Best-effort environment detection, false when undeterminable
+	IsContainer bool `json:"is_container"` // Inside Docker, Podman, LXC or Kubernetes (HOMESTRUCT_CONTAINER overrides)
+	IsWSL       bool `json:"is_wsl"`       // Under the Windows Subsystem for Linux (HOMESTRUCT_WSL overrides)
+	IsVM        bool `json:"is_vm"`        // On a virtual machine (HOMESTRUCT_VM overrides)
+
+	// Terminal generate runs in, from the environment (HOMESTRUCT_TERM,
+	// HOMESTRUCT_TERM_PROGRAM and HOMESTRUCT_TRUECOLOR override)
+	Term        string `json:"term"`         // $TERM, e.g. "xterm-256color"; empty if unset
+	TermProgram string `json:"term_program"` // Terminal emulator, e.g. "iTerm.app", "WezTerm" or "kitty"; empty if unknown
+	TrueColor   bool   `json:"truecolor"`    // Supports 24-bit color
+
+	Set map[string]any `json:"set,omitempty"` // Values from --set flags (e.g. {{ .Set.gitEmail }})
+
+	// Remote holds the values from the --remote-values store (e.g.
+	// {{ .Remote.proxy }}). Like Env it is never serialized: the store may
+	// hold secrets that must not end up in a committed lockfile.
+	Remote map[string]any `json:"-"`
+
+	Data map[string]any `json:"data,omitempty"` // Structured data from templates/data.json and --data files (e.g. {{ range .Data.aliases }})
+
+	// Env holds the process environment (e.g. {{ .Env.PATH }}). It is never
+	// serialized, so it does not leak into reports or lockfiles.
+	Env map[string]string `json:"-"`
 }
 
 // NewContext creates a new Context with system information.
 // Environment variables HOMESTRUCT_OS and HOMESTRUCT_ARCH can override
-// the detected values (useful for generating configs for other platforms).
+// the detected values (useful for generating configs for other platforms),
+// as can HOMESTRUCT_CONTAINER, HOMESTRUCT_WSL and HOMESTRUCT_VM ("1" or "0")
+// and the terminal overrides (see detectTerm).
+// If the current user cannot be looked up, User comes from the environment
+// and Group is left empty instead of failing.
 func NewContext() (*Context, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, err
 	}
 
-	currentUser, err := user.Current()
-	if err != nil {
-		return nil, err
+	// user.Current fails on locked-down systems without a passwd entry for
+	// the uid; fall back to the environment rather than failing templates
+	// that never use the user or group
+	userName, group := "", ""
+	if currentUser, err := user.Current(); err == nil {
+		userName, group = username(currentUser), groupName(currentUser)
+	} else {
+		userName = envUsername()
 	}
 
 	// Allow environment variable overrides for cross-platform config generation
@@ -39,10 +88,163 @@ func NewContext() (*Context, error) {
 		archVal = runtime.GOARCH
 	}
 
-	return &Context{
-		OS:   osVal,
-		Arch: archVal,
-		Home: homeDir,
-		User: currentUser.Username,
-	}, nil
+	hostname, _ := os.Hostname()
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = loginShell(userName)
+	}
+
+	ctx := &Context{
+		OS:       osVal,
+		Arch:     archVal,
+		Home:     homeDir,
+		User:     userName,
+		Group:    group,
+		Hostname: hostname,
+		Shell:    shell,
+
+		IsContainer: envOverride("HOMESTRUCT_CONTAINER", detectContainer),
+		IsWSL:       envOverride("HOMESTRUCT_WSL", detectWSL),
+		IsVM:        envOverride("HOMESTRUCT_VM", detectVM),
+
+		Set:    map[string]any{},
+		Remote: map[string]any{},
+		Data:   map[string]any{},
+		Env:    environ(),
+	}
+	ctx.resolveXDG(ctx.Env, false)
+	ctx.detectTerm(ctx.Env)
+	return ctx, nil
+}
+
+// environ returns the process environment as a map.
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok && key != "" {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// LoadContext reads a context previously written with Save, so generation
+// can reproduce another machine's output. Env is taken from the current
+// process.
+func LoadContext(path string) (*Context, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context lockfile: %w", err)
+	}
+
+	var ctx Context
+	if err := json.Unmarshal(data, &ctx); err != nil {
+		return nil, fmt.Errorf("failed to parse context lockfile %s: %w", path, err)
+	}
+	if ctx.Set == nil {
+		ctx.Set = map[string]any{}
+	}
+	// Neither are the remote values
+	ctx.Remote = map[string]any{}
+	if ctx.Data == nil {
+		ctx.Data = map[string]any{}
+	}
+	// The environment is not pinned by the lockfile
+	ctx.Env = environ()
+	// Lockfiles written before the XDG fields existed use the defaults
+	ctx.resolveXDG(nil, true)
+	return &ctx, nil
+}
+
+// Save writes the context to path as JSON.
+func (c *Context) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode context: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write context lockfile: %w", err)
+	}
+	return nil
+}
+
+// Mismatches describes the detected fields of c that differ from other.
+func (c *Context) Mismatches(other *Context) []string {
+	fields := []struct{ name, got, want string }{
+		{"os", c.OS, other.OS},
+		{"arch", c.Arch, other.Arch},
+		{"home", c.Home, other.Home},
+		{"user", c.User, other.User},
+		{"group", c.Group, other.Group},
+		{"hostname", c.Hostname, other.Hostname},
+		{"shell", c.Shell, other.Shell},
+		{"is_container", strconv.FormatBool(c.IsContainer), strconv.FormatBool(other.IsContainer)},
+		{"is_wsl", strconv.FormatBool(c.IsWSL), strconv.FormatBool(other.IsWSL)},
+		{"is_vm", strconv.FormatBool(c.IsVM), strconv.FormatBool(other.IsVM)},
+		{"term", c.Term, other.Term},
+		{"term_program", c.TermProgram, other.TermProgram},
+		{"truecolor", strconv.FormatBool(c.TrueColor), strconv.FormatBool(other.TrueColor)},
+	}
+
+	var out []string
+	for _, f := range fields {
+		if f.got != f.want {
+			out = append(out, fmt.Sprintf("%s is %q but %q was detected", f.name, f.got, f.want))
+		}
+	}
+	return out
+}
+
+// username returns the account name without any Windows domain prefix
+// ("DOMAIN\\user" becomes "user").
+func username(u *user.User) string {
+	name := u.Username
+	if i := strings.LastIndex(name, `\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// envUsername returns the username from $USER, $LOGNAME or (on Windows)
+// $USERNAME, or empty if none is set.
+func envUsername() string {
+	for _, key := range []string{"USER", "LOGNAME", "USERNAME"} {
+		if name := os.Getenv(key); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// loginShell returns name's login shell from /etc/passwd, or "" if it
+// cannot be determined.
+func loginShell(name string) string {
+	if name == "" {
+		return ""
+	}
+	data, err := os.ReadFile("/etc/passwd")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) == 7 && fields[0] == name {
+			return fields[6]
+		}
+	}
+	return ""
+}
+
+// groupName returns the name of u's primary group, falling back to the
+// numeric gid (a SID on Windows) when it cannot be looked up.
+func groupName(u *user.User) string {
+	if u.Gid == "" {
+		return ""
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		return u.Gid
+	}
+	return g.Name
 }
@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CrontabDest is the DestPath of results for mappings with Crontab set,
+// which are installed with the crontab command instead of written to a file.
+const CrontabDest = "crontab"
+
+// readCrontab returns the current user's crontab via "crontab -l" and
+// whether one is installed.
+func readCrontab() (string, bool, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("crontab", "-l")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(strings.ToLower(stderr.String()), "no crontab") {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to read crontab: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), true, nil
+}
+
+// installCrontab replaces the current user's crontab with content via
+// "crontab -".
+func installCrontab(content string) error {
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(content)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to install crontab: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ReadExisting returns the current content of the result's destination:
+// the file, or the installed crontab for crontab results. A missing
+// destination returns nil content and no error.
+func (r Result) ReadExisting() ([]byte, error) {
+	if r.Crontab {
+		content, exists, err := readCrontab()
+		if err != nil || !exists {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+	data, err := os.ReadFile(r.DestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", r.DestPath, err)
+	}
+	return data, nil
+}
+
+// generateCrontab combines a rendered crontab mapping with the installed
+// crontab. ModeBlock keeps entries the user added by hand.
+func (g *Generator) generateCrontab(m Mapping, o outcome, rendered string) outcome {
+	existing, exists, err := readCrontab()
+	if err != nil {
+		o.err = err
+		return o
+	}
+	rendered, err = applyMode(m, existing, rendered)
+	if err != nil {
+		o.err = err
+		return o
+	}
+	o.result = &Result{
+		TemplatePath: m.Template,
+		DestPath:     CrontabDest,
+		Content:      rendered,
+		Exists:       exists,
+		Crontab:      true,
+		Sensitive:    m.sensitive(),
+	}
+	return o
+}
@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// DataFile is the path within the templates FS of the default template data
+// (.Data), a JSON object. It is optional, and may be written in YAML as
+// templates/data.yaml (or .yml) instead (see builtinFiles).
+const DataFile = "templates/data.json"
+
+// LoadData sets the template data (.Data): structured content such as lists
+// of aliases that templates range over, kept apart from the templates that
+// present it. Layers are merged like LoadValues, from lowest to highest
+// precedence: DataFile from the templates FS, each data file in order, then
+// the data already in the context (e.g. from a locked context). Files named
+// .yaml or .yml are YAML, others JSON.
+func (g *Generator) LoadData(files []string) error {
+	data := make(map[string]any)
+
+	for _, name := range builtinFiles(DataFile) {
+		content, err := fs.ReadFile(g.templates, name)
+		switch {
+		case err == nil:
+			defaults, err := decodeValuesFile(name, content)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			MergeValues(data, defaults)
+		case !errors.Is(err, fs.ErrNotExist):
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+
+	for _, path := range files {
+		loaded, err := LoadDataFile(path)
+		if err != nil {
+			return err
+		}
+		MergeValues(data, loaded)
+	}
+
+	MergeValues(data, g.ctx.Data)
+	g.ctx.Data = data
+	return nil
+}
+
+// LoadDataFile reads an object of template data from path: a YAML mapping if
+// it is named .yaml or .yml, a JSON object otherwise.
+func LoadDataFile(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+	data, err := decodeValuesFile(path, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data file %s: %w", path, err)
+	}
+	return data, nil
+}
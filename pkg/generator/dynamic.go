@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"text/template"
+)
+
+// MappingsTemplate is the path within the templates FS of the optional
+// template that renders additional mappings (see LoadMappingsTemplate).
+const MappingsTemplate = "templates/mappings.tmpl"
+
+// LoadMappingsTemplate renders MappingsTemplate against the context and adds
+// the mappings it produces, a JSON array of Mapping objects with the Go
+// field names (e.g. {"Template": "...", "Dest": "..."}), after FileMappings.
+// Call it after LoadValues so the template can use .Set. The combined
+// mappings are validated like FileMappings, so a rendered mapping that
+// conflicts with a built-in one is an error.
+func (g *Generator) LoadMappingsTemplate() error {
+	content, err := fs.ReadFile(g.templates, MappingsTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to read mappings template: %w", err)
+	}
+
+	tmpl, err := template.New(MappingsTemplate).Funcs(g.funcMap(nil)).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to render mappings template: %w", withSourceContext(MappingsTemplate, string(content), err))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, g.ctx); err != nil {
+		return fmt.Errorf("failed to render mappings template: %w", withSourceContext(MappingsTemplate, string(content), err))
+	}
+
+	dec := json.NewDecoder(&buf)
+	dec.DisallowUnknownFields()
+	var rendered []Mapping
+	if err := dec.Decode(&rendered); err != nil {
+		return fmt.Errorf("failed to parse mappings rendered from %s: %w", MappingsTemplate, err)
+	}
+
+	errs := &MultiError{Summary: "invalid mappings rendered from " + MappingsTemplate}
+	for i, m := range rendered {
+		switch {
+		case m.Template == "":
+			errs.Append(fmt.Errorf("mapping %d has no Template", i+1))
+		case m.Dest == "" && !m.Crontab:
+			errs.Append(fmt.Errorf("mapping %s has no Dest", m.Template))
+		case !m.Crontab && !filepath.IsLocal(m.Dest):
+			errs.Append(fmt.Errorf("mapping %s has destination %s outside home", m.Template, m.Dest))
+		}
+	}
+	if err := invalidMappings(errs); err != nil {
+		return err
+	}
+
+	mappings := append(slices.Clone(FileMappings), rendered...)
+	if err := ValidateMappings(mappings); err != nil {
+		return err
+	}
+	g.mappings = mappings
+	return nil
+}
+
+// Mappings returns the mappings the generator processes, in order:
+// FileMappings followed by any loaded with LoadMappingsTemplate, with XDG
+// path roots resolved against the context. The slice is a copy.
+func (g *Generator) Mappings() []Mapping {
+	if g.mappings == nil {
+		return g.resolveRoots(slices.Clone(FileMappings))
+	}
+	return g.resolveRoots(slices.Clone(g.mappings))
+}
@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// cp1252High maps the characters Windows-1252 places in 0x80-0x9F, where
+// Latin-1 has C1 control codes, to their bytes.
+var cp1252High = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// encoders convert a rune to a single byte in a target encoding, reporting
+// false when the rune cannot be represented. Keys are lower-case names
+// accepted in Mapping.Encoding.
+var encoders = map[string]func(rune) (byte, bool){
+	"ascii": func(r rune) (byte, bool) {
+		return byte(r), r < 0x80
+	},
+	"latin1": func(r rune) (byte, bool) {
+		return byte(r), r < 0x100
+	},
+	"windows-1252": func(r rune) (byte, bool) {
+		if b, ok := cp1252High[r]; ok {
+			return b, true
+		}
+		return byte(r), r < 0x80 || (r >= 0xA0 && r < 0x100)
+	},
+}
+
+// encodingAliases maps alternative names to keys of encoders.
+var encodingAliases = map[string]string{
+	"us-ascii":   "ascii",
+	"iso-8859-1": "latin1",
+	"iso8859-1":  "latin1",
+	"cp1252":     "windows-1252",
+}
+
+// isUTF8 reports whether name selects the default UTF-8 passthrough.
+func isUTF8(name string) bool {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return true
+	}
+	return false
+}
+
+// encoder returns the encoder for name, resolving aliases.
+func encoder(name string) (func(rune) (byte, bool), bool) {
+	name = strings.ToLower(name)
+	if alias, ok := encodingAliases[name]; ok {
+		name = alias
+	}
+	enc, ok := encoders[name]
+	return enc, ok
+}
+
+// validEncoding reports whether name is UTF-8 or a supported encoding.
+func validEncoding(name string) bool {
+	if isUTF8(name) {
+		return true
+	}
+	_, ok := encoder(name)
+	return ok
+}
+
+// encodingNames returns the supported encoding names, for error messages.
+func encodingNames() []string {
+	names := []string{"utf-8"}
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// encode converts UTF-8 content to the named encoding. It fails on the first
+// character the encoding cannot represent, giving its line number.
+func encode(content, name string) (string, error) {
+	if isUTF8(name) {
+		return content, nil
+	}
+	enc, ok := encoder(name)
+	if !ok {
+		return "", fmt.Errorf("unknown encoding %q (expected one of %s)", name, strings.Join(encodingNames(), ", "))
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	line := 1
+	for _, r := range content {
+		c, ok := enc(r)
+		if !ok {
+			return "", fmt.Errorf("character %q (U+%04X) on line %d cannot be represented in %s", r, r, line, name)
+		}
+		if r == '\n' {
+			line++
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		encoding string
+		want     string
+		wantErr  string // Substring of the expected error, "" for none
+	}{
+		{name: "utf-8 passthrough", content: "café €\n", encoding: "UTF-8", want: "café €\n"},
+		{name: "ascii", content: "plain\n", encoding: "us-ascii", want: "plain\n"},
+		{name: "ascii rejects accents", content: "ok\ncafé\n", encoding: "ascii", wantErr: `character 'é' (U+00E9) on line 2 cannot be represented in ascii`},
+		{name: "latin1", content: "café ÿ\n", encoding: "latin1", want: "caf\xe9 \xff\n"},
+		{name: "latin1 keeps C1 controls", content: "\u0080\u009f", encoding: "ISO-8859-1", want: "\x80\x9f"},
+		{name: "latin1 rejects the euro sign", content: "a\nb\nc €\n", encoding: "latin1", wantErr: `character '€' (U+20AC) on line 3 cannot be represented in latin1`},
+		{
+			name:     "windows-1252 0x80-0x9F",
+			content:  "€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ",
+			encoding: "cp1252",
+			want:     "\x80\x82\x83\x84\x85\x86\x87\x88\x89\x8a\x8b\x8c\x8e\x91\x92\x93\x94\x95\x96\x97\x98\x99\x9a\x9b\x9c\x9e\x9f",
+		},
+		{name: "windows-1252 Latin-1 range", content: "\u00a0café ÿ\n", encoding: "windows-1252", want: "\xa0caf\xe9 \xff\n"},
+		{name: "windows-1252 rejects undefined 0x81", content: "x\u0081", encoding: "windows-1252", wantErr: `(U+0081) on line 1 cannot be represented`},
+		{name: "windows-1252 rejects undefined 0x8D", content: "\n\n\u008d", encoding: "windows-1252", wantErr: `(U+008D) on line 3 cannot be represented`},
+		{name: "windows-1252 rejects undefined 0x8F", content: "\u008f", encoding: "windows-1252", wantErr: `(U+008F)`},
+		{name: "windows-1252 rejects undefined 0x90", content: "\u0090", encoding: "windows-1252", wantErr: `(U+0090)`},
+		{name: "windows-1252 rejects undefined 0x9D", content: "\u009d", encoding: "windows-1252", wantErr: `(U+009D)`},
+		{name: "unknown encoding", content: "x", encoding: "ebcdic", wantErr: `unknown encoding "ebcdic" (expected one of utf-8, ascii, latin1, windows-1252)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encode(tt.content, tt.encoding)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("encode error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("encode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
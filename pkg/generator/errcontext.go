@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// contextLines is how many template lines are shown before and after the
+// line a template error points at.
+const contextLines = 2
+
+// TemplateError is a template parse or execution error, annotated with the
+// template source around the position the error reports.
+type TemplateError struct {
+	Template string
+	Line     int // 1-based
+	Column   int // 0-based byte offset within the line, -1 if unknown
+	Err      error
+
+	source string
+}
+
+// Error returns the underlying error followed by the source excerpt.
+func (e *TemplateError) Error() string {
+	return e.Err.Error() + "\n" + e.Excerpt()
+}
+
+// Unwrap returns the underlying template error.
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// Excerpt returns the template lines around the error, the offending one
+// marked with ">" and followed by a caret under the column when known.
+func (e *TemplateError) Excerpt() string {
+	lines := strings.Split(strings.TrimSuffix(e.source, "\n"), "\n")
+	first := max(1, e.Line-contextLines)
+	last := min(len(lines), e.Line+contextLines)
+	width := len(strconv.Itoa(last))
+
+	var sb strings.Builder
+	for n := first; n <= last; n++ {
+		line := lines[n-1]
+		marker := " "
+		if n == e.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(&sb, "%s %*d | %s\n", marker, width, n, line)
+		if n == e.Line && e.Column >= 0 && e.Column <= len(line) {
+			fmt.Fprintf(&sb, "  %s | %s^\n", strings.Repeat(" ", width), caretIndent(line[:e.Column]))
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// caretIndent returns whitespace as wide as prefix, keeping tabs so the
+// caret lines up with the source line.
+func caretIndent(prefix string) string {
+	var sb strings.Builder
+	for _, r := range prefix {
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	return sb.String()
+}
+
+// withSourceContext wraps a text/template or html/template error for the
+// template name with the source around the position it reports. Errors
+// without a position in that template are returned unchanged.
+func withSourceContext(name, source string, err error) error {
+	re := regexp.MustCompile(`template: ?` + regexp.QuoteMeta(name) + `:(\d+)(?::(\d+))?:`)
+	match := re.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	if line < 1 || line > strings.Count(strings.TrimSuffix(source, "\n"), "\n")+1 {
+		return err
+	}
+	column := -1
+	if match[2] != "" {
+		column, _ = strconv.Atoi(match[2])
+	}
+	return &TemplateError{Template: name, Line: line, Column: column, Err: err, source: source}
+}
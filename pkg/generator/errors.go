@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MultiError aggregates several errors so they can be reported at once,
+// e.g. every invalid mapping. Each error stays reachable through errors.Is
+// and errors.As via Unwrap.
+type MultiError struct {
+	Summary string // Heading for the list, e.g. "invalid mappings"; empty for "N errors"
+	Errors  []error
+}
+
+// Append adds err to the list, ignoring nil.
+func (e *MultiError) Append(err error) {
+	if err != nil {
+		e.Errors = append(e.Errors, err)
+	}
+}
+
+// ErrorOrNil returns e if it holds any errors and nil otherwise, so it can
+// be returned directly as an error.
+func (e *MultiError) ErrorOrNil() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error lists every error on its own indented line under the summary.
+func (e *MultiError) Error() string {
+	summary := e.Summary
+	if summary == "" {
+		summary = fmt.Sprintf("%d errors", len(e.Errors))
+		if len(e.Errors) == 1 {
+			summary = "1 error"
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(summary)
+	sb.WriteString(":")
+	for _, err := range e.Errors {
+		sb.WriteString("\n  ")
+		sb.WriteString(strings.ReplaceAll(err.Error(), "\n", "\n  "))
+	}
+	return sb.String()
+}
+
+// Unwrap returns the aggregated errors.
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// ErrInvalidMapping matches, with errors.Is, every problem reported by
+// ValidateMappings and LoadMappingsTemplate.
+var ErrInvalidMapping = errors.New("invalid mapping")
+
+// invalidMapping marks a mapping problem as ErrInvalidMapping without
+// changing its message.
+type invalidMapping struct {
+	error
+}
+
+func (e invalidMapping) Is(target error) bool {
+	return target == ErrInvalidMapping
+}
+
+func (e invalidMapping) Unwrap() error {
+	return e.error
+}
+
+// invalidMappings returns errs with each error marked as ErrInvalidMapping,
+// or nil if it holds none.
+func invalidMappings(errs *MultiError) error {
+	for i, err := range errs.Errors {
+		errs.Errors[i] = invalidMapping{err}
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,37 @@
+package generator
+
+// EventKind identifies a step in the lifecycle of a single file.
+type EventKind string
+
+const (
+	EventStarted  EventKind = "started"   // Generate began processing a mapping
+	EventSkipped  EventKind = "skipped"   // Generate skipped a mapping, or Apply a destination that already has its content (see Event.Reason)
+	EventRendered EventKind = "rendered"  // Generate produced a result for a mapping
+	EventPlanned  EventKind = "planned"   // Apply handled a result in dry-run mode
+	EventBackedUp EventKind = "backed-up" // Apply backed up the existing destination
+	EventWritten  EventKind = "written"   // Apply wrote the destination
+	EventFailed   EventKind = "failed"    // Rendering, backing up or writing failed (see Event.Err)
+)
+
+// Event reports progress on a single file during Generate and Apply.
+type Event struct {
+	Kind       EventKind
+	Template   string
+	DestPath   string
+	BackupPath string // Set for EventBackedUp
+	Reason     string // Set for EventSkipped
+	Err        error  // Set for EventFailed
+}
+
+// SetEventHandler registers fn to be called synchronously with each file
+// lifecycle event, e.g. to drive a progress bar. A nil fn disables events.
+func (g *Generator) SetEventHandler(fn func(Event)) {
+	g.onEvent = fn
+}
+
+// emit passes e to the event handler, if any.
+func (g *Generator) emit(e Event) {
+	if g.onEvent != nil {
+		g.onEvent(e)
+	}
+}
@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/nabkey/home-files/pkg/diff"
+)
+
+// explain returns why r is created, updated or left unchanged, for
+// ApplyOptions.Explain: what differs from the destination and, for existing
+// files, why the mapping was rendered rather than skipped as unchanged.
+func (g *Generator) explain(r Result) string {
+	var reason string
+	existing, err := r.ReadExisting()
+	switch {
+	case !r.Exists && r.Crontab:
+		reason = "no crontab is installed"
+	case !r.Exists:
+		reason = "the destination does not exist"
+	case err != nil:
+		reason = "the destination could not be read"
+	case string(existing) == r.Content:
+		reason = "the destination already has the generated content"
+	default:
+		var added, removed int
+		for _, e := range diff.Lines(diff.SplitLines(string(existing)), diff.SplitLines(r.Content)) {
+			switch e.Op {
+			case diff.Insert:
+				added++
+			case diff.Delete:
+				removed++
+			}
+		}
+		reason = fmt.Sprintf("content differs (+%d -%d lines)", added, removed)
+	}
+
+	if !r.Exists {
+		return reason
+	}
+	for _, s := range g.cacheStatuses {
+		if s.DestPath == r.DestPath && !s.Hit {
+			reason += "; not skipped as unchanged: " + s.Reason
+			break
+		}
+	}
+	return reason
+}
@@ -0,0 +1,167 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+
+	"github.com/nabkey/home-files/pkg/remote"
+)
+
+// maxIncludeSize is the largest file the include function will read.
+const maxIncludeSize = 1 << 20 // 1 MiB
+
+// builtinFuncs names the functions the generator provides itself, which
+// cannot be replaced with RegisterFunc.
+var builtinFuncs = map[string]bool{
+	"include":  true,
+	"banner":   true,
+	"xdg":      true,
+	"rendered": true,
+	"fetch":    true,
+}
+
+var (
+	customFuncsMu sync.RWMutex
+	customFuncs   = template.FuncMap{}
+)
+
+// RegisterFunc makes fn available to every template as name. fn must be a
+// function returning one value, or a value and an error, as required by
+// text/template. Registering a name twice or shadowing a built-in function
+// is an error. fn may be called concurrently unless SetParallel(1) is used.
+func RegisterFunc(name string, fn any) error {
+	if !validFuncName(name) {
+		return fmt.Errorf("invalid template function name %q", name)
+	}
+	if builtinFuncs[name] {
+		return fmt.Errorf("template function %q is built in and cannot be replaced", name)
+	}
+	if err := checkFuncSignature(fn); err != nil {
+		return fmt.Errorf("template function %q: %w", name, err)
+	}
+
+	customFuncsMu.Lock()
+	defer customFuncsMu.Unlock()
+	if _, exists := customFuncs[name]; exists {
+		return fmt.Errorf("template function %q is already registered", name)
+	}
+	customFuncs[name] = fn
+	return nil
+}
+
+// funcMap returns the functions available to templates rendered for m.
+func (g *Generator) funcMap(m *Mapping) template.FuncMap {
+	funcs := template.FuncMap{}
+
+	customFuncsMu.RLock()
+	for name, fn := range customFuncs {
+		funcs[name] = fn
+	}
+	customFuncsMu.RUnlock()
+
+	funcs["include"] = g.include
+	funcs["banner"] = func(extra ...string) string { return banner(m, extra...) }
+	funcs["xdg"] = g.ctx.XDG
+	funcs["fetch"] = g.fetcher.Fetch
+	funcs["rendered"] = func(dest string) (string, error) { return g.rendered(m, dest) }
+	return funcs
+}
+
+// validFuncName reports whether name is a valid template identifier.
+func validFuncName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFuncSignature reports whether fn can be called from a template.
+func checkFuncSignature(fn any) error {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return fmt.Errorf("not a function (got %T)", fn)
+	}
+	if reflect.ValueOf(fn).IsNil() {
+		return fmt.Errorf("function is nil")
+	}
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	switch t.NumOut() {
+	case 1:
+		return nil
+	case 2:
+		if t.Out(1) == errorType {
+			return nil
+		}
+		return fmt.Errorf("second return value must be error, got %s", t.Out(1))
+	default:
+		return fmt.Errorf("must return one value, or a value and an error (returns %d values)", t.NumOut())
+	}
+}
+
+// SetFetcher configures how the fetch template function downloads and
+// caches documents. The default caches them for remote.DefaultTTL.
+func (g *Generator) SetFetcher(f remote.Fetcher) {
+	g.fetcher = f
+}
+
+// include returns the contents of a file relative to the include directory.
+// Paths escaping the include directory (including via symlinks) and files
+// larger than maxIncludeSize are rejected.
+func (g *Generator) include(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("include %q: path must be relative to %s", path, g.includeDir)
+	}
+
+	if !withinDir(g.includeDir, filepath.Join(g.includeDir, path)) {
+		return "", fmt.Errorf("include %q: path escapes %s", path, g.includeDir)
+	}
+
+	base, err := filepath.EvalSymlinks(g.includeDir)
+	if err != nil {
+		return "", fmt.Errorf("include %q: %w", path, err)
+	}
+
+	full, err := filepath.EvalSymlinks(filepath.Join(base, path))
+	if err != nil {
+		return "", fmt.Errorf("include %q: %w", path, err)
+	}
+
+	if !withinDir(base, full) {
+		return "", fmt.Errorf("include %q: path escapes %s", path, g.includeDir)
+	}
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return "", fmt.Errorf("include %q: %w", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("include %q: is a directory", path)
+	}
+	if info.Size() > maxIncludeSize {
+		return "", fmt.Errorf("include %q: file is %d bytes, exceeds limit of %d", path, info.Size(), maxIncludeSize)
+	}
+
+	content, err := os.ReadFile(full)
+	if err != nil {
+		return "", fmt.Errorf("include %q: %w", path, err)
+	}
+	return string(content), nil
+}
+
+// withinDir reports whether path is dir or lies beneath it.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
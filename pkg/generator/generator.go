@@ -2,110 +2,778 @@ package generator
 
 import (
 	"bytes"
-	"embed"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
 	"os"
+	"os/exec"
+	"os/user"
+	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"text/template"
+
+	"github.com/nabkey/home-files/pkg/manifest"
+	"github.com/nabkey/home-files/pkg/owner"
+	"github.com/nabkey/home-files/pkg/remote"
 )
 
 // Generator handles template rendering and file generation.
 type Generator struct {
-	templates embed.FS
-	ctx       *Context
-	verbose   bool
+	templates  fs.FS
+	ctx        *Context
+	verbose    bool
+	includeDir string         // Base directory for the include template function
+	owner      *owner.Owner   // Owner assigned to written files, nil to leave as-is
+	out        io.Writer      // Destination for human-readable progress output
+	only       []string       // Glob patterns restricting which mappings are generated
+	warnings   []string       // Non-fatal problems found by the last Generate call
+	skipped    []Skip         // Mappings skipped by the last Generate call
+	positions  map[string]int // Destinations of the last Generate call, by index in mapping order
+	lockDiffs  []string       // Differences between a locked context and the detected one
+	failures   []Failure      // Results skipped after errors by the last Apply call
+	maxSize    int64          // Largest template or existing destination handled, 0 for no limit
+	parallel   int            // Maximum number of mappings generated concurrently
+	onEvent    func(Event)    // Receives per-file progress events, nil to disable
+	ext        string         // Suffix of files rendered as templates, e.g. ".tmpl"
+	header     string         // Template text prepended to generated files as comments
+	footer     string         // Template text appended to generated files as comments
+	profile    string         // Profile whose values overlays LoadValues loads
+	mappings   []Mapping      // Mappings to process, nil for FileMappings (see LoadMappingsTemplate)
+
+	deps    map[string][]string // Destinations each mapping references with rendered, by destination
+	outputs map[string]string   // Content generated for referenced mappings, by destination
+
+	cache         *manifest.Manifest // Last run's manifest for change detection, nil to render everything
+	cacheStatuses []CacheStatus      // Change-detection decisions of the last Generate call
+
+	ignoreRequires bool      // Generate mappings even when their required binary is missing
+	ignoreExisting bool      // Render as if no destination existed yet
+	normalize      Normalize // Formatting transforms applied to rendered content
+
+	fetcher remote.Fetcher // Downloads and caches documents for the fetch template function
+}
+
+// Skip records a mapping that Generate did not produce a result for.
+type Skip struct {
+	Mapping   Mapping
+	DestPath  string
+	Reason    string
+	Unchanged bool // Skipped by change detection (see SetCache) rather than a problem
 }
 
-// New creates a new Generator with the given embedded templates.
-func New(templates embed.FS, verbose bool) (*Generator, error) {
+// New creates a new Generator rendering the templates in the given FS, which
+// holds them under a top-level "templates" directory.
+func New(templates fs.FS, verbose bool) (*Generator, error) {
 	ctx, err := NewContext()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create context: %w", err)
 	}
 
 	return &Generator{
-		templates: templates,
-		ctx:       ctx,
-		verbose:   verbose,
+		templates:  templates,
+		ctx:        ctx,
+		verbose:    verbose,
+		includeDir: ctx.Home,
+		out:        os.Stdout,
+		maxSize:    DefaultMaxFileSize,
+		parallel:   DefaultParallel(),
+		ext:        DefaultTemplateExt,
+		fetcher:    remote.Fetcher{TTL: remote.DefaultTTL},
 	}, nil
 }
 
+// templateData is what mapping templates are executed with: the context
+// plus the content of the destination before this run.
+type templateData struct {
+	*Context
+	Existing string // Current destination content, empty if it does not exist
+}
+
+// readExisting returns the current content of a mapping's destination, or
+// of the installed crontab, and whether it exists.
+func (g *Generator) readExisting(m Mapping, destPath string) (string, bool, error) {
+	if g.ignoreExisting {
+		return "", false, nil
+	}
+	if m.Crontab {
+		return readCrontab()
+	}
+	data, err := os.ReadFile(destPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", destPath, err)
+	}
+	return string(data), true, nil
+}
+
 // Result represents the result of processing a single file.
 type Result struct {
 	TemplatePath string
 	DestPath     string
 	Content      string
 	Exists       bool
+	DirMode      os.FileMode // Permissions for parent directories created on write
+	Crontab      bool        // Installed as the user's crontab rather than written to DestPath
+	InputHash    string      // Hash of the render input, recorded for change detection; empty if not cacheable
+	Sensitive    bool        // Content is redacted from previews and diffs (see Preview)
+	Unit         string      // systemd user unit the destination belongs to, reloaded by ReloadSystemd
+
+	systemdEnable, systemdRestart bool
 }
 
-// Generate processes all templates and returns the results.
+// Generate processes all templates and returns the results. Mappings are
+// rendered by up to SetParallel workers, but results, skips, warnings and
+// events are always reported in mapping order. If any mapping fails, the
+// others are still processed and a *MultiError with every failure is
+// returned.
 func (g *Generator) Generate() ([]Result, error) {
+	if err := ValidateMappings(g.Mappings()); err != nil {
+		return nil, err
+	}
+
+	g.warnings = nil
+	g.skipped = nil
+	g.positions = map[string]int{}
+	g.cacheStatuses = nil
+	for _, d := range g.lockDiffs {
+		g.warnf("locked context %s", d)
+	}
+	g.warnXDGOutsideHome(g.Mappings())
+
+	selected := g.selectMappings(g.Mappings())
 	var results []Result
+	errs := &MultiError{}
+
+	// collect reports the outcome of a mapping
+	collect := func(m Mapping, o outcome) {
+		g.positions[o.destPath] = len(g.positions)
+		g.emit(Event{Kind: EventStarted, Template: m.Template, DestPath: o.destPath})
+		g.warnings = append(g.warnings, o.warnings...)
+		if o.cache != nil {
+			g.cacheStatuses = append(g.cacheStatuses, *o.cache)
+		}
+		switch {
+		case o.err != nil:
+			errs.Append(o.err)
+			g.emit(Event{Kind: EventFailed, Template: m.Template, DestPath: o.destPath, Err: o.err})
+		case o.skip != nil:
+			g.skip(*o.skip)
+		default:
+			results = append(results, *o.result)
+			g.emit(Event{Kind: EventRendered, Template: m.Template, DestPath: o.destPath})
+		}
+	}
 
-	for templatePath, destRelPath := range FileMappings {
-		content, err := g.templates.ReadFile(templatePath)
+	// Mappings referenced with rendered are generated first, even when not
+	// selected, and their own references before them
+	waves, err := g.renderWaves(selected)
+	if err != nil {
+		return nil, err
+	}
+	g.outputs = nil
+	if len(waves) > 1 {
+		outcomes := g.generateWaves(waves)
+		for _, m := range selected {
+			collect(m, outcomes[m.destKey()])
+		}
+		return g.generated(results, errs)
+	}
+
+	if min(g.parallel, len(selected)) <= 1 {
+		for _, m := range selected {
+			collect(m, g.generateMapping(m))
+		}
+		return g.generated(results, errs)
+	}
+	for i, o := range g.generateConcurrently(selected) {
+		collect(selected[i], o)
+	}
+	return g.generated(results, errs)
+}
+
+// generateConcurrently generates the mappings with up to SetParallel
+// workers and returns their outcomes in the same order.
+func (g *Generator) generateConcurrently(ms []Mapping) []outcome {
+	outcomes := make([]outcome, len(ms))
+	workers := min(g.parallel, len(ms))
+	if workers <= 1 {
+		for i, m := range ms {
+			outcomes[i] = g.generateMapping(m)
+		}
+		return outcomes
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				outcomes[i] = g.generateMapping(ms[i])
+			}
+		}()
+	}
+	for i := range ms {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return outcomes
+}
+
+// generated returns the results of Generate, or errs if any mapping failed.
+func (g *Generator) generated(results []Result, errs *MultiError) ([]Result, error) {
+	if len(errs.Errors) > 0 {
+		errs.Summary = fmt.Sprintf("%d of %d templates failed", len(errs.Errors), len(errs.Errors)+len(results)+len(g.skipped))
+		return nil, errs
+	}
+	return results, nil
+}
+
+// outcome is what Generate produced for a single mapping: a result, a skip
+// or an error, plus any warnings.
+type outcome struct {
+	destPath string
+	result   *Result
+	skip     *Skip
+	cache    *CacheStatus
+	warnings []string
+	err      error
+}
+
+// generateMapping renders a mapping and combines it with its destination.
+// It only reads generator state, so mappings can be generated concurrently.
+func (g *Generator) generateMapping(m Mapping) outcome {
+	destPath := g.DestPath(m)
+	o := outcome{destPath: destPath}
+
+	if m.Requires != "" && !g.ignoreRequires {
+		if _, err := exec.LookPath(m.Requires); err != nil {
+			o.skip = &Skip{
+				Mapping:  m,
+				DestPath: destPath,
+				Reason:   fmt.Sprintf("requires %s, not found", m.Requires),
+			}
+			return o
+		}
+	}
+
+	// A template missing from every layer skips the mapping rather than
+	// failing the run, so partial template directories stay usable
+	for _, templatePath := range m.Templates() {
+		if _, err := fs.Stat(g.templates, templatePath); errors.Is(err, fs.ErrNotExist) {
+			o.warnings = append(o.warnings, g.missingTemplate(templatePath, destPath))
+			o.skip = &Skip{Mapping: m, DestPath: destPath, Reason: fmt.Sprintf("template %s not found", templatePath)}
+			return o
+		}
+	}
+
+	var inputHash string
+	if !m.Crontab {
+		status, err := g.checkCache(m, destPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read template %s: %w", templatePath, err)
+			o.err = err
+			return o
+		}
+		o.cache = &status
+		if status.Hit {
+			o.skip = &Skip{Mapping: m, DestPath: destPath, Reason: "unchanged since last run", Unchanged: true}
+			return o
 		}
+		inputHash = status.Input
+	}
 
-		rendered, err := g.renderTemplate(templatePath, string(content))
+	if !m.Crontab && !g.ignoreExisting {
+		if info, err := os.Stat(destPath); err == nil && g.maxSize > 0 && info.Mode().IsRegular() && info.Size() > g.maxSize {
+			reason := fmt.Sprintf("existing file is %d bytes, exceeds --max-file-size of %d", info.Size(), g.maxSize)
+			o.warnings = append(o.warnings, fmt.Sprintf("skipping %s: %s", destPath, reason))
+			o.skip = &Skip{Mapping: m, DestPath: destPath, Reason: reason}
+			return o
+		}
+		if info, err := os.Lstat(destPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			o.warnings = append(o.warnings, fmt.Sprintf("destination %s is a symlink; writing replaces the content of its target", destPath))
+		}
+	}
+
+	// The destination is read once, before rendering, so .Existing and
+	// merging both see the content from before this run
+	existing, exists, err := g.readExisting(m, destPath)
+	if err != nil {
+		o.err = err
+		return o
+	}
+	rendered, warnings, err := g.renderMapping(m, existing)
+	o.warnings = append(o.warnings, warnings...)
+	if err != nil {
+		o.err = err
+		return o
+	}
+	if m.Crontab {
+		return g.generateCrontab(m, o, rendered)
+	}
+
+	rendered, err = applyMode(m, existing, rendered)
+	if err != nil {
+		o.err = err
+		return o
+	}
+	// Line endings are converted after merging so the whole file is consistent
+	if m.CRLF || g.normalize.CRLF {
+		rendered = Normalize{CRLF: true}.Apply(rendered)
+	}
+	// Encoding runs last since every earlier step works on UTF-8 text
+	rendered, err = encode(rendered, m.Encoding)
+	if err != nil {
+		o.err = fmt.Errorf("failed to encode %s: %w", m.Template, err)
+		return o
+	}
+
+	o.result = &Result{
+		TemplatePath: m.Template,
+		DestPath:     destPath,
+		Content:      rendered,
+		Exists:       exists,
+		DirMode:      m.dirMode(),
+		InputHash:    inputHash,
+		Sensitive:    m.sensitive(),
+		Unit:         systemdUnit(m.Destination()),
+
+		systemdEnable:  m.SystemdEnable,
+		systemdRestart: m.SystemdRestart,
+	}
+	return o
+}
+
+// skip records a mapping that Generate did not produce a result for.
+func (g *Generator) skip(s Skip) {
+	g.skipped = append(g.skipped, s)
+	g.emit(Event{Kind: EventSkipped, Template: s.Mapping.Template, DestPath: s.DestPath, Reason: s.Reason})
+}
+
+// missingTemplate returns the warning for a mapping skipped because its
+// template is in none of the template layers.
+func (g *Generator) missingTemplate(templatePath, destPath string) string {
+	if o, ok := g.templates.(overlayFS); ok && o.labels() != "" {
+		return fmt.Sprintf("template %s not found in %s; skipping %s", templatePath, o.labels(), destPath)
+	}
+	return fmt.Sprintf("template %s not found; skipping %s", templatePath, destPath)
+}
+
+// templateOrigin returns where a template is read from when the templates
+// are an Overlay of labeled layers, e.g. " (from built-in templates)", or "".
+func (g *Generator) templateOrigin(templatePath string) string {
+	if o, ok := g.templates.(overlayFS); ok {
+		if label := o.origin(templatePath); label != "" {
+			return " (from " + label + ")"
+		}
+	}
+	return ""
+}
+
+// readTemplate reads a template from the templates FS. Templates with a .gz
+// suffix are decompressed and returned under their name without the suffix,
+// so "config.tmpl.gz" is rendered as "config.tmpl".
+func (g *Generator) readTemplate(templatePath string) (string, []byte, error) {
+	if info, err := fs.Stat(g.templates, templatePath); err == nil && g.maxSize > 0 && info.Size() > g.maxSize {
+		return "", nil, fmt.Errorf("template %s is %d bytes, exceeds --max-file-size of %d", templatePath, info.Size(), g.maxSize)
+	}
+
+	content, err := fs.ReadFile(g.templates, templatePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read template %s: %w", templatePath, err)
+	}
+
+	if !strings.HasSuffix(templatePath, ".gz") {
+		return templatePath, content, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decompress template %s: %w", templatePath, err)
+	}
+	defer zr.Close()
+
+	var r io.Reader = zr
+	if g.maxSize > 0 {
+		r = io.LimitReader(zr, g.maxSize+1)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decompress template %s: %w", templatePath, err)
+	}
+	if g.maxSize > 0 && int64(len(decompressed)) > g.maxSize {
+		return "", nil, fmt.Errorf("template %s decompresses to more than --max-file-size of %d bytes", templatePath, g.maxSize)
+	}
+
+	return strings.TrimSuffix(templatePath, ".gz"), decompressed, nil
+}
+
+// renderMapping renders the mapping's templates, with existing as the
+// destination's current content, concatenates them, and applies annotation
+// stripping, the header and footer, and normalization, without touching the
+// destination. It returns warnings rather than recording them so it is safe
+// to call concurrently.
+func (g *Generator) renderMapping(m Mapping, existing string) (string, []string, error) {
+	var warnings []string
+	parts := make([]string, 0, 1+len(m.Fragments))
+	for _, templatePath := range m.Templates() {
+		name, content, err := g.readTemplate(templatePath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to render template %s: %w", templatePath, err)
+			return "", nil, err
 		}
 
-		destPath := filepath.Join(g.ctx.Home, destRelPath)
+		part, err := g.renderTemplate(&m, name, string(content), existing)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to render template %s: %w", templatePath, err)
+		}
+		if part != string(content) && strings.Contains(part, missingValue) {
+			warnings = append(warnings, fmt.Sprintf("template %s references a value that is not set", templatePath))
+		}
+		parts = append(parts, part)
+	}
+	rendered := strings.Join(parts, m.Separator)
 
-		exists := false
-		if _, err := os.Stat(destPath); err == nil {
-			exists = true
+	if m.StripAnnotations {
+		prefix := m.StripPrefix
+		if prefix == "" {
+			prefix = m.annotationPrefix()
 		}
+		rendered = stripLines(rendered, prefix)
+	}
+	rendered, err := g.stamp(&m, rendered)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return g.normalize.Apply(rendered), warnings, nil
+}
 
-		results = append(results, Result{
-			TemplatePath: templatePath,
-			DestPath:     destPath,
-			Content:      rendered,
-			Exists:       exists,
-		})
+// Render renders a single template by path within the templates FS and
+// returns the content, without touching any destination. The template's
+// mapping options are used if it is in Mappings; otherwise it is rendered
+// by the template extension convention. Destinations it references with
+// rendered are rendered for it first.
+func (g *Generator) Render(templatePath string) (string, error) {
+	g.warnings = nil
+
+	base := strings.TrimSuffix(path.Base(templatePath), ".gz")
+	m := Mapping{Template: templatePath, Dest: strings.TrimSuffix(base, g.ext)}
+	var existing string
+	for _, fm := range g.Mappings() {
+		if fm.Template == templatePath {
+			m = fm
+			var err error
+			if existing, _, err = g.readExisting(m, g.DestPath(m)); err != nil {
+				return "", err
+			}
+			break
+		}
+	}
+	if err := g.renderDependencies(m); err != nil {
+		return "", err
 	}
+	rendered, warnings, err := g.renderMapping(m, existing)
+	g.warnings = append(g.warnings, warnings...)
+	return rendered, err
+}
 
-	return results, nil
+// GenerateOne generates the mapping for a single destination (see Which)
+// as Generate would and returns its result, whose content is what would be
+// written, merged with the existing file for merge and block mappings. A
+// mapping that Generate would skip, e.g. for a missing required binary, is
+// an error.
+func (g *Generator) GenerateOne(dest string) (Result, error) {
+	m, err := g.Which(dest)
+	if err != nil {
+		return Result{}, err
+	}
+
+	g.warnings = nil
+	if err := g.generateDependencies(m); err != nil {
+		return Result{}, err
+	}
+	o := g.generateMapping(m)
+	g.warnings = append(g.warnings, o.warnings...)
+	switch {
+	case o.err != nil:
+		return Result{}, o.err
+	case o.skip != nil:
+		return Result{}, fmt.Errorf("skipped %s: %s", o.destPath, o.skip.Reason)
+	}
+	return *o.result, nil
 }
 
-// renderTemplate processes a template string with the context.
-func (g *Generator) renderTemplate(name, content string) (string, error) {
-	// Only process .tmpl files as templates
-	if !strings.HasSuffix(name, ".tmpl") {
+// applyMode combines rendered content with the existing destination content
+// (empty if there is none) according to the mapping's mode.
+func applyMode(m Mapping, existing, rendered string) (string, error) {
+	switch m.Mode {
+	case ModeOverwrite:
+		return rendered, nil
+	case ModeMerge:
+		return mergeINI(existing, rendered), nil
+	case ModeBlock:
+		content, err := insertBlockContent(existing, rendered, m.Block, m.commentPrefix())
+		if err != nil {
+			target := m.Destination()
+			if m.Crontab {
+				target = "the crontab"
+			}
+			return "", fmt.Errorf("failed to update the homestruct block in %s: %w", target, err)
+		}
+		return content, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q for template %s", m.Mode, m.Template)
+	}
+}
+
+// renderTemplate processes a template string for mapping m with the context
+// and the destination's existing content, using the mapping's engine.
+// m.Render overrides the template extension convention.
+func (g *Generator) renderTemplate(m *Mapping, name, content, existing string) (string, error) {
+	if !m.renders(name, g.ext) {
 		return content, nil
 	}
 
-	tmpl, err := template.New(name).Parse(content)
+	var tmpl interface {
+		Execute(io.Writer, any) error
+	}
+	var err error
+	if m.engine(name, g.ext) == EngineHTML {
+		tmpl, err = htmltemplate.New(name).Funcs(htmltemplate.FuncMap(g.funcMap(m))).Parse(content)
+	} else {
+		tmpl, err = template.New(name).Funcs(g.funcMap(m)).Parse(content)
+	}
 	if err != nil {
-		return "", err
+		return "", withSourceContext(name, content, err)
 	}
 
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, g.ctx); err != nil {
-		return "", err
+	if err := tmpl.Execute(&buf, templateData{Context: g.ctx, Existing: existing}); err != nil {
+		return "", withSourceContext(name, content, err)
 	}
 
 	return buf.String(), nil
 }
 
-// WriteFile writes a result to disk, creating directories as needed.
+// WriteFile writes a result to disk with Result.FileMode, creating
+// directories as needed.
 func (g *Generator) WriteFile(r Result) error {
+	if r.Crontab {
+		return installCrontab(r.Content)
+	}
+
+	dirMode := r.DirMode
+	if dirMode == 0 {
+		dirMode = defaultDirMode
+	}
+
 	dir := filepath.Dir(r.DestPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := g.owner.MkdirAll(dir, dirMode); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return permissionError(dir, err)
+		}
 		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
-	if err := os.WriteFile(r.DestPath, []byte(r.Content), 0644); err != nil {
+	if err := os.WriteFile(r.DestPath, []byte(r.Content), r.FileMode()); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return permissionError(r.DestPath, err)
+		}
 		return fmt.Errorf("failed to write file %s: %w", r.DestPath, err)
 	}
+	// An existing file keeps its permissions, which may let others read it
+	if r.Sensitive {
+		if err := os.Chmod(r.DestPath, r.FileMode()); err != nil {
+			return fmt.Errorf("failed to restrict permissions of %s: %w", r.DestPath, err)
+		}
+	}
+
+	return g.owner.Chown(r.DestPath)
+}
+
+// permissionError adds a hint on resolving a permission-denied error for path.
+func permissionError(path string, err error) error {
+	return fmt.Errorf("failed to write file %s: %w (check the ownership and permissions of the file and its parent "+
+		"directory, or run with the privileges of the home's owner, e.g. sudo with --chown)", path, err)
+}
+
+// Which returns the mapping that generates the given destination. The
+// destination may be absolute, "~/"-prefixed, or relative to home. If no
+// mapping generates it, the error wraps ErrNoMapping.
+func (g *Generator) Which(dest string) (Mapping, error) {
+	rel, err := relativeDest(g.ctx.Home, dest)
+	if err != nil {
+		return Mapping{}, err
+	}
 
+	for _, m := range g.Mappings() {
+		if m.destKey() == rel {
+			return m, nil
+		}
+	}
+	return Mapping{}, fmt.Errorf("%w for %s", ErrNoMapping, dest)
+}
+
+// Resolve returns the mapping that renders the given template path (as
+// listed in Mappings, e.g. "templates/zsh/.zshrc.tmpl"), either as its
+// Template or as one of its Fragments. If none does, the error wraps
+// ErrNoMapping.
+func (g *Generator) Resolve(templatePath string) (Mapping, error) {
+	for _, m := range g.Mappings() {
+		if slices.Contains(m.Templates(), templatePath) {
+			return m, nil
+		}
+	}
+	return Mapping{}, fmt.Errorf("%w for template %s", ErrNoMapping, templatePath)
+}
+
+// DestPath returns the absolute destination path a mapping is written to.
+func (g *Generator) DestPath(m Mapping) string {
+	if m.Crontab {
+		return CrontabDest
+	}
+	return filepath.Join(g.ctx.Home, m.Destination())
+}
+
+// SetContext replaces the detected context, e.g. with one loaded from a
+// lockfile. Fields that differ from the detected context are reported as
+// warnings by Generate. The include directory follows the new home unless
+// set explicitly.
+func (g *Generator) SetContext(ctx *Context) {
+	g.lockDiffs = ctx.Mismatches(g.ctx)
+	if g.includeDir == g.ctx.Home {
+		g.includeDir = ctx.Home
+	}
+	g.ctx = ctx
+}
+
+// DefaultParallel returns the default number of mappings generated
+// concurrently: the CPU count, capped at 4 since templates are small and
+// rendering is mostly I/O bound.
+func DefaultParallel() int {
+	return min(4, runtime.NumCPU())
+}
+
+// SetParallel caps how many mappings Generate renders concurrently. Values
+// below 2 render serially, which makes event timing and custom template
+// function calls fully sequential. Output order never depends on it.
+func (g *Generator) SetParallel(n int) {
+	g.parallel = n
+}
+
+// SetTemplateExt sets the suffix marking files that are rendered as templates
+// (default ".tmpl"), e.g. ".gotmpl" or ".tpl". Other files are copied
+// verbatim unless their mapping sets Render.
+func (g *Generator) SetTemplateExt(ext string) error {
+	ext, err := ParseTemplateExt(ext)
+	if err != nil {
+		return err
+	}
+	g.ext = ext
 	return nil
 }
 
+// ParseTemplateExt validates a template extension, adding the leading dot if
+// it is missing.
+func ParseTemplateExt(ext string) (string, error) {
+	if ext != "" && ext[0] != '.' {
+		ext = "." + ext
+	}
+	if len(ext) < 2 || strings.ContainsAny(ext, "/\\") || strings.Count(ext, ".") != 1 {
+		return "", fmt.Errorf("invalid template extension %q", ext)
+	}
+	return ext, nil
+}
+
+// TemplateExt returns the suffix marking files that are rendered as templates.
+func (g *Generator) TemplateExt() string {
+	return g.ext
+}
+
+// SetMaxFileSize limits the size of templates (after decompression) and of
+// existing destinations that are read, merged or backed up. Oversized
+// templates fail generation; oversized destinations are skipped with a
+// warning. Zero disables the limit.
+func (g *Generator) SetMaxFileSize(n int64) {
+	g.maxSize = n
+}
+
+// SetHome sets the target home directory that destinations are written
+// under. The include directory follows it unless set explicitly.
+func (g *Generator) SetHome(home string) {
+	if g.includeDir == g.ctx.Home {
+		g.includeDir = home
+	}
+	g.ctx.Home = home
+	// The process's XDG variables belong to the current user's home
+	g.ctx.resolveXDG(nil, false)
+}
+
+// SetUser targets another user's account: the home directory, User, Group,
+// Shell and the HOME, USER and LOGNAME environment values come from u.
+func (g *Generator) SetUser(u *user.User) {
+	g.SetHome(u.HomeDir)
+	g.ctx.User = username(u)
+	g.ctx.Group = groupName(u)
+	g.ctx.Shell = loginShell(g.ctx.User)
+	for _, key := range []string{"USER", "LOGNAME"} {
+		if _, ok := g.ctx.Env[key]; ok {
+			g.ctx.Env[key] = g.ctx.User
+		}
+	}
+	g.ctx.Env["HOME"] = u.HomeDir
+}
+
+// SetIncludeDir sets the base directory that the include template function
+// reads from. It defaults to the home directory.
+func (g *Generator) SetIncludeDir(dir string) {
+	g.includeDir = dir
+}
+
+// Skipped returns the mappings skipped by the last call to Generate.
+func (g *Generator) Skipped() []Skip {
+	return g.skipped
+}
+
+// SetIgnoreRequires generates mappings even when their required binary is missing.
+func (g *Generator) SetIgnoreRequires(ignore bool) {
+	g.ignoreRequires = ignore
+}
+
+// SetIgnoreExisting renders every mapping as if its destination (and the
+// crontab) did not exist, so output depends only on the templates and the
+// context. Combine with a nil cache.
+func (g *Generator) SetIgnoreExisting(ignore bool) {
+	g.ignoreExisting = ignore
+}
+
+// SetNormalize sets the formatting transforms applied to rendered content
+// before it is combined with the destination. Off by default.
+func (g *Generator) SetNormalize(n Normalize) {
+	g.normalize = n
+}
+
+// SetOutput sets where human-readable progress output is written.
+// It defaults to os.Stdout; use io.Discard to silence it.
+func (g *Generator) SetOutput(w io.Writer) {
+	g.out = w
+}
+
+// SetOwner assigns written files and the directories created for them to o.
+func (g *Generator) SetOwner(o *owner.Owner) {
+	g.owner = o
+}
+
 // Context returns the generator's context.
 func (g *Generator) Context() *Context {
 	return g.ctx
@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// gzipped returns s compressed with gzip.
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestGenerator returns a generator for templates with a fixed context
+// whose home is a temporary directory.
+func newTestGenerator(t *testing.T, templates fstest.MapFS) *Generator {
+	t.Helper()
+	g, err := New(templates, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetContext(&Context{OS: "linux", Arch: "amd64", Home: t.TempDir(), User: "alice"})
+	return g
+}
+
+func TestReadTemplateGzip(t *testing.T) {
+	templates := fstest.MapFS{
+		"templates/motd.tmpl.gz":   {Data: gzipped(t, "Hello {{ .User }} on {{ .OS }}\n")},
+		"templates/plain.conf.gz":  {Data: gzipped(t, "kept {{ .User }}\n")},
+		"templates/big.tmpl.gz":    {Data: gzipped(t, strings.Repeat("x", 100))},
+		"templates/broken.tmpl.gz": {Data: []byte("not gzip")},
+	}
+
+	tests := []struct {
+		path     string
+		maxSize  int64
+		wantName string
+		want     string // Rendered content
+		wantErr  string // Substring of the expected error, "" for none
+	}{
+		{path: "templates/motd.tmpl.gz", wantName: "templates/motd.tmpl", want: "Hello alice on linux\n"},
+		{path: "templates/plain.conf.gz", wantName: "templates/plain.conf", want: "kept {{ .User }}\n"},
+		{path: "templates/big.tmpl.gz", maxSize: 100, wantName: "templates/big.tmpl", want: strings.Repeat("x", 100)},
+		{path: "templates/big.tmpl.gz", maxSize: 99, wantErr: "decompresses to more than --max-file-size of 99 bytes"},
+		{path: "templates/broken.tmpl.gz", wantErr: "failed to decompress template templates/broken.tmpl.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			g := newTestGenerator(t, templates)
+			g.SetMaxFileSize(tt.maxSize)
+
+			name, _, err := g.readTemplate(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readTemplate error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readTemplate: %v", err)
+			}
+			if name != tt.wantName {
+				t.Errorf("readTemplate name = %q, want %q", name, tt.wantName)
+			}
+
+			got, err := g.Render(tt.path)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions")
+	}
+	g := newTestGenerator(t, fstest.MapFS{})
+	home := g.ctx.Home
+
+	// An existing credential file readable by others is tightened
+	netrc := filepath.Join(home, ".netrc")
+	if err := os.WriteFile(netrc, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		result Result
+		want   os.FileMode
+	}{
+		{Result{DestPath: filepath.Join(home, ".zshrc"), Content: "zsh\n"}, 0644},
+		{Result{DestPath: netrc, Content: "machine example.com\n", Sensitive: true}, 0600},
+		{Result{DestPath: filepath.Join(home, ".ssh", "config"), Content: "Host *\n", Sensitive: true}, 0600},
+	}
+	for _, tt := range tests {
+		if err := g.WriteFile(tt.result); err != nil {
+			t.Fatalf("WriteFile(%s): %v", tt.result.DestPath, err)
+		}
+		info, err := os.Stat(tt.result.DestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The umask may clear more bits, but never sets any
+		if got := info.Mode().Perm(); got&^tt.want != 0 {
+			t.Errorf("%s has mode %o, want at most %o", filepath.Base(tt.result.DestPath), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// Edited returns the results that would overwrite a file edited outside
+// homestruct: the destination no longer matches the hash man recorded when
+// it was last written, and differs from the new content. Files man does not
+// list, and merge and block mappings, which keep edits outside the parts
+// they manage, are never reported.
+func (g *Generator) Edited(results []Result, man *manifest.Manifest) ([]Result, error) {
+	modes := make(map[string]Mode)
+	for _, m := range g.Mappings() {
+		modes[g.DestPath(m)] = m.Mode
+	}
+
+	var edited []Result
+	for _, r := range results {
+		if r.Crontab || !r.Exists || modes[r.DestPath] != ModeOverwrite {
+			continue
+		}
+		rel, err := filepath.Rel(g.ctx.Home, r.DestPath)
+		if err != nil {
+			continue
+		}
+		entry, ok := man.Files[filepath.ToSlash(rel)]
+		if !ok {
+			continue
+		}
+
+		data, err := r.ReadExisting()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s for local edits: %w", r.DestPath, err)
+		}
+		if manifest.Hash(data) != entry.SHA256 && string(data) != r.Content {
+			edited = append(edited, r)
+		}
+	}
+	return edited, nil
+}
@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"strings"
+)
+
+// LintIssue is a formatting problem found in rendered content.
+type LintIssue struct {
+	Line    int // 1-based line number
+	Message string
+	Fixable bool // Whether FixLint resolves the issue
+}
+
+// Lint checks rendered content for trailing whitespace, mixed tab and space
+// indentation, and a missing final newline.
+func Lint(content string) []LintIssue {
+	if content == "" {
+		return nil
+	}
+
+	var issues []LintIssue
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	// The first indented line sets the expected indentation style
+	var style byte
+	for i, line := range lines {
+		lineNo := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		if trimmed := strings.TrimRight(line, " \t"); trimmed != line {
+			issues = append(issues, LintIssue{Line: lineNo, Message: "trailing whitespace", Fixable: true})
+			line = trimmed
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if indent == "" || indent == line {
+			continue
+		}
+		switch {
+		case strings.Contains(indent, " ") && strings.Contains(indent, "\t"):
+			issues = append(issues, LintIssue{Line: lineNo, Message: "mixed tabs and spaces in indentation"})
+		case style == 0:
+			style = indent[0]
+		case indent[0] != style:
+			issues = append(issues, LintIssue{Line: lineNo, Message: "indented with " + indentName(indent[0]) + ", file uses " + indentName(style)})
+		}
+	}
+
+	if !strings.HasSuffix(content, "\n") {
+		issues = append(issues, LintIssue{Line: len(lines), Message: "missing final newline", Fixable: true})
+	}
+
+	return issues
+}
+
+// FixLint trims trailing whitespace from every line and ensures a final newline.
+// Indentation and line endings are left untouched.
+func FixLint(content string) string {
+	return Normalize{TrimTrailing: true, FinalNewline: true}.Apply(content)
+}
+
+func indentName(c byte) string {
+	if c == '\t' {
+		return "tabs"
+	}
+	return "spaces"
+}
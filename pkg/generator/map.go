@@ -1,21 +1,344 @@
 package generator
 
-// FileMappings maps template paths to their destination paths relative to home directory.
-// Templates with .tmpl extension will have the extension stripped in the output.
-var FileMappings = map[string]string{
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/backup"
+)
+
+// DefaultMaxFileSize is the default limit on template and existing
+// destination sizes (see Generator.SetMaxFileSize).
+const DefaultMaxFileSize = 10 << 20 // 10 MiB
+
+// DefaultTemplateExt is the suffix marking files that are rendered as
+// templates (see Generator.SetTemplateExt).
+const DefaultTemplateExt = ".tmpl"
+
+// ErrNoMapping is returned (wrapped) by lookups such as Generator.Which when
+// no mapping matches the request. Check for it with errors.Is.
+var ErrNoMapping = errors.New("no mapping found")
+
+// Permissions for parent directories created when writing destinations.
+const (
+	defaultDirMode   os.FileMode = 0755
+	sensitiveDirMode os.FileMode = 0700
+)
+
+// PathRoots are named base directories, relative to home, that a mapping's
+// Dest can be relative to by setting Root, so groups of mappings share one
+// layout decision (e.g. Root: "bin" places Dest "backup.sh" at
+// ~/.local/bin/backup.sh). The config, data, state and cache roots are the
+// XDG spec defaults; the generator follows $XDG_CONFIG_HOME etc. instead
+// when they point inside home.
+var PathRoots = map[string]string{
+	"bin":    ".local/bin",
+	"config": ".config",
+	"data":   ".local/share",
+	"state":  ".local/state",
+	"cache":  ".cache",
+}
+
+// sensitiveDirs are directories that tools reject when group or world accessible.
+var sensitiveDirs = map[string]bool{
+	".ssh":   true,
+	".gnupg": true,
+}
+
+// Mode controls how rendered content is applied to an existing destination file.
+type Mode string
+
+const (
+	// ModeOverwrite replaces the whole destination file (the default).
+	ModeOverwrite Mode = ""
+	// ModeMerge merges INI/git-config style content into the destination,
+	// updating only the keys homestruct manages and preserving the rest.
+	ModeMerge Mode = "merge"
+	// ModeBlock inserts or updates a delimited block within the destination,
+	// leaving the rest of the file untouched.
+	ModeBlock Mode = "block"
+)
+
+// Engine selects the template package used to render a mapping.
+type Engine string
+
+const (
+	// EngineText renders with text/template, without escaping (the default
+	// for .tmpl files other than .html.tmpl).
+	EngineText Engine = "text"
+	// EngineHTML renders with html/template, escaping values for their HTML
+	// context (the default for .html.tmpl and .htm.tmpl).
+	EngineHTML Engine = "html"
+)
+
+// Mapping describes how a single template is rendered into the home directory.
+type Mapping struct {
+	Template string // Template path within the embedded FS
+	Dest     string // Destination path relative to home directory (or to Root)
+	Root     string // Name of a PathRoots entry that Dest is relative to; empty for home
+	Mode     Mode   // How the rendered content is applied to the destination
+	Block    string // Optional block name used in the markers (ModeBlock only)
+
+	// Fragments lists further templates rendered after Template, in order,
+	// and concatenated with it into the destination, with Separator between
+	// each. Every fragment is a standalone template with the same context
+	// and mapping options; Template still names the mapping in messages,
+	// the manifest and --only.
+	Fragments []string
+	Separator string
+
+	// Render forces rendering as a template (true) or verbatim copy (false)
+	// regardless of the .tmpl suffix. Nil keeps the suffix convention.
+	Render *bool
+
+	// StripAnnotations removes template annotation lines from the rendered
+	// output. Annotations start with the file's comment syntax followed by
+	// "#homestruct" (e.g. "##homestruct" in shell, "--#homestruct" in Lua)
+	// unless StripPrefix overrides it.
+	StripAnnotations bool
+	StripPrefix      string
+
+	// DirMode sets the permissions of parent directories created for the
+	// destination. Zero uses 0700 under sensitive directories such as .ssh
+	// and .gnupg, and 0755 otherwise.
+	DirMode os.FileMode
+
+	// Requires names a binary that must be on PATH for the mapping to be
+	// generated; otherwise it is skipped. Empty means always generate.
+	Requires string
+
+	// CRLF writes the destination with CRLF line endings, for files read by
+	// Windows tools.
+	CRLF bool
+
+	// Engine forces the template engine. Empty selects html/template for
+	// .html.tmpl and .htm.tmpl templates (with the configured template
+	// extension) and text/template otherwise.
+	Engine Engine
+
+	// CommentPrefix overrides the line comment syntax derived from the
+	// destination's extension (e.g. "//" for .kdl), used by the banner
+	// template function, headers and footers, and annotation stripping.
+	CommentPrefix string
+
+	// NoHeader leaves the file without the header and footer set with
+	// Generator.SetHeader and SetFooter, for formats such as JSON where
+	// comment lines would break parsing.
+	NoHeader bool
+
+	// Encoding converts the rendered UTF-8 content before writing, for files
+	// read by tools that expect a legacy encoding: "latin1" (ISO-8859-1),
+	// "windows-1252" or "ascii". Empty or "utf-8" writes the content as is.
+	Encoding string
+
+	// Crontab installs the rendered content as the user's crontab with
+	// "crontab -" instead of writing a file; Dest is ignored. The current
+	// crontab is backed up first, and ModeBlock keeps hand-written entries.
+	Crontab bool
+
+	// Sensitive redacts the content from dry-run previews, diffs, review
+	// files, bundles and serve, and writes the file readable only by its
+	// owner (0600). Nil selects credential files such as .netrc and
+	// everything under .ssh and .gnupg.
+	Sensitive *bool
+
+	// SystemdEnable and SystemdRestart run "systemctl --user enable" and
+	// "restart" for the unit after it is written (and the user manager has
+	// been reloaded). Only valid for destinations under systemd/user.
+	SystemdEnable  bool
+	SystemdRestart bool
+}
+
+// Templates returns the mapping's templates in the order they are rendered:
+// Template followed by its Fragments.
+func (m Mapping) Templates() []string {
+	return append([]string{m.Template}, m.Fragments...)
+}
+
+// insideBackupDir reports whether a home-relative destination is the backup
+// directory or inside it.
+func insideBackupDir(dest string) bool {
+	first, _, _ := strings.Cut(filepath.ToSlash(filepath.Clean(dest)), "/")
+	return first == backup.DirName
+}
+
+// Destination returns the destination relative to home, with Dest resolved
+// against the mapping's Root.
+func (m Mapping) Destination() string {
+	if m.Root == "" {
+		return m.Dest
+	}
+	return filepath.Join(filepath.FromSlash(PathRoots[m.Root]), m.Dest)
+}
+
+// destKey identifies the mapping's destination for duplicate detection.
+func (m Mapping) destKey() string {
+	if m.Crontab {
+		return CrontabDest
+	}
+	return filepath.Clean(m.Destination())
+}
+
+// renders reports whether the mapping's template is rendered rather than
+// copied as-is, given its name (without any .gz suffix) and the template
+// extension. Only files with the extension are rendered unless m.Render
+// overrides it.
+func (m Mapping) renders(name, ext string) bool {
+	if m.Render != nil {
+		return *m.Render
+	}
+	return strings.HasSuffix(name, ext)
+}
+
+// engine returns the template engine for the mapping, given the template
+// name (without any .gz suffix) and the template extension.
+func (m Mapping) engine(name, ext string) Engine {
+	if m.Engine != "" {
+		return m.Engine
+	}
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".html"+ext) || strings.HasSuffix(lower, ".htm"+ext) {
+		return EngineHTML
+	}
+	return EngineText
+}
+
+// dirMode returns the permissions for parent directories created for the mapping.
+func (m Mapping) dirMode() os.FileMode {
+	if m.DirMode != 0 {
+		return m.DirMode
+	}
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(m.Destination())), "/") {
+		if sensitiveDirs[part] {
+			return sensitiveDirMode
+		}
+	}
+	return defaultDirMode
+}
+
+// Bool returns a pointer to b, for setting optional fields such as Mapping.Render.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// FileMappings lists the built-in mappings in the order they are generated.
+// Each names a template in the templates FS and its destination relative to
+// home or to a path root; templates with the template extension are rendered
+// and others are copied verbatim. A generator adds the mappings loaded with
+// LoadMappingsTemplate after these, so code with a Generator should use its
+// Mappings rather than FileMappings.
+var FileMappings = []Mapping{
 	// Zsh configuration
-	"templates/zsh/.zshrc.tmpl":      ".zshrc",
-	"templates/zsh/aliases.zsh.tmpl": ".config/zsh/aliases.zsh",
+	{Template: "templates/zsh/.zshrc.tmpl", Dest: ".zshrc"},
+	{Template: "templates/zsh/aliases.zsh.tmpl", Dest: "zsh/aliases.zsh", Root: "config"},
 
 	// Zellij terminal multiplexer
-	"templates/zellij/config.kdl.tmpl": ".config/zellij/config.kdl",
+	{Template: "templates/zellij/config.kdl.tmpl", Dest: "zellij/config.kdl", Root: "config", Requires: "zellij"},
 
 	// Neovim configuration
-	"templates/nvim/init.lua":           ".config/nvim/init.lua",
-	"templates/nvim/lua/plugins.lua":    ".config/nvim/lua/plugins.lua",
-	"templates/nvim/lua/keymaps.lua":    ".config/nvim/lua/keymaps.lua",
-	"templates/nvim/lua/options.lua":    ".config/nvim/lua/options.lua",
+	{Template: "templates/nvim/init.lua", Dest: "nvim/init.lua", Root: "config", Requires: "nvim"},
+	{Template: "templates/nvim/lua/plugins.lua", Dest: "nvim/lua/plugins.lua", Root: "config", Requires: "nvim"},
+	{Template: "templates/nvim/lua/keymaps.lua", Dest: "nvim/lua/keymaps.lua", Root: "config", Requires: "nvim"},
+	{Template: "templates/nvim/lua/options.lua", Dest: "nvim/lua/options.lua", Root: "config", Requires: "nvim"},
+
+	// Git configuration (merged so manual sections such as [user] are preserved)
+	{Template: "templates/git/.gitconfig.tmpl", Dest: ".gitconfig", Mode: ModeMerge},
+}
+
+// SortedMappings returns the generator's mappings in the canonical order
+// that Generate processes and reports them: FileMappings in declaration
+// order, then any loaded with LoadMappingsTemplate. Tools built on the
+// library use it to list mappings the same way as the CLI. The slice is a
+// copy; modifying it does not affect generation.
+func (g *Generator) SortedMappings() []Mapping {
+	return g.Mappings()
+}
+
+// ValidateMappings checks that no two mappings resolve to the same destination,
+// that no destination is inside the backup directory, and that every mapping
+// names a known engine and encoding. The returned error is a *MultiError
+// listing every problem, including each conflicting destination and its
+// templates.
+func ValidateMappings(mappings []Mapping) error {
+	errs := &MultiError{Summary: "invalid mappings"}
+	for _, m := range mappings {
+		if m.Engine != "" && m.Engine != EngineText && m.Engine != EngineHTML {
+			errs.Append(fmt.Errorf("mapping %s has unknown engine %q (expected %q or %q)", m.Template, m.Engine, EngineText, EngineHTML))
+		}
+		if root, ok := PathRoots[m.Root]; m.Root != "" && (!ok || !filepath.IsLocal(filepath.FromSlash(root))) {
+			errs.Append(fmt.Errorf("mapping %s has unknown root %q", m.Template, m.Root))
+		}
+		if !m.Crontab && insideBackupDir(m.Destination()) {
+			errs.Append(fmt.Errorf("mapping %s has destination %s inside the backup directory %s", m.Template, m.Destination(), backup.DirName))
+		}
+		if !validEncoding(m.Encoding) {
+			errs.Append(fmt.Errorf("mapping %s has unknown encoding %q (expected one of %s)", m.Template, m.Encoding, strings.Join(encodingNames(), ", ")))
+		}
+		for _, fragment := range m.Fragments {
+			if fragment == "" || fragment == m.Template {
+				errs.Append(fmt.Errorf("mapping %s has an empty fragment or lists its own template as one", m.Template))
+				break
+			}
+		}
+		if (m.SystemdEnable || m.SystemdRestart) && (m.Crontab || systemdUnit(m.Destination()) == "") {
+			errs.Append(fmt.Errorf("mapping %s sets SystemdEnable or SystemdRestart but %s is not a systemd user unit", m.Template, m.Destination()))
+		}
+	}
+
+	templatesByDest := make(map[string][]string)
+	var order []string
+
+	for _, m := range mappings {
+		dest := m.destKey()
+		if _, seen := templatesByDest[dest]; !seen {
+			order = append(order, dest)
+		}
+		templatesByDest[dest] = append(templatesByDest[dest], m.Template)
+	}
+
+	for _, dest := range order {
+		if templates := templatesByDest[dest]; len(templates) > 1 {
+			errs.Append(fmt.Errorf("duplicate destination %s <- %s", dest, strings.Join(templates, ", ")))
+		}
+	}
+
+	return invalidMappings(errs)
+}
+
+// Orphans returns the paths, relative to home, that are in managed but no
+// longer produced by any of the generator's Mappings.
+func (g *Generator) Orphans(managed []string) []string {
+	current := make(map[string]bool)
+	for _, m := range g.Mappings() {
+		current[m.destKey()] = true
+	}
+
+	var orphans []string
+	for _, p := range managed {
+		if !current[filepath.Clean(p)] {
+			orphans = append(orphans, p)
+		}
+	}
+	return orphans
+}
 
-	// Git configuration
-	"templates/git/.gitconfig.tmpl": ".gitconfig",
+// relativeDest normalizes a destination given as an absolute path, a
+// "~/"-prefixed path, or a path relative to home into a home-relative path.
+func relativeDest(home, dest string) (string, error) {
+	switch {
+	case dest == "~":
+		return ".", nil
+	case strings.HasPrefix(dest, "~/"), strings.HasPrefix(dest, `~\`):
+		dest = dest[2:]
+	case filepath.IsAbs(dest):
+		rel, err := filepath.Rel(home, dest)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s is not inside home directory %s", dest, home)
+		}
+		dest = rel
+	}
+	return filepath.Clean(dest), nil
 }
@@ -0,0 +1,254 @@
+package generator
+
+import (
+	"slices"
+	"strings"
+)
+
+// Sentinel comments delimiting the keys homestruct manages within a merged section.
+const (
+	mergeBeginMarker = "# BEGIN homestruct managed"
+	mergeEndMarker   = "# END homestruct managed"
+)
+
+// blockPlaceholder marks where a previously managed block was removed from a section.
+const blockPlaceholder = "\x00homestruct-block"
+
+// iniSection is a section of an INI/git-config style file.
+type iniSection struct {
+	header string   // Raw header line, empty for the preamble before the first section
+	lines  []string // Body lines following the header
+}
+
+// mergeINI merges rendered INI/git-config content into existing content.
+// Keys from rendered are written inside sentinel-delimited managed blocks in
+// their section; unmanaged lines are preserved, except for lines setting a key
+// that is now managed. Merging the same rendered content twice is idempotent.
+func mergeINI(existing, rendered string) string {
+	sections := parseINI(existing)
+
+	// Remove previously managed blocks, leaving a placeholder so the new
+	// block lands in the same position.
+	hadBlock := make(map[*iniSection]bool)
+	for _, sec := range sections {
+		var stripped bool
+		sec.lines, stripped = stripManagedBlocks(sec.lines)
+		hadBlock[sec] = stripped
+	}
+
+	matched := make(map[*iniSection]bool)
+	for _, rs := range combineSections(parseINI(rendered)) {
+		block := buildManagedBlock(rs.lines)
+		if block == nil {
+			continue
+		}
+
+		// The block goes where it was before, else into the first of any
+		// repeated sections
+		dups := findSections(sections, rs.header)
+		if len(dups) == 0 {
+			sec := &iniSection{header: rs.header}
+			if last := sections[len(sections)-1]; len(last.lines) > 0 && strings.TrimSpace(last.lines[len(last.lines)-1]) != "" {
+				last.lines = append(last.lines, "")
+			}
+			sections = append(sections, sec)
+			dups = []*iniSection{sec}
+		}
+		target := dups[0]
+		for _, sec := range dups {
+			if slices.Contains(sec.lines, blockPlaceholder) {
+				target = sec
+				break
+			}
+		}
+		matched[target] = true
+
+		managed := make(map[string]bool)
+		for _, line := range rs.lines {
+			if key := iniKey(line); key != "" {
+				managed[key] = true
+			}
+		}
+
+		// A manual line setting a managed key in any of the repeated
+		// sections would override or duplicate the managed value
+		for _, sec := range dups {
+			var body []string
+			for _, line := range sec.lines {
+				if key := iniKey(line); key != "" && managed[key] {
+					continue
+				}
+				body = append(body, line)
+			}
+			sec.lines = body
+		}
+		target.lines = insertBlock(target.lines, block)
+	}
+
+	var out []string
+	for _, sec := range sections {
+		// Drop sections that only ever held managed keys that are no longer rendered
+		if sec.header != "" && hadBlock[sec] && !matched[sec] && onlyPlaceholders(sec.lines) {
+			continue
+		}
+		if sec.header != "" {
+			out = append(out, sec.header)
+		}
+		for _, line := range sec.lines {
+			if line != blockPlaceholder {
+				out = append(out, line)
+			}
+		}
+	}
+
+	for len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// parseINI splits content into a preamble followed by its sections.
+// The preamble is always the first element.
+func parseINI(content string) []*iniSection {
+	sections := []*iniSection{{}}
+	if content == "" {
+		return sections
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if isSectionHeader(line) {
+			sections = append(sections, &iniSection{header: line})
+			continue
+		}
+		cur := sections[len(sections)-1]
+		cur.lines = append(cur.lines, line)
+	}
+
+	return sections
+}
+
+// combineSections merges repeated section headers into a single section.
+func combineSections(sections []*iniSection) []*iniSection {
+	var out []*iniSection
+	for _, sec := range sections {
+		if existing := findSections(out, sec.header); len(existing) > 0 {
+			existing[0].lines = append(existing[0].lines, sec.lines...)
+			continue
+		}
+		out = append(out, &iniSection{header: sec.header, lines: append([]string(nil), sec.lines...)})
+	}
+	return out
+}
+
+// findSections returns the sections with an equivalent header, in order.
+func findSections(sections []*iniSection, header string) []*iniSection {
+	key := sectionKey(header)
+	var found []*iniSection
+	for _, sec := range sections {
+		if sectionKey(sec.header) == key {
+			found = append(found, sec)
+		}
+	}
+	return found
+}
+
+// sectionKey normalizes a section header for comparison the way git does:
+// section names are case-insensitive, but a quoted subsection such as
+// [remote "origin"] is case-sensitive. The legacy [section.subsection] form
+// is case-insensitive throughout.
+func sectionKey(header string) string {
+	name := strings.TrimSpace(header)
+	name = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(name, "["), "]"))
+	section, subsection, ok := strings.Cut(name, " ")
+	if !ok {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(section) + " " + strings.TrimSpace(subsection)
+}
+
+// stripManagedBlocks removes managed blocks from lines, replacing each with a placeholder.
+func stripManagedBlocks(lines []string) ([]string, bool) {
+	var out []string
+	inBlock, stripped := false, false
+	for _, line := range lines {
+		switch strings.TrimSpace(line) {
+		case mergeBeginMarker:
+			inBlock, stripped = true, true
+			out = append(out, blockPlaceholder)
+			continue
+		case mergeEndMarker:
+			inBlock = false
+			continue
+		}
+		if !inBlock {
+			out = append(out, line)
+		}
+	}
+	return out, stripped
+}
+
+// buildManagedBlock wraps the non-blank extent of lines in sentinel comments,
+// indented like the first line. It returns nil when there is nothing to manage.
+func buildManagedBlock(lines []string) []string {
+	start, end := 0, len(lines)
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	if start == end {
+		return nil
+	}
+
+	first := lines[start]
+	indent := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+
+	block := []string{indent + mergeBeginMarker}
+	block = append(block, lines[start:end]...)
+	return append(block, indent+mergeEndMarker)
+}
+
+// insertBlock places block at the first placeholder in lines, or at the start of the section.
+func insertBlock(lines, block []string) []string {
+	for i, line := range lines {
+		if line == blockPlaceholder {
+			out := append([]string(nil), lines[:i]...)
+			out = append(out, block...)
+			return append(out, lines[i+1:]...)
+		}
+	}
+	return append(append([]string(nil), block...), lines...)
+}
+
+// onlyPlaceholders reports whether lines hold nothing but blanks and placeholders.
+func onlyPlaceholders(lines []string) bool {
+	for _, line := range lines {
+		if line != blockPlaceholder && strings.TrimSpace(line) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// isSectionHeader reports whether line starts a new INI section.
+func isSectionHeader(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]")
+}
+
+// iniKey returns the normalized key set by line, or "" for blanks and comments.
+func iniKey(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || trimmed == blockPlaceholder || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+		return ""
+	}
+	if i := strings.Index(trimmed, "="); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(trimmed))
+}
@@ -0,0 +1,78 @@
+package generator
+
+import "testing"
+
+func TestMergeINI(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		rendered string
+		want     string
+	}{
+		{
+			name:     "new file",
+			rendered: "[core]\n\teditor = vim\n",
+			want:     "[core]\n\t# BEGIN homestruct managed\n\teditor = vim\n\t# END homestruct managed\n",
+		},
+		{
+			name:     "user keys outside the managed block are kept",
+			existing: "[user]\n\tname = Me\n\temail = me@example.com\n[alias]\n\tst = status\n",
+			rendered: "[user]\n\temail = work@example.com\n[core]\n\teditor = vim\n",
+			want: "[user]\n\t# BEGIN homestruct managed\n\temail = work@example.com\n\t# END homestruct managed\n\tname = Me\n" +
+				"[alias]\n\tst = status\n\n" +
+				"[core]\n\t# BEGIN homestruct managed\n\teditor = vim\n\t# END homestruct managed\n",
+		},
+		{
+			name: "managed block replaced in place",
+			existing: "[core]\n\tpager = less\n\t# BEGIN homestruct managed\n\teditor = nano\n\t# END homestruct managed\n" +
+				"\tautocrlf = input\n",
+			rendered: "[core]\n\teditor = vim\n",
+			want: "[core]\n\tpager = less\n\t# BEGIN homestruct managed\n\teditor = vim\n\t# END homestruct managed\n" +
+				"\tautocrlf = input\n",
+		},
+		{
+			name:     "section no longer rendered is dropped",
+			existing: "[core]\n\t# BEGIN homestruct managed\n\teditor = vim\n\t# END homestruct managed\n[user]\n\tname = Me\n",
+			rendered: "",
+			want:     "[user]\n\tname = Me\n",
+		},
+		{
+			name:     "duplicate sections lose every manual managed key",
+			existing: "[user]\n\tname = Me\n[alias]\n\tst = status\n[user]\n\temail = old@example.com\n\tsigningkey = ABC\n",
+			rendered: "[user]\n\temail = me@example.com\n",
+			want: "[user]\n\t# BEGIN homestruct managed\n\temail = me@example.com\n\t# END homestruct managed\n\tname = Me\n" +
+				"[alias]\n\tst = status\n[user]\n\tsigningkey = ABC\n",
+		},
+		{
+			name:     "block stays in the repeated section it was in",
+			existing: "[user]\n\tname = Me\n[user]\n\t# BEGIN homestruct managed\n\temail = a@example.com\n\t# END homestruct managed\n",
+			rendered: "[user]\n\temail = b@example.com\n",
+			want:     "[user]\n\tname = Me\n[user]\n\t# BEGIN homestruct managed\n\temail = b@example.com\n\t# END homestruct managed\n",
+		},
+		{
+			name:     "section names are case-insensitive",
+			existing: "[Core]\n\tEditor = nano\n\tpager = less\n",
+			rendered: "[core]\n\teditor = vim\n",
+			want:     "[Core]\n\t# BEGIN homestruct managed\n\teditor = vim\n\t# END homestruct managed\n\tpager = less\n",
+		},
+		{
+			name:     "subsections are case-sensitive",
+			existing: "[remote \"Origin\"]\n\turl = https://example.com/mine.git\n",
+			rendered: "[remote \"origin\"]\n\turl = https://example.com/team.git\n",
+			want: "[remote \"Origin\"]\n\turl = https://example.com/mine.git\n\n" +
+				"[remote \"origin\"]\n\t# BEGIN homestruct managed\n\turl = https://example.com/team.git\n\t# END homestruct managed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeINI(tt.existing, tt.rendered)
+			if got != tt.want {
+				t.Errorf("mergeINI =\n%s\nwant:\n%s", got, tt.want)
+			}
+			if again := mergeINI(got, tt.rendered); again != got {
+				t.Errorf("merging again is not idempotent:\n%s\nwant:\n%s", again, got)
+			}
+		})
+	}
+}
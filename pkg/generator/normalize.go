@@ -0,0 +1,120 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Normalize selects formatting transforms applied to rendered content.
+// The zero value leaves content untouched.
+type Normalize struct {
+	LF           bool // Convert CRLF and CR line endings to LF
+	TrimTrailing bool // Trim trailing spaces and tabs from every line
+	FinalNewline bool // Ensure non-empty content ends with a newline
+	Blanks       bool // Collapse runs of three or more blank lines into one
+	CRLF         bool // Emit CRLF line endings (applied last)
+}
+
+// ParseNormalize parses a comma-separated list of transforms: "lf", "trim",
+// "newline", "blanks", "crlf", or "all" for lf, trim and newline. The
+// transforms combine in any order, so "blanks,all" is all plus blanks.
+func ParseNormalize(spec string) (Normalize, error) {
+	var n Normalize
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "all":
+			n.LF, n.TrimTrailing, n.FinalNewline = true, true, true
+		case "lf":
+			n.LF = true
+		case "trim":
+			n.TrimTrailing = true
+		case "newline":
+			n.FinalNewline = true
+		case "blanks":
+			n.Blanks = true
+		case "crlf":
+			n.CRLF = true
+		default:
+			return Normalize{}, fmt.Errorf("unknown normalize transform %q (expected lf, trim, newline, blanks, crlf or all)", name)
+		}
+	}
+	if n.LF && n.CRLF {
+		return Normalize{}, fmt.Errorf("normalize transforms lf and crlf are mutually exclusive")
+	}
+	return n, nil
+}
+
+// Apply returns content with the selected transforms applied.
+func (n Normalize) Apply(content string) string {
+	if content == "" {
+		return content
+	}
+
+	if n.LF {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		content = strings.ReplaceAll(content, "\r", "\n")
+	}
+
+	if n.TrimTrailing {
+		hadNewline := strings.HasSuffix(content, "\n")
+		lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+		for i, line := range lines {
+			cr := strings.HasSuffix(line, "\r")
+			line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+			if cr {
+				line += "\r"
+			}
+			lines[i] = line
+		}
+		content = strings.Join(lines, "\n")
+		if hadNewline {
+			content += "\n"
+		}
+	}
+
+	if n.Blanks {
+		content = collapseBlanks(content)
+	}
+
+	if n.FinalNewline && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	if n.CRLF {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+
+	return content
+}
+
+// collapseBlanks replaces every run of three or more blank (empty or
+// whitespace-only) lines with the first line of the run, leaving single and
+// double blank lines alone.
+func collapseBlanks(content string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var sb strings.Builder
+	sb.Grow(len(content))
+
+	for i := 0; i < len(lines); {
+		if strings.TrimSpace(lines[i]) != "" || !strings.HasSuffix(lines[i], "\n") {
+			sb.WriteString(lines[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" && strings.HasSuffix(lines[j], "\n") {
+			j++
+		}
+		if j-i >= 3 {
+			sb.WriteString(lines[i])
+		} else {
+			for _, line := range lines[i:j] {
+				sb.WriteString(line)
+			}
+		}
+		i = j
+	}
+	return sb.String()
+}
@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNormalize(t *testing.T) {
+	all := Normalize{LF: true, TrimTrailing: true, FinalNewline: true}
+	tests := []struct {
+		spec    string
+		want    Normalize
+		wantErr string // Substring of the expected error, "" for none
+	}{
+		{spec: "", want: Normalize{}},
+		{spec: "lf, trim", want: Normalize{LF: true, TrimTrailing: true}},
+		{spec: "all", want: all},
+		{spec: "blanks,all", want: Normalize{LF: true, TrimTrailing: true, FinalNewline: true, Blanks: true}},
+		{spec: "all,blanks", want: Normalize{LF: true, TrimTrailing: true, FinalNewline: true, Blanks: true}},
+		{spec: "crlf,newline", want: Normalize{FinalNewline: true, CRLF: true}},
+		{spec: "crlf,all", wantErr: "mutually exclusive"},
+		{spec: "all,crlf", wantErr: "mutually exclusive"},
+		{spec: "lf,tabs", wantErr: `unknown normalize transform "tabs"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseNormalize(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseNormalize(%q) error = %v, want one containing %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNormalize(%q): %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseNormalize(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
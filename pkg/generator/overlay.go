@@ -0,0 +1,103 @@
+package generator
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// overlayFS is a stack of file systems in which a file in a later layer
+// hides the file at the same path in earlier ones. Directory listings are
+// merged across layers.
+type overlayFS []fs.FS
+
+// Overlay returns a file system that reads each path from the last of
+// layers that has it, for stacking template directories (e.g. the embedded
+// templates, then an organization's, then a personal one). Pass it to New
+// as the templates FS.
+func Overlay(layers ...fs.FS) fs.FS {
+	return overlayFS(layers)
+}
+
+// labeledFS is a layer of an Overlay with a name (see Layer).
+type labeledFS struct {
+	fs.FS
+	label string
+}
+
+// Layer names fsys, e.g. after the directory it reads, for use as a layer of
+// Overlay, so that verbose output can report which layer each template is
+// read from.
+func Layer(label string, fsys fs.FS) fs.FS {
+	return labeledFS{FS: fsys, label: label}
+}
+
+// origin returns the label of the layer that name is read from, or "" if
+// no layer has it or that layer has no label.
+func (o overlayFS) origin(name string) string {
+	for i := len(o) - 1; i >= 0; i-- {
+		if _, err := fs.Stat(o[i], name); err == nil {
+			if l, ok := o[i].(labeledFS); ok {
+				return l.label
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// labels lists the labels of the labeled layers, topmost first.
+func (o overlayFS) labels() string {
+	var labels []string
+	for i := len(o) - 1; i >= 0; i-- {
+		if l, ok := o[i].(labeledFS); ok {
+			labels = append(labels, l.label)
+		}
+	}
+	return strings.Join(labels, " or ")
+}
+
+// Open opens name in the topmost layer that has it.
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for i := len(o) - 1; i >= 0; i-- {
+		f, err := o[i].Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir lists the directory name in every layer that has it, with entries
+// from later layers replacing earlier ones of the same name, sorted by name.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	found := false
+	for _, layer := range o {
+		list, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, e := range list {
+			entries[e.Name()] = e
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
@@ -0,0 +1,264 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// rendered returns the content generated for dest during this Generate call,
+// for the rendered template function called from m's template. dest must be
+// a mapping's destination that m's template passes to rendered as a quoted
+// string, so the dependency is known, and generated first, before rendering.
+func (g *Generator) rendered(m *Mapping, dest string) (string, error) {
+	if m == nil {
+		return "", fmt.Errorf("rendered %q: only available in mapping templates", dest)
+	}
+	target, err := g.Which(dest)
+	if err != nil {
+		return "", fmt.Errorf("rendered %q: %w", dest, err)
+	}
+	key := target.destKey()
+	if content, ok := g.outputs[key]; ok {
+		return content, nil
+	}
+	if slices.Contains(g.deps[m.destKey()], key) {
+		return "", fmt.Errorf("rendered %q: %s was skipped or failed to generate", dest, target.Template)
+	}
+	return "", fmt.Errorf("rendered %q: the destination must be a quoted string so %s is generated first", dest, target.Template)
+}
+
+// references returns the destinations m's templates pass to rendered as
+// quoted strings. Templates that cannot be read or parsed have none; the
+// error is reported when rendering them.
+func (g *Generator) references(m Mapping) []string {
+	var refs []string
+	for _, templatePath := range m.Templates() {
+		name, content, err := g.readTemplate(templatePath)
+		if err != nil || !m.renders(name, g.ext) || !strings.Contains(string(content), "rendered") {
+			continue
+		}
+		tmpl, err := g.parseTemplate(&m, name, string(content))
+		if err != nil {
+			continue
+		}
+		walkTemplate(tmpl, func(node parse.Node) {
+			cmd, ok := node.(*parse.CommandNode)
+			if !ok || len(cmd.Args) < 2 {
+				return
+			}
+			if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "rendered" {
+				if s, ok := cmd.Args[1].(*parse.StringNode); ok {
+					refs = append(refs, s.Text)
+				}
+			}
+		})
+	}
+	return refs
+}
+
+// parseTemplate parses one of m's templates for inspection without
+// executing it. Both engines share the text/template syntax.
+func (g *Generator) parseTemplate(m *Mapping, name, content string) (*template.Template, error) {
+	return template.New(name).Funcs(g.funcMap(m)).Parse(content)
+}
+
+// walkTemplate calls fn for every node of tmpl and of the templates it
+// defines.
+func walkTemplate(tmpl *template.Template, fn func(parse.Node)) {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkNodes(t.Tree.Root, fn)
+		}
+	}
+}
+
+// walkNodes calls fn for every node under node, then for node itself.
+func walkNodes(node parse.Node, fn func(parse.Node)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkNodes(child, fn)
+		}
+	case *parse.ActionNode:
+		walkNodes(n.Pipe, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkNodes(n.Pipe, fn)
+	case *parse.ChainNode:
+		walkNodes(n.Node, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkNodes(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkNodes(arg, fn)
+		}
+	}
+	fn(node)
+}
+
+// walkBranch walks the pipeline and both lists of an if, range or with
+// action.
+func walkBranch(n *parse.BranchNode, fn func(parse.Node)) {
+	walkNodes(n.Pipe, fn)
+	walkNodes(n.List, fn)
+	walkNodes(n.ElseList, fn)
+}
+
+// renderWaves orders the mappings in ms, and every mapping they reference
+// with rendered, into waves generated one after another: each mapping is in
+// a later wave than those it references, and mappings within a wave can be
+// generated concurrently. Waves keep mapping order. It records the
+// references for rendered; referencing a destination with no mapping, or a
+// cycle of references, is an error.
+func (g *Generator) renderWaves(ms []Mapping) ([][]Mapping, error) {
+	g.deps = map[string][]string{}
+	depth := map[string]int{}
+	const visiting = -1
+	var stack []string
+
+	var visit func(m Mapping) (int, error)
+	visit = func(m Mapping) (int, error) {
+		key := m.destKey()
+		if d, ok := depth[key]; ok {
+			if d == visiting {
+				cycle := append(stack[slices.Index(stack, key):], key)
+				return 0, fmt.Errorf("templates reference each other's output in a cycle: %s", strings.Join(cycle, " -> "))
+			}
+			return d, nil
+		}
+		depth[key] = visiting
+		stack = append(stack, key)
+
+		d := 0
+		for _, ref := range g.references(m) {
+			target, err := g.Which(ref)
+			if err != nil {
+				return 0, fmt.Errorf("template %s: rendered %q: %w", m.Template, ref, err)
+			}
+			g.deps[key] = append(g.deps[key], target.destKey())
+			refDepth, err := visit(target)
+			if err != nil {
+				return 0, err
+			}
+			d = max(d, refDepth+1)
+		}
+
+		stack = stack[:len(stack)-1]
+		depth[key] = d
+		return d, nil
+	}
+	for _, m := range ms {
+		if _, err := visit(m); err != nil {
+			return nil, err
+		}
+	}
+
+	var waves [][]Mapping
+	for _, m := range g.Mappings() {
+		d, ok := depth[m.destKey()]
+		if !ok {
+			continue
+		}
+		for len(waves) <= d {
+			waves = append(waves, nil)
+		}
+		waves[d] = append(waves[d], m)
+	}
+	return waves, nil
+}
+
+// generateWaves generates the mappings of each wave with up to SetParallel
+// workers, recording the content of referenced mappings for rendered before
+// starting the next wave, and returns every outcome by destination.
+func (g *Generator) generateWaves(waves [][]Mapping) map[string]outcome {
+	referenced := map[string]bool{}
+	for _, keys := range g.deps {
+		for _, key := range keys {
+			referenced[key] = true
+		}
+	}
+
+	g.outputs = map[string]string{}
+	outcomes := map[string]outcome{}
+	for _, wave := range waves {
+		for i, o := range g.generateConcurrently(wave) {
+			key := wave[i].destKey()
+			outcomes[key] = o
+			if !referenced[key] {
+				continue
+			}
+			switch {
+			case o.result != nil:
+				g.outputs[key] = o.result.Content
+			case o.skip != nil && o.skip.Unchanged:
+				// An unchanged destination still has the content last generated
+				if data, err := os.ReadFile(o.destPath); err == nil {
+					g.outputs[key] = string(data)
+				}
+			}
+		}
+	}
+	return outcomes
+}
+
+// generateDependencies generates every mapping m references with rendered,
+// directly or indirectly, so m can be generated on its own.
+func (g *Generator) generateDependencies(m Mapping) error {
+	waves, err := g.renderWaves([]Mapping{m})
+	if err != nil {
+		return err
+	}
+	g.generateWaves(waves[:len(waves)-1])
+	return nil
+}
+
+// renderDependencies renders every mapping m references with rendered,
+// directly or indirectly, so Render can preview m on its own. Unlike
+// generateDependencies it only renders each one and combines it with its
+// current destination: there is no render cache, required binary check or
+// event, and a dependency that fails to render fails the preview.
+func (g *Generator) renderDependencies(m Mapping) error {
+	waves, err := g.renderWaves([]Mapping{m})
+	if err != nil {
+		return err
+	}
+	g.outputs = map[string]string{}
+	for _, wave := range waves {
+		for _, dep := range wave {
+			if dep.destKey() == m.destKey() {
+				continue
+			}
+			existing, _, err := g.readExisting(dep, g.DestPath(dep))
+			if err != nil {
+				return err
+			}
+			rendered, warnings, err := g.renderMapping(dep, existing)
+			g.warnings = append(g.warnings, warnings...)
+			if err != nil {
+				return err
+			}
+			if rendered, err = applyMode(dep, existing, rendered); err != nil {
+				return err
+			}
+			g.outputs[dep.destKey()] = rendered
+		}
+	}
+	return nil
+}
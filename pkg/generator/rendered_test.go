@@ -0,0 +1,111 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRendered(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]string // Template path to content, mapped to its base name without .tmpl; a before b
+		want      map[string]string // Generated content by destination
+		wantErr   string            // Substring of the expected error, "" for none
+	}{
+		{
+			name: "dependency generated first",
+			templates: map[string]string{
+				"templates/a.tmpl": "{{ rendered \"b\" | len }} bytes from b\n",
+				"templates/b.tmpl": "user = {{ .User }}\n",
+			},
+			want: map[string]string{
+				"a": "13 bytes from b\n",
+				"b": "user = alice\n",
+			},
+		},
+		{
+			name: "cycle",
+			templates: map[string]string{
+				"templates/a.tmpl": "{{ rendered \"b\" }}",
+				"templates/b.tmpl": "{{ rendered \"a\" }}",
+			},
+			wantErr: "templates reference each other's output in a cycle: a -> b -> a",
+		},
+		{
+			name: "non-literal destination",
+			templates: map[string]string{
+				"templates/a.tmpl": "{{ rendered (printf \"%s\" \"b\") }}",
+				"templates/b.tmpl": "user = {{ .User }}\n",
+			},
+			wantErr: `rendered "b": the destination must be a quoted string so templates/b.tmpl is generated first`,
+		},
+		{
+			name: "dependency failed",
+			templates: map[string]string{
+				"templates/a.tmpl": "{{ rendered \"b\" }}",
+				"templates/b.tmpl": "{{ .User",
+			},
+			wantErr: `rendered "b": templates/b.tmpl was skipped or failed to generate`,
+		},
+		{
+			name: "destination without a mapping",
+			templates: map[string]string{
+				"templates/a.tmpl": "{{ rendered \"missing\" }}",
+			},
+			wantErr: `template templates/a.tmpl: rendered "missing"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := fstest.MapFS{}
+			var mappings []Mapping
+			for _, name := range []string{"templates/a.tmpl", "templates/b.tmpl"} {
+				content, ok := tt.templates[name]
+				if !ok {
+					continue
+				}
+				templates[name] = &fstest.MapFile{Data: []byte(content)}
+				dest := strings.TrimSuffix(strings.TrimPrefix(name, "templates/"), ".tmpl")
+				mappings = append(mappings, Mapping{Template: name, Dest: dest})
+			}
+			g := newTestGenerator(t, templates)
+			g.mappings = mappings
+
+			// b is generated in an earlier wave than a, but results keep mapping order
+			results, err := g.Generate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Generate error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			got := map[string]string{}
+			for i, r := range results {
+				if want := g.DestPath(mappings[i]); r.DestPath != want {
+					t.Errorf("result %d is %s, want %s in mapping order", i, r.DestPath, want)
+				}
+				got[filepath.Base(r.DestPath)] = r.Content
+			}
+			for dest, want := range tt.want {
+				if got[dest] != want {
+					t.Errorf("%s = %q, want %q", dest, got[dest], want)
+				}
+			}
+
+			// Previewing a on its own renders b for it without writing
+			preview, err := g.Render("templates/a.tmpl")
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if preview != tt.want["a"] {
+				t.Errorf("Render = %q, want %q", preview, tt.want["a"])
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nabkey/home-files/pkg/diff"
+)
+
+// sensitiveFiles are destinations (relative to home) that typically hold
+// credentials, so their content is redacted from previews by default.
+// Everything under sensitiveDirs is treated the same way.
+var sensitiveFiles = map[string]bool{
+	".netrc":              true,
+	".pgpass":             true,
+	".git-credentials":    true,
+	".npmrc":              true,
+	".pypirc":             true,
+	".vault-token":        true,
+	".aws/credentials":    true,
+	".docker/config.json": true,
+	".kube/config":        true,
+}
+
+// sensitive reports whether the mapping's content is redacted from
+// previews, diffs and bundles.
+func (m Mapping) sensitive() bool {
+	if m.Sensitive != nil {
+		return *m.Sensitive
+	}
+	dest := filepath.ToSlash(filepath.Clean(m.Destination()))
+	if sensitiveFiles[dest] {
+		return true
+	}
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(dest)), "/") {
+		if sensitiveDirs[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// FileMode returns the permissions the result's file is written with: 0600
+// for sensitive results, so credentials are not readable by other users,
+// and 0644 otherwise.
+func (r Result) FileMode() os.FileMode {
+	if r.Sensitive {
+		return 0600
+	}
+	return 0644
+}
+
+// Redact returns the placeholder shown instead of sensitive content.
+func Redact(content string) string {
+	return fmt.Sprintf("[REDACTED %d bytes]", len(content))
+}
+
+// Preview returns the content for display: the content itself, or a
+// placeholder for sensitive results.
+func (r Result) Preview() string {
+	if r.Sensitive {
+		return Redact(r.Content)
+	}
+	return r.Content
+}
+
+// Diff returns a unified diff from existing to the result's content, or for
+// sensitive results only headers and a placeholder if they differ. It
+// returns "" when there are no changes.
+func (r Result) Diff(oldName, newName, existing string) string {
+	if !r.Sensitive {
+		return diff.Unified(oldName, newName, existing, r.Content)
+	}
+	if existing == r.Content {
+		return ""
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s\n", oldName, newName, Redact(r.Content))
+}
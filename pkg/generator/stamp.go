@@ -0,0 +1,105 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultHeader is the header text used by the CLI's --header flag.
+const DefaultHeader = "Managed by homestruct - do not edit, changes will be overwritten\nSource: {{ .Template }}"
+
+// stampData is what header and footer templates are executed with: the
+// template context plus details of the file being generated.
+type stampData struct {
+	*Context
+	Template string // Source template path
+	Dest     string // Destination relative to home
+	Date     string // Generation date, YYYY-MM-DD
+}
+
+// SetHeader sets template text rendered and prepended to every generated
+// file, each line commented in the destination's syntax, and SetFooter text
+// appended the same way. Both have the template context plus .Template,
+// .Dest and .Date. Mappings with NoHeader, or a mode other than overwrite,
+// are left alone; a leading "#!" line stays first. Empty disables them.
+func (g *Generator) SetHeader(text string) error {
+	if err := g.checkStamp(text); err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+	g.header = text
+	return nil
+}
+
+// SetFooter sets template text appended to every generated file (see SetHeader).
+func (g *Generator) SetFooter(text string) error {
+	if err := g.checkStamp(text); err != nil {
+		return fmt.Errorf("invalid footer: %w", err)
+	}
+	g.footer = text
+	return nil
+}
+
+// checkStamp reports whether header or footer text parses as a template.
+func (g *Generator) checkStamp(text string) error {
+	_, err := template.New("stamp").Funcs(g.funcMap(nil)).Parse(text)
+	return err
+}
+
+// stamp adds the configured header and footer to content rendered for m.
+func (g *Generator) stamp(m *Mapping, content string) (string, error) {
+	if (g.header == "" && g.footer == "") || m.NoHeader || m.Mode != ModeOverwrite {
+		return content, nil
+	}
+
+	header, err := g.renderStamp(m, g.header)
+	if err != nil {
+		return "", fmt.Errorf("failed to render header for %s: %w", m.Template, err)
+	}
+	footer, err := g.renderStamp(m, g.footer)
+	if err != nil {
+		return "", fmt.Errorf("failed to render footer for %s: %w", m.Template, err)
+	}
+
+	var shebang string
+	if strings.HasPrefix(content, "#!") {
+		line, rest, _ := strings.Cut(content, "\n")
+		shebang, content = line+"\n", rest
+	}
+	if footer != "" && content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return shebang + header + content + footer, nil
+}
+
+// renderStamp renders header or footer text for m and comments every line
+// in the destination's syntax. Empty text renders to nothing.
+func (g *Generator) renderStamp(m *Mapping, text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("stamp").Funcs(g.funcMap(m)).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	data := stampData{
+		Context:  g.ctx,
+		Template: m.Template,
+		Dest:     m.Destination(),
+		Date:     time.Now().Format(time.DateOnly),
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	prefix := m.commentPrefix()
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		sb.WriteString(strings.TrimRight(prefix+" "+line, " "))
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,105 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/manifest"
+)
+
+// SyncStatus is how a managed file on disk compares to what homestruct last
+// wrote there.
+type SyncStatus string
+
+const (
+	SyncInSync    SyncStatus = "in-sync"   // Unchanged since it was last written
+	SyncModified  SyncStatus = "modified"  // Changed since it was last written
+	SyncMissing   SyncStatus = "missing"   // Mapped but not on disk
+	SyncOrphaned  SyncStatus = "orphaned"  // Written by an earlier run but no longer mapped
+	SyncUnmanaged SyncStatus = "unmanaged" // Mapped and on disk, but never written by homestruct
+)
+
+// FileStatus is the sync status of one destination. Its JSON form is a
+// stable format for monitoring; fields are only ever added.
+type FileStatus struct {
+	Dest     string     `json:"dest"`     // Absolute destination path
+	Template string     `json:"template"` // Mapped template, or the one recorded for orphans
+	Status   SyncStatus `json:"status"`
+	Hash     string     `json:"hash"`  // SHA-256 of the file on disk, empty if missing
+	ModTime  *time.Time `json:"mtime"` // Modification time of the file on disk, nil if missing
+}
+
+// Status compares every mapped destination, and every file man records, to
+// the hash man recorded when it was last written, without rendering
+// anything. Results are sorted by destination. The crontab is not a file
+// and is left out, as are mappings Generate would skip for a missing
+// required binary unless an earlier run wrote them.
+func (g *Generator) Status(man *manifest.Manifest) ([]FileStatus, error) {
+	var statuses []FileStatus
+	for _, m := range g.Mappings() {
+		if m.Crontab {
+			continue
+		}
+		rel := filepath.ToSlash(m.destKey())
+		entry, managed := man.Files[rel]
+		if !managed && m.Requires != "" && !g.ignoreRequires {
+			if _, err := exec.LookPath(m.Requires); err != nil {
+				continue
+			}
+		}
+		s, err := g.fileStatus(rel, m.Template, entry, managed)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, s)
+	}
+	for _, rel := range g.Orphans(man.Paths()) {
+		rel = filepath.ToSlash(rel)
+		entry := man.Files[rel]
+		s, err := g.fileStatus(rel, entry.Template, entry, true)
+		if err != nil {
+			return nil, err
+		}
+		s.Status = SyncOrphaned
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Dest < statuses[j].Dest })
+	return statuses, nil
+}
+
+// fileStatus reads the file at rel under home and compares it to entry, if
+// the file is managed.
+func (g *Generator) fileStatus(rel, template string, entry manifest.Entry, managed bool) (FileStatus, error) {
+	s := FileStatus{Dest: filepath.Join(g.ctx.Home, filepath.FromSlash(rel)), Template: template}
+
+	info, err := os.Stat(s.Dest)
+	if errors.Is(err, os.ErrNotExist) {
+		s.Status = SyncMissing
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to check %s: %w", s.Dest, err)
+	}
+	data, err := os.ReadFile(s.Dest)
+	if err != nil {
+		return s, fmt.Errorf("failed to check %s: %w", s.Dest, err)
+	}
+	modTime := info.ModTime()
+	s.Hash, s.ModTime = manifest.Hash(data), &modTime
+
+	switch {
+	case !managed:
+		s.Status = SyncUnmanaged
+	case s.Hash == entry.SHA256:
+		s.Status = SyncInSync
+	default:
+		s.Status = SyncModified
+	}
+	return s, nil
+}
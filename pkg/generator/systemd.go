@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// systemdUnit returns the user unit a destination (relative to home)
+// belongs to: the file name for units under a systemd/user directory, or
+// the unit a drop-in directory ("foo.service.d/override.conf") extends. It
+// returns "" for other destinations.
+func systemdUnit(dest string) string {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(dest)), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] != "systemd" || parts[i+1] != "user" {
+			continue
+		}
+		rest := parts[i+2:]
+		if len(rest) == 2 && strings.HasSuffix(rest[0], ".d") {
+			return strings.TrimSuffix(rest[0], ".d")
+		}
+		if len(rest) == 1 {
+			return rest[0]
+		}
+		return ""
+	}
+	return ""
+}
+
+// ReloadSystemd runs "systemctl --user daemon-reload" after Apply wrote
+// files under systemd/user, then enables and restarts the units whose
+// mappings set SystemdEnable and SystemdRestart. It does nothing outside
+// Linux, and only reports what to run by hand when systemctl is missing or
+// the files were written for another user (--chown). The returned error
+// lists every failed command; the files themselves are already written.
+func (g *Generator) ReloadSystemd(actions []Action) error {
+	var units []Result
+	for _, a := range actions {
+		if a.Result.Unit != "" && a.Status != StatusUnchanged {
+			units = append(units, a.Result)
+		}
+	}
+	if len(units) == 0 || runtime.GOOS != "linux" {
+		return nil
+	}
+
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		fmt.Fprintln(g.out, "[SYSTEMD] systemctl not found; run `systemctl --user daemon-reload` to load the changed units")
+		return nil
+	}
+	if g.owner != nil {
+		fmt.Fprintln(g.out, "[SYSTEMD] files were written for another user; run `systemctl --user daemon-reload` as that user")
+		return nil
+	}
+
+	errs := &MultiError{Summary: "systemd user units were written but not all could be reloaded"}
+	if err := g.systemctl("daemon-reload"); err != nil {
+		errs.Append(err)
+		return errs
+	}
+	for _, r := range units {
+		if r.systemdEnable {
+			errs.Append(g.systemctl("enable", r.Unit))
+		}
+		if r.systemdRestart {
+			errs.Append(g.systemctl("restart", r.Unit))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// systemctl runs "systemctl --user" with args and reports it.
+func (g *Generator) systemctl(args ...string) error {
+	fmt.Fprintf(g.out, "[SYSTEMD] systemctl --user %s\n", strings.Join(args, " "))
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl --user %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
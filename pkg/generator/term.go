@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// termPrograms identify terminal emulators that do not set TERM_PROGRAM by
+// a variable they export or by their TERM value, mapped to the name used
+// for TermProgram.
+var termPrograms = []struct{ env, term, name string }{
+	{env: "WEZTERM_EXECUTABLE", name: "WezTerm"},
+	{env: "KITTY_WINDOW_ID", term: "xterm-kitty", name: "kitty"},
+	{env: "ALACRITTY_WINDOW_ID", term: "alacritty", name: "Alacritty"},
+	{env: "GHOSTTY_RESOURCES_DIR", term: "xterm-ghostty", name: "ghostty"},
+	{env: "WT_SESSION", name: "WindowsTerminal"},
+	{env: "KONSOLE_VERSION", name: "Konsole"},
+}
+
+// trueColorPrograms are terminal emulators known to support 24-bit color
+// even when COLORTERM does not say so, e.g. over SSH.
+var trueColorPrograms = []string{"iTerm.app", "WezTerm", "kitty", "Alacritty", "ghostty", "vscode", "WindowsTerminal", "Konsole"}
+
+// detectTerm sets Term, TermProgram and TrueColor from env: TERM,
+// TERM_PROGRAM (or a variable or TERM value particular to the emulator) and
+// COLORTERM. HOMESTRUCT_TERM, HOMESTRUCT_TERM_PROGRAM and
+// HOMESTRUCT_TRUECOLOR override them.
+func (c *Context) detectTerm(env map[string]string) {
+	c.Term = env["TERM"]
+	if v, ok := env["HOMESTRUCT_TERM"]; ok {
+		c.Term = v
+	}
+
+	c.TermProgram = termProgram(env)
+	if v, ok := env["HOMESTRUCT_TERM_PROGRAM"]; ok {
+		c.TermProgram = v
+	}
+
+	if v, err := strconv.ParseBool(env["HOMESTRUCT_TRUECOLOR"]); err == nil {
+		c.TrueColor = v
+	} else {
+		c.TrueColor = trueColor(env["COLORTERM"], c.Term, c.TermProgram)
+	}
+}
+
+// termProgram returns the terminal emulator named by TERM_PROGRAM, or
+// recognized from termPrograms, or "" if unknown.
+func termProgram(env map[string]string) string {
+	if p := env["TERM_PROGRAM"]; p != "" {
+		return p
+	}
+	for _, p := range termPrograms {
+		if (p.env != "" && env[p.env] != "") || (p.term != "" && env["TERM"] == p.term) {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// trueColor reports whether a terminal supports 24-bit color: COLORTERM is
+// "truecolor" or "24bit", TERM names a direct-color terminfo entry (e.g.
+// xterm-direct), or the emulator is one of trueColorPrograms.
+func trueColor(colorterm, term, program string) bool {
+	switch strings.ToLower(colorterm) {
+	case "truecolor", "24bit":
+		return true
+	}
+	if strings.HasSuffix(term, "-direct") || strings.Contains(term, "truecolor") {
+		return true
+	}
+	for _, p := range trueColorPrograms {
+		if strings.EqualFold(program, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultsFile is the path within the templates FS of the default template
+// values, a JSON object. It is optional, and may be written in YAML as
+// templates/defaults.yaml (or .yml) instead (see builtinFiles).
+const DefaultsFile = "templates/defaults.json"
+
+// LoadValues sets the template values (.Set) by layering, from lowest to
+// highest precedence:
+//  1. DefaultsFile from the templates FS, then its overlays
+//  2. each values file, in order, each followed by its overlays
+//  3. the values already in the context (e.g. from a locked context)
+//  4. the "key=value" pairs from --set
+//
+// The overlays of "values.json" are "values.<profile>.json" (see SetProfile)
+// and then "values.<os>.json" next to it, loaded when they exist. Nested
+// objects are merged key by key; any other value, including arrays, replaces
+// the lower layer's. Files named .yaml or .yml are YAML, others JSON.
+func (g *Generator) LoadValues(files, sets []string) error {
+	values := make(map[string]any)
+
+	for _, file := range builtinFiles(DefaultsFile) {
+		for _, name := range append([]string{file}, g.overlays(file)...) {
+			data, err := fs.ReadFile(g.templates, name)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			defaults, err := decodeValuesFile(name, data)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			if name != file && g.verbose {
+				fmt.Fprintf(g.out, "Loaded values overlay %s\n", name)
+			}
+			MergeValues(values, defaults)
+		}
+	}
+
+	for _, path := range files {
+		loaded, err := LoadValuesFile(path)
+		if err != nil {
+			return err
+		}
+		MergeValues(values, loaded)
+
+		for _, overlay := range g.overlays(path) {
+			if _, err := os.Stat(overlay); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			loaded, err := LoadValuesFile(overlay)
+			if err != nil {
+				return err
+			}
+			if g.verbose {
+				fmt.Fprintf(g.out, "Loaded values overlay %s\n", overlay)
+			}
+			MergeValues(values, loaded)
+		}
+	}
+
+	MergeValues(values, g.ctx.Set)
+
+	setValues, err := ParseSetValues(sets)
+	if err != nil {
+		return err
+	}
+	MergeValues(values, setValues)
+
+	g.ctx.Set = values
+	return nil
+}
+
+// SetProfile selects the profile (e.g. "work") whose values overlays
+// LoadValues loads. Empty, the default, loads only the OS overlays.
+func (g *Generator) SetProfile(profile string) {
+	g.profile = profile
+}
+
+// overlays returns the overlay paths of a values file, in the order they
+// are merged: "<base>.<profile><ext>" and "<base>.<os><ext>".
+func (g *Generator) overlays(file string) []string {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	var names []string
+	for _, suffix := range []string{g.profile, g.ctx.OS} {
+		if suffix != "" {
+			names = append(names, base+"."+suffix+ext)
+		}
+	}
+	return names
+}
+
+// LoadValuesFile reads an object of template values from path: a YAML
+// mapping if it is named .yaml or .yml, a JSON object otherwise.
+func LoadValuesFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file: %w", err)
+	}
+	values, err := decodeValuesFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse values file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// builtinFiles returns the names file may have in the templates FS, in the
+// order they are loaded: the JSON file, then YAML files with the same base
+// name. All of them are loaded, so YAML defaults in a --template-dir layer
+// override the built-in JSON ones key by key.
+func builtinFiles(file string) []string {
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	return []string{base + ".json", base + ".yaml", base + ".yml"}
+}
+
+// decodeValuesFile decodes the values or data file name: YAML if it is named
+// .yaml or .yml, JSON otherwise.
+func decodeValuesFile(name string, data []byte) (map[string]any, error) {
+	if isYAMLFile(name) {
+		return decodeYAML(data)
+	}
+	return decodeValues(data)
+}
+
+// decodeValues decodes a JSON object of template values.
+func decodeValues(data []byte) (map[string]any, error) {
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[string]any)
+	}
+	return values, nil
+}
+
+// MergeValues merges src into dst. Nested maps present in both are merged
+// recursively; any other value in src replaces the one in dst.
+func MergeValues(dst, src map[string]any) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			MergeValues(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			// Copy so later merges never modify src
+			copied := make(map[string]any)
+			MergeValues(copied, srcMap)
+			value = copied
+		}
+		dst[key] = value
+	}
+}
+
+// ParseSetValues parses "key=value" pairs into a nested map. Dotted keys such
+// as "git.email=me@example.com" create nested maps. Later pairs override
+// earlier ones.
+func ParseSetValues(pairs []string) (map[string]any, error) {
+	values := make(map[string]any)
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set value %q (expected key=value)", pair)
+		}
+
+		parts := strings.Split(key, ".")
+		node := values
+		for i, part := range parts[:len(parts)-1] {
+			if part == "" {
+				return nil, fmt.Errorf("invalid --set key %q", key)
+			}
+			child, exists := node[part]
+			if !exists {
+				next := make(map[string]any)
+				node[part] = next
+				node = next
+				continue
+			}
+			next, isMap := child.(map[string]any)
+			if !isMap {
+				return nil, fmt.Errorf("--set key %q conflicts with value already set for %q", key, strings.Join(parts[:i+1], "."))
+			}
+			node = next
+		}
+
+		last := parts[len(parts)-1]
+		if last == "" {
+			return nil, fmt.Errorf("invalid --set key %q", key)
+		}
+		if _, isMap := node[last].(map[string]any); isMap {
+			return nil, fmt.Errorf("--set key %q conflicts with nested keys already set under it", key)
+		}
+		node[last] = value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// vmVendors are substrings of the DMI product name or vendor reported by
+// common hypervisors.
+var vmVendors = []string{"virtualbox", "vmware", "kvm", "qemu", "virtual machine", "xen", "parallels", "bochs", "bhyve", "google compute engine", "amazon ec2"}
+
+// detectContainer reports whether the process runs inside a container, from
+// the marker files Docker and Podman create, the container variable systemd
+// and Podman set, and the init process's cgroups.
+func detectContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	if os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	cgroup := readLower("/proc/1/cgroup")
+	for _, runtime := range []string{"docker", "kubepods", "containerd", "lxc", "libpod"} {
+		if strings.Contains(cgroup, runtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectWSL reports whether the process runs under the Windows Subsystem for
+// Linux, whose kernel release mentions Microsoft.
+func detectWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	return strings.Contains(readLower("/proc/sys/kernel/osrelease"), "microsoft") ||
+		strings.Contains(readLower("/proc/version"), "microsoft")
+}
+
+// detectVM reports whether the machine is a virtual machine, from the DMI
+// product and vendor names or the CPU's hypervisor flag.
+func detectVM() bool {
+	dmi := readLower("/sys/class/dmi/id/product_name") + readLower("/sys/class/dmi/id/sys_vendor")
+	for _, vendor := range vmVendors {
+		if strings.Contains(dmi, vendor) {
+			return true
+		}
+	}
+	for _, line := range strings.Split(readLower("/proc/cpuinfo"), "\n") {
+		if strings.HasPrefix(line, "flags") {
+			return strings.Contains(line+" ", " hypervisor ")
+		}
+	}
+	return false
+}
+
+// readLower returns the lowercased content of a small system file, or ""
+// if it cannot be read.
+func readLower(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(string(data))
+}
+
+// envOverride returns the boolean value of the environment variable key
+// ("1", "true", "0", "false", ...), or detect's result if it is unset or
+// invalid. detect is only called when needed.
+func envOverride(key string, detect func() bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return detect()
+}
@@ -0,0 +1,83 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// missingValue is what text/template renders for a map key that is not set.
+const missingValue = "<no value>"
+
+// warnf records a non-fatal problem found while generating. Callers decide
+// whether warnings fail the run (see --strict).
+func (g *Generator) warnf(format string, args ...any) {
+	g.warnings = append(g.warnings, fmt.Sprintf(format, args...))
+}
+
+// Warnings returns the warnings recorded by the last call to Generate.
+// The conditions reported are:
+//   - an --only pattern that matches no mapping
+//   - a destination that is a symlink (writing replaces the link target's content)
+//   - a template referencing a value that is not set (rendered as "<no value>")
+//   - a locked context (see SetContext) that differs from the detected one
+//   - an existing destination larger than the size limit, which is skipped
+//   - a mapping whose template is in none of the template sources, which is skipped
+//   - an XDG directory outside home, so mappings with that Root use the
+//     default location under home instead
+func (g *Generator) Warnings() []string {
+	return g.warnings
+}
+
+// SetOnly restricts generation to mappings whose destination (relative to
+// home) or template path matches one of the glob patterns. A pattern naming a
+// directory matches everything beneath it.
+func (g *Generator) SetOnly(patterns []string) {
+	g.only = patterns
+}
+
+// selectMappings returns the mappings selected by the --only patterns,
+// warning about patterns that match nothing.
+func (g *Generator) selectMappings(mappings []Mapping) []Mapping {
+	if len(g.only) == 0 {
+		return mappings
+	}
+
+	matched := make(map[string]bool)
+	var selected []Mapping
+	for _, m := range mappings {
+		include := false
+		for _, pattern := range g.only {
+			if matchMapping(pattern, m) {
+				matched[pattern] = true
+				include = true
+			}
+		}
+		if include {
+			selected = append(selected, m)
+		}
+	}
+
+	for _, pattern := range g.only {
+		if !matched[pattern] {
+			g.warnf("--only pattern %q matches no mapping", pattern)
+		}
+	}
+	return selected
+}
+
+// matchMapping reports whether pattern selects the mapping.
+func matchMapping(pattern string, m Mapping) bool {
+	pattern = filepath.Clean(strings.TrimPrefix(pattern, "~/"))
+	dest := m.destKey()
+
+	for _, candidate := range []string{dest, m.Template} {
+		if ok, _ := filepath.Match(pattern, candidate); ok {
+			return true
+		}
+		if strings.HasPrefix(candidate, pattern+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// xdgDir is an XDG base directory: its name as a path root and for the xdg
+// template function, its environment variable, and its spec default
+// relative to home.
+type xdgDir struct {
+	name, env, def string
+	field          func(*Context) *string
+}
+
+// xdgDirs are the XDG base directories the context resolves.
+var xdgDirs = []xdgDir{
+	{"config", "XDG_CONFIG_HOME", ".config", func(c *Context) *string { return &c.ConfigHome }},
+	{"data", "XDG_DATA_HOME", ".local/share", func(c *Context) *string { return &c.DataHome }},
+	{"state", "XDG_STATE_HOME", ".local/state", func(c *Context) *string { return &c.StateHome }},
+	{"cache", "XDG_CACHE_HOME", ".cache", func(c *Context) *string { return &c.CacheHome }},
+}
+
+// resolveXDG sets the XDG base directories from env, per the spec: a
+// variable holding an absolute path wins, and unset or relative values fall
+// back to the default under Home. With keep set, directories already set
+// (e.g. from a lockfile) are left alone.
+func (c *Context) resolveXDG(env map[string]string, keep bool) {
+	for _, d := range xdgDirs {
+		field := d.field(c)
+		if keep && *field != "" {
+			continue
+		}
+		if v := env[d.env]; v != "" && filepath.IsAbs(v) {
+			*field = filepath.Clean(v)
+		} else {
+			*field = filepath.Join(c.Home, filepath.FromSlash(d.def))
+		}
+	}
+}
+
+// XDG returns the XDG base directory with the given name ("config", "data",
+// "state" or "cache").
+func (c *Context) XDG(name string) (string, error) {
+	for _, d := range xdgDirs {
+		if d.name == name {
+			return *d.field(c), nil
+		}
+	}
+	names := make([]string, 0, len(xdgDirs))
+	for _, d := range xdgDirs {
+		names = append(names, d.name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown XDG directory %q (expected one of %s)", name, strings.Join(names, ", "))
+}
+
+// xdgRoot returns the home-relative directory for a path root that names an
+// XDG base directory, following the context. ok is false for other roots
+// and when the directory is outside home, in which case PathRoots applies.
+func (g *Generator) xdgRoot(root string) (dir string, ok bool) {
+	dir, err := g.ctx.XDG(root)
+	if err != nil || dir == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(g.ctx.Home, dir)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return rel, true
+}
+
+// resolveRoots rewrites mappings whose Root is an XDG base directory moved
+// by the environment (e.g. XDG_CONFIG_HOME=~/.xdg/config) to destinations
+// relative to home, so every use of Destination agrees with the context.
+func (g *Generator) resolveRoots(mappings []Mapping) []Mapping {
+	for i, m := range mappings {
+		if m.Root == "" {
+			continue
+		}
+		if rel, ok := g.xdgRoot(m.Root); ok && rel != filepath.FromSlash(PathRoots[m.Root]) {
+			mappings[i].Dest = filepath.Join(rel, m.Dest)
+			mappings[i].Root = ""
+		}
+	}
+	return mappings
+}
+
+// warnXDGOutsideHome warns about XDG base directories that mappings use as
+// their Root but that are outside home, so the default is used instead.
+func (g *Generator) warnXDGOutsideHome(mappings []Mapping) {
+	warned := make(map[string]bool)
+	for _, m := range mappings {
+		if m.Root == "" || warned[m.Root] {
+			continue
+		}
+		dir, err := g.ctx.XDG(m.Root)
+		if err != nil {
+			continue
+		}
+		if _, ok := g.xdgRoot(m.Root); !ok {
+			warned[m.Root] = true
+			g.warnf("XDG %s directory %s is outside home; mappings with Root %q use ~/%s", m.Root, dir, m.Root, PathRoots[m.Root])
+		}
+	}
+}
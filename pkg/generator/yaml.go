@@ -0,0 +1,599 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The YAML accepted for values and data files is the subset such files use,
+// parsed here to keep the module free of dependencies: block mappings and
+// sequences, plain, quoted and block (| and >) scalars, and flow collections
+// ([a, b] and {k: v}) on a single line. Anchors, aliases, tags, complex keys,
+// multi-line plain or quoted scalars and multiple documents are rejected.
+// Scalars resolve like YAML 1.2's core schema, with numbers decoded as
+// float64 like encoding/json does for JSON values files.
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// isYAMLFile reports whether name is a YAML file by its extension.
+func isYAMLFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// yamlLine is a line of a YAML document.
+type yamlLine struct {
+	no     int    // 1-based line number
+	indent int    // Number of leading spaces
+	text   string // Content after the indentation without comment and trailing space; "" if blank
+	raw    string // The line as written, for block scalars
+}
+
+// yamlParser parses the lines of a YAML document from the top down.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// decodeYAML decodes a YAML mapping of values. An empty document is an
+// empty mapping.
+func decodeYAML(data []byte) (map[string]any, error) {
+	p, err := newYAMLParser(string(data))
+	if err != nil {
+		return nil, err
+	}
+	line, ok := p.peek()
+	if !ok {
+		return map[string]any{}, nil
+	}
+	node, err := p.parseNode(line.indent)
+	if err != nil {
+		return nil, err
+	}
+	if line, ok := p.peek(); ok {
+		return nil, p.errorf(line, "unexpected indentation")
+	}
+	values, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("the document must be a mapping of keys to values")
+	}
+	return values, nil
+}
+
+// newYAMLParser splits content into lines, removing comments and the
+// document start marker.
+func newYAMLParser(content string) (*yamlParser, error) {
+	content = strings.TrimPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "\ufeff")
+	p := &yamlParser{}
+	started := false
+	for i, raw := range strings.Split(content, "\n") {
+		line := yamlLine{no: i + 1, raw: raw}
+		line.indent = len(raw) - len(strings.TrimLeft(raw, " "))
+		line.text = stripYAMLComment(raw[line.indent:])
+
+		switch {
+		case raw == "---" || strings.HasPrefix(raw, "--- "):
+			if started {
+				return nil, p.errorf(line, "multiple documents are not supported")
+			}
+			if rest := stripYAMLComment(raw[3:]); rest != "" {
+				return nil, p.errorf(line, "content after the document start marker is not supported")
+			}
+			line.text = ""
+		case raw == "...":
+			return p, nil
+		case line.indent == 0 && strings.HasPrefix(line.text, "%"):
+			return nil, p.errorf(line, "directives are not supported")
+		}
+		if line.text != "" {
+			started = true
+		}
+		p.lines = append(p.lines, line)
+	}
+	return p, nil
+}
+
+// stripYAMLComment removes a comment (a # at the start or after whitespace,
+// outside quotes) and trailing whitespace from s.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\', quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++ // An escaped character or quote
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(s[:i], " \t")
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t:-[{,", s[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return strings.TrimRight(s, " \t")
+}
+
+// errorf returns an error for line.
+func (p *yamlParser) errorf(line yamlLine, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", line.no, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next non-blank line without consuming it.
+func (p *yamlParser) peek() (yamlLine, bool) {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+	if p.pos == len(p.lines) {
+		return yamlLine{}, false
+	}
+	return p.lines[p.pos], true
+}
+
+// next returns the next line of a block at indent, or false at the end of
+// the block.
+func (p *yamlParser) next(indent int) (yamlLine, bool, error) {
+	line, ok := p.peek()
+	if !ok || line.indent < indent {
+		return yamlLine{}, false, nil
+	}
+	if line.indent > indent {
+		return yamlLine{}, false, p.errorf(line, "unexpected indentation")
+	}
+	if strings.HasPrefix(line.text, "\t") {
+		return yamlLine{}, false, p.errorf(line, "tabs are not allowed in indentation")
+	}
+	return line, true, nil
+}
+
+// parseNode parses the block node starting at the next line, indented by
+// indent.
+func (p *yamlParser) parseNode(indent int) (any, error) {
+	line, _, err := p.next(indent)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLItem(line.text) {
+		return p.parseSequence(indent)
+	}
+	if _, _, isKey, err := splitYAMLKey(line.text); err != nil {
+		return nil, p.errorf(line, "%v", err)
+	} else if isKey {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return p.parseValue(line, indent, line.text, false)
+}
+
+// parseMapping parses the "key: value" lines of a block mapping at indent.
+func (p *yamlParser) parseMapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for {
+		line, ok, err := p.next(indent)
+		if err != nil || !ok {
+			return m, err
+		}
+		key, rest, isKey, err := splitYAMLKey(line.text)
+		if err != nil {
+			return nil, p.errorf(line, "%v", err)
+		}
+		if !isKey {
+			return nil, p.errorf(line, "expected \"key: value\"")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf(line, "duplicate key %q", key)
+		}
+		p.pos++
+		if m[key], err = p.parseValue(line, indent, rest, true); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseSequence parses the "- item" lines of a block sequence at indent.
+func (p *yamlParser) parseSequence(indent int) ([]any, error) {
+	seq := []any{}
+	for {
+		line, ok, err := p.next(indent)
+		if err != nil || !ok || !isYAMLItem(line.text) {
+			return seq, err
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			value, err := p.parseValue(line, indent, "", false)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, value)
+			continue
+		}
+
+		// The item's content is a node indented to its column, so
+		// "- key: value" starts a mapping and "- - a" a nested sequence
+		item := &p.lines[p.pos]
+		item.indent += len(item.text) - len(rest)
+		item.text = rest
+		var value any
+		if _, _, isKey, _ := splitYAMLKey(rest); isKey || isYAMLItem(rest) {
+			value, err = p.parseNode(item.indent)
+		} else {
+			p.pos++
+			value, err = p.parseValue(*item, indent, rest, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, value)
+	}
+}
+
+// parseValue parses the value rest following a key or item marker on line
+// of a block at indent. An empty rest is followed by a nested block, which in
+// a mapping may be a sequence at the same indentation.
+func (p *yamlParser) parseValue(line yamlLine, indent int, rest string, inMapping bool) (any, error) {
+	switch {
+	case rest == "":
+		next, ok := p.peek()
+		if ok && next.indent > indent {
+			return p.parseNode(next.indent)
+		}
+		if ok && inMapping && next.indent == indent && isYAMLItem(next.text) {
+			return p.parseSequence(indent)
+		}
+		return nil, nil
+	case rest[0] == '|' || rest[0] == '>':
+		return p.parseBlockScalar(line, indent, rest)
+	}
+
+	value, err := parseYAMLInline(rest)
+	if err != nil {
+		return nil, p.errorf(line, "%v", err)
+	}
+	if next, ok := p.peek(); ok && next.indent > indent {
+		return nil, p.errorf(next, "unexpected indentation (multi-line plain scalars are not supported; use | or >)")
+	}
+	return value, nil
+}
+
+// parseBlockScalar reads the literal (|) or folded (>) block scalar whose
+// header is on line, with its content indented more than indent.
+func (p *yamlParser) parseBlockScalar(line yamlLine, indent int, header string) (string, error) {
+	chomp := header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.errorf(line, "block scalar header %q is not supported (only |, |-, |+, >, >- and >+)", header)
+	}
+
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos].raw
+		if strings.TrimSpace(raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(raw) - len(strings.TrimLeft(raw, " "))
+		if blockIndent < 0 {
+			if n <= indent {
+				break
+			}
+			blockIndent = n
+		}
+		if n < blockIndent {
+			break
+		}
+		lines = append(lines, raw[blockIndent:])
+	}
+
+	trailing := 0
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing++
+	}
+	body := lines[:len(lines)-trailing]
+
+	var content string
+	if header[0] == '|' {
+		content = strings.Join(body, "\n")
+	} else {
+		content = foldYAML(body)
+	}
+	switch {
+	case chomp == "-" || (content == "" && chomp == ""):
+		return content, nil
+	case chomp == "+":
+		return content + strings.Repeat("\n", trailing+1), nil
+	}
+	return content + "\n", nil
+}
+
+// foldYAML joins the lines of a folded block scalar: line breaks between
+// text become spaces and each empty line a newline, while lines indented
+// further keep their breaks.
+func foldYAML(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case line == "":
+				sb.WriteByte('\n')
+			case prev == "":
+			case strings.HasPrefix(line, " ") || strings.HasPrefix(prev, " "):
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// isYAMLItem reports whether text is a block sequence item.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a "key: value" line into its key and the rest,
+// reporting false if text is not a mapping entry.
+func splitYAMLKey(text string) (key, rest string, ok bool, err error) {
+	if text == "" {
+		return "", "", false, nil
+	}
+	switch text[0] {
+	case '"', '\'':
+		key, n, err := parseYAMLQuoted(text)
+		if err != nil {
+			return "", "", false, err
+		}
+		after := strings.TrimLeft(text[n:], " ")
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		return key, strings.TrimSpace(after[1:]), true, nil
+	case '[', '{':
+		return "", "", false, nil
+	case '?':
+		if text == "?" || strings.HasPrefix(text, "? ") {
+			return "", "", false, fmt.Errorf("complex keys are not supported")
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			key = strings.TrimRight(text[:i], " ")
+			if key == "" {
+				return "", "", false, fmt.Errorf("missing key before %q", ":")
+			}
+			return key, strings.TrimSpace(text[i+1:]), true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// parseYAMLInline parses a value written on a single line: a flow
+// collection, a quoted scalar or a plain scalar.
+func parseYAMLInline(s string) (any, error) {
+	switch s[0] {
+	case '[', '{', '"', '\'':
+		value, n, err := parseYAMLFlow(s, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n != len(s) {
+			return nil, fmt.Errorf("unexpected %q after %s", s[n:], s[:n])
+		}
+		return value, nil
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported (%s)", s)
+	}
+	if strings.Contains(s, ": ") || strings.HasSuffix(s, ":") {
+		return nil, fmt.Errorf("value %q contains \": \"; quote it", s)
+	}
+	return resolveYAMLScalar(s), nil
+}
+
+// parseYAMLFlow parses the flow node starting at s[i] and returns it with
+// the index just past it.
+func parseYAMLFlow(s string, i int) (any, int, error) {
+	switch s[i] {
+	case '"', '\'':
+		value, n, err := parseYAMLQuoted(s[i:])
+		return value, i + n, err
+	case '&', '*', '!':
+		return nil, 0, fmt.Errorf("anchors, aliases and tags are not supported (%s)", s[i:])
+	case '[', '{':
+	default:
+		end := i
+		for end < len(s) && strings.IndexByte(",]}", s[end]) < 0 {
+			end++
+		}
+		return resolveYAMLScalar(strings.TrimSpace(s[i:end])), end, nil
+	}
+
+	mapping := s[i] == '{'
+	closing := byte(']')
+	if mapping {
+		closing = '}'
+	}
+	seq := []any{}
+	m := make(map[string]any)
+	i++
+	for {
+		i = skipYAMLSpaces(s, i)
+		if i == len(s) {
+			return nil, 0, fmt.Errorf("unterminated flow collection %s (it must end on the same line)", s)
+		}
+		if s[i] == closing {
+			i++
+			break
+		}
+
+		if mapping {
+			key, next, err := parseYAMLFlowKey(s, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			if _, dup := m[key]; dup {
+				return nil, 0, fmt.Errorf("duplicate key %q", key)
+			}
+			var value any
+			if i = skipYAMLSpaces(s, next); i < len(s) && s[i] != ',' && s[i] != closing {
+				if value, i, err = parseYAMLFlow(s, i); err != nil {
+					return nil, 0, err
+				}
+			}
+			m[key] = value
+		} else {
+			value, next, err := parseYAMLFlow(s, i)
+			if err != nil {
+				return nil, 0, err
+			}
+			seq = append(seq, value)
+			i = next
+		}
+
+		i = skipYAMLSpaces(s, i)
+		switch {
+		case i < len(s) && s[i] == ',':
+			i++
+		case i < len(s) && s[i] == closing:
+		case i == len(s):
+			return nil, 0, fmt.Errorf("unterminated flow collection %s (it must end on the same line)", s)
+		default:
+			return nil, 0, fmt.Errorf("expected %q or %q at %q", ",", string(closing), s[i:])
+		}
+	}
+	if mapping {
+		return m, i, nil
+	}
+	return seq, i, nil
+}
+
+// parseYAMLFlowKey parses a key of a flow mapping at s[i] up to and
+// including its colon.
+func parseYAMLFlowKey(s string, i int) (string, int, error) {
+	var key string
+	if s[i] == '"' || s[i] == '\'' {
+		k, n, err := parseYAMLQuoted(s[i:])
+		if err != nil {
+			return "", 0, err
+		}
+		key, i = k, skipYAMLSpaces(s, i+n)
+	} else {
+		end := i
+		for end < len(s) && s[end] != ':' && strings.IndexByte(",[]{}", s[end]) < 0 {
+			end++
+		}
+		key, i = strings.TrimSpace(s[i:end]), end
+	}
+	if i == len(s) || s[i] != ':' || key == "" {
+		return "", 0, fmt.Errorf("expected \"key: value\" in %s", s)
+	}
+	return key, i + 1, nil
+}
+
+func skipYAMLSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// parseYAMLQuoted parses the single- or double-quoted scalar at the start of
+// s and returns it with the length of its source.
+func parseYAMLQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			sb.WriteByte('\'')
+			i++
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && quote == '"':
+			r, n, err := unescapeYAML(s[i:])
+			if err != nil {
+				return "", 0, err
+			}
+			sb.WriteString(r)
+			i += n - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string %s (it must end on the same line)", s)
+}
+
+// yamlEscapes maps the single-character escapes of double-quoted scalars.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unescapeYAML decodes the escape sequence at the start of s and returns it
+// with the length of its source.
+func unescapeYAML(s string) (string, int, error) {
+	if len(s) < 2 {
+		return "", 0, fmt.Errorf("unterminated escape sequence")
+	}
+	if r, ok := yamlEscapes[s[1]]; ok {
+		return r, 2, nil
+	}
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[1]]
+	if digits == 0 || len(s) < 2+digits {
+		return "", 0, fmt.Errorf("invalid escape sequence %q", s[:min(len(s), 2+digits)])
+	}
+	code, err := strconv.ParseUint(s[2:2+digits], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return "", 0, fmt.Errorf("invalid escape sequence %q", s[:2+digits])
+	}
+	return string(rune(code)), 2 + digits, nil
+}
+
+// resolveYAMLScalar returns the value of a plain scalar: null, a boolean, a
+// number or otherwise the string itself.
+func resolveYAMLScalar(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	switch {
+	case yamlInt.MatchString(s):
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return float64(n)
+		}
+	case strings.HasPrefix(s, "0x"):
+		if n, err := strconv.ParseUint(s[2:], 16, 64); err == nil {
+			return float64(n)
+		}
+	case strings.HasPrefix(s, "0o"):
+		if n, err := strconv.ParseUint(s[2:], 8, 64); err == nil {
+			return float64(n)
+		}
+	}
+	if yamlFloat.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    map[string]any
+		wantErr string // Substring of the expected error, "" for none
+	}{
+		{name: "empty", yaml: "# nothing yet\n", want: map[string]any{}},
+		{
+			name: "scalars",
+			yaml: "---\neditor: nvim  # the default\nport: 8080\nratio: 0.5\nmode: 0o644\nenabled: true\nunset: ~\nempty:\n" +
+				"version: \"1.10\"\nquoted: 'it''s # not a comment'\nescaped: \"tab\\there \\u00e9\"\nurl: https://example.com/a#b\n",
+			want: map[string]any{
+				"editor": "nvim", "port": float64(8080), "ratio": 0.5, "mode": float64(0o644), "enabled": true,
+				"unset": nil, "empty": nil, "version": "1.10", "quoted": "it's # not a comment",
+				"escaped": "tab\there é", "url": "https://example.com/a#b",
+			},
+		},
+		{
+			name: "nested mappings and sequences",
+			yaml: "git:\n  email: me@example.com\n  signing:\n    key: ABC\naliases:\n  - name: gs\n    cmd: git status\n  - name: gl\n" +
+				"    cmd: git pull\npaths:\n- ~/bin\n- - nested\n  - list\nflow: [a, 'b, c', {k: v, n: 1}]\nmap: {x: [1, 2], y: }\n",
+			want: map[string]any{
+				"git": map[string]any{"email": "me@example.com", "signing": map[string]any{"key": "ABC"}},
+				"aliases": []any{
+					map[string]any{"name": "gs", "cmd": "git status"},
+					map[string]any{"name": "gl", "cmd": "git pull"},
+				},
+				"paths": []any{"~/bin", []any{"nested", "list"}},
+				"flow":  []any{"a", "b, c", map[string]any{"k": "v", "n": float64(1)}},
+				"map":   map[string]any{"x": []any{float64(1), float64(2)}, "y": nil},
+			},
+		},
+		{
+			name: "block scalars",
+			yaml: "literal: |\n  line one\n    indented\n\n  line three\nfolded: >-\n  folded\n  text\n\n  paragraph\nkept: |+\n  keep\n\nlast: done\n",
+			want: map[string]any{
+				"literal": "line one\n  indented\n\nline three\n",
+				"folded":  "folded text\nparagraph",
+				"kept":    "keep\n\n",
+				"last":    "done",
+			},
+		},
+		{name: "top-level sequence", yaml: "- a\n", wantErr: "the document must be a mapping"},
+		{name: "duplicate key", yaml: "a: 1\nb: 2\na: 3\n", wantErr: `line 3: duplicate key "a"`},
+		{name: "bad indentation", yaml: "a:\n  b: 1\n   c: 2\n", wantErr: "line 3: unexpected indentation"},
+		{name: "tab indentation", yaml: "a:\n\tb: 1\n", wantErr: "line 2: tabs are not allowed in indentation"},
+		{name: "multi-line plain scalar", yaml: "a: one\n  two\n", wantErr: "line 2: unexpected indentation (multi-line plain scalars"},
+		{name: "unterminated quote", yaml: "a: \"open\n", wantErr: "line 1: unterminated quoted string"},
+		{name: "unterminated flow", yaml: "a: [1, 2\n", wantErr: "line 1: unterminated flow collection"},
+		{name: "alias", yaml: "a: &x 1\nb: *x\n", wantErr: "line 1: anchors, aliases and tags are not supported"},
+		{name: "multiple documents", yaml: "a: 1\n---\nb: 2\n", wantErr: "line 2: multiple documents are not supported"},
+		{name: "colon in plain value", yaml: "a: b: c\n", wantErr: `line 1: value "b: c" contains ": "; quote it`},
+		{name: "not a key", yaml: "a: 1\njust text\n", wantErr: `line 2: expected "key: value"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeYAML([]byte(tt.yaml))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeYAML error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeYAML =\n%#v\nwant:\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadValuesYAML(t *testing.T) {
+	g := newTestGenerator(t, fstest.MapFS{
+		"templates/defaults.json":       {Data: []byte(`{"editor": "nvim", "git": {"email": "json@example.com", "pull": "rebase"}}`)},
+		"templates/defaults.yaml":       {Data: []byte("git:\n  email: yaml@example.com\n")},
+		"templates/defaults.linux.yaml": {Data: []byte("shell: zsh\n")},
+		"templates/data.yml":            {Data: []byte("aliases:\n  - {name: gs, cmd: git status}\n")},
+	})
+	dir := t.TempDir()
+	values := filepath.Join(dir, "values.yaml")
+	writeTestFile(t, values, "editor: hx\n")
+	writeTestFile(t, filepath.Join(dir, "values.linux.yaml"), "git:\n  pull: merge\n")
+
+	if err := g.LoadValues([]string{values}, []string{"shell=fish"}); err != nil {
+		t.Fatalf("LoadValues: %v", err)
+	}
+	want := map[string]any{
+		"editor": "hx",
+		"shell":  "fish",
+		"git":    map[string]any{"email": "yaml@example.com", "pull": "merge"},
+	}
+	if !reflect.DeepEqual(g.ctx.Set, want) {
+		t.Errorf(".Set = %#v, want %#v", g.ctx.Set, want)
+	}
+
+	if err := g.LoadData(nil); err != nil {
+		t.Fatalf("LoadData: %v", err)
+	}
+	if want := []any{map[string]any{"name": "gs", "cmd": "git status"}}; !reflect.DeepEqual(g.ctx.Data["aliases"], want) {
+		t.Errorf(".Data.aliases = %#v, want %#v", g.ctx.Data["aliases"], want)
+	}
+
+	broken := filepath.Join(dir, "broken.yml")
+	writeTestFile(t, broken, "a:\n  b: 1\n c: 2\n")
+	if _, err := LoadValuesFile(broken); err == nil || !strings.Contains(err.Error(), "broken.yml: line 3:") {
+		t.Errorf("LoadValuesFile error = %v, want one naming the file and line", err)
+	}
+}
+
+// writeTestFile writes content to path.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// Manifest records the files homestruct manages in a home directory, so
+// later runs can tell which files they wrote.
+type Manifest struct {
+	Files map[string]Entry `json:"files"` // Keyed by destination path relative to home
+}
+
+// Entry describes a managed file as last written.
+type Entry struct {
+	Template string    `json:"template"`
+	SHA256   string    `json:"sha256"`
+	Input    string    `json:"input,omitempty"` // Hash of the render input, for change detection
+	Updated  time.Time `json:"updated"`
+}
+
+// Path returns the location of the manifest for the given home directory.
+func Path(homeDir string) string {
+	return filepath.Join(homeDir, ".config", "homestruct", "manifest.json")
+}
+
+// Load reads the manifest for homeDir. A missing manifest is returned empty.
+func Load(homeDir string) (*Manifest, error) {
+	m := &Manifest{Files: map[string]Entry{}}
+
+	data, err := os.ReadFile(Path(homeDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", Path(homeDir), err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]Entry{}
+	}
+	return m, nil
+}
+
+// Save writes the manifest for homeDir. The file and any directories created
+// for it are assigned to o.
+func (m *Manifest) Save(homeDir string, o *owner.Owner) error {
+	path := Path(homeDir)
+	if err := o.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return o.Chown(path)
+}
+
+// Record marks relPath as managed, generated from template with content
+// from a render input with hash input (empty if unknown).
+func (m *Manifest) Record(relPath, template, content, input string) {
+	m.Files[filepath.ToSlash(relPath)] = Entry{
+		Template: template,
+		SHA256:   Hash([]byte(content)),
+		Input:    input,
+		Updated:  time.Now(),
+	}
+}
+
+// Remove forgets relPath.
+func (m *Manifest) Remove(relPath string) {
+	delete(m.Files, filepath.ToSlash(relPath))
+}
+
+// Paths returns the managed paths relative to home, sorted.
+func (m *Manifest) Paths() []string {
+	paths := make([]string, 0, len(m.Files))
+	for p := range m.Files {
+		paths = append(paths, filepath.FromSlash(p))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Hash returns the hex SHA-256 of content, as stored in entries.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
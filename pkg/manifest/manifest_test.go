@@ -0,0 +1,58 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	home := t.TempDir()
+
+	m, err := Load(home)
+	if err != nil {
+		t.Fatalf("Load without a manifest: %v", err)
+	}
+	if len(m.Files) != 0 {
+		t.Fatalf("missing manifest loaded %d files, want none", len(m.Files))
+	}
+
+	m.Record(filepath.Join(".config", "git", "config"), "templates/git/config.tmpl", "[core]\n", "input")
+	m.Record(".zshrc", "templates/zsh/.zshrc.tmpl", "zsh\n", "")
+	m.Record(".bashrc", "templates/bash/.bashrc.tmpl", "bash\n", "")
+	m.Remove(".bashrc")
+	if err := m.Save(home, nil); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := Load(home)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []string{filepath.Join(".config", "git", "config"), ".zshrc"}
+	slices.Sort(want)
+	if got := loaded.Paths(); !slices.Equal(got, want) {
+		t.Errorf("Paths = %q, want %q", got, want)
+	}
+	e, ok := loaded.Files[".config/git/config"]
+	if !ok {
+		t.Fatalf("entries are not keyed by slash-separated paths: %v", loaded.Files)
+	}
+	if e.Template != "templates/git/config.tmpl" || e.SHA256 != Hash([]byte("[core]\n")) || e.Input != "input" {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Dir(Path(home)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(Path(home), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(home); err == nil {
+		t.Error("Load of a corrupt manifest succeeded")
+	}
+}
@@ -0,0 +1,118 @@
+package owner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Owner identifies the user and group that written files are assigned to.
+// A nil *Owner leaves ownership untouched.
+type Owner struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// Parse resolves a "user[:group]" specification to numeric ids. Both parts may
+// be names or numeric ids. Without a group, the user's primary group is used.
+func Parse(spec string) (*Owner, error) {
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+	if userPart == "" {
+		return nil, fmt.Errorf("invalid owner %q (expected user[:group])", spec)
+	}
+
+	u, err := lookupUser(userPart)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("user %s has non-numeric uid %q", userPart, u.Uid)
+	}
+
+	gidStr := u.Gid
+	if hasGroup && groupPart != "" {
+		gidStr, err = lookupGroupID(groupPart)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return nil, fmt.Errorf("group for %s has non-numeric gid %q", spec, gidStr)
+	}
+
+	return &Owner{UID: uid, GID: gid}, nil
+}
+
+// lookupUser resolves a user by name or numeric id.
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		if u, err := user.LookupId(name); err == nil {
+			return u, nil
+		}
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown user %q: %w", name, err)
+	}
+	return u, nil
+}
+
+// lookupGroupID resolves a group name or numeric id to a numeric id string.
+func lookupGroupID(name string) (string, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return name, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown group %q: %w", name, err)
+	}
+	return g.Gid, nil
+}
+
+// Chown assigns path to the owner. It is a no-op for a nil Owner and on
+// platforms without Unix ownership.
+func (o *Owner) Chown(path string) error {
+	if o == nil || runtime.GOOS == "windows" {
+		return nil
+	}
+	if err := os.Lchown(path, o.UID, o.GID); err != nil {
+		return fmt.Errorf("failed to change owner of %s: %w", path, err)
+	}
+	return nil
+}
+
+// MkdirAll creates dir and any missing parents like os.MkdirAll, assigning
+// each directory it creates to the owner. Existing directories are untouched.
+func (o *Owner) MkdirAll(dir string, perm os.FileMode) error {
+	// Find the directories that do not exist yet, deepest first
+	var missing []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := o.Chown(missing[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
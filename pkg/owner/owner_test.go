@@ -0,0 +1,65 @@
+package owner
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no numeric user ids")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+
+	tests := []struct {
+		spec string
+		want Owner
+	}{
+		{current.Uid, Owner{UID: uid, GID: gid}},
+		{current.Username, Owner{UID: uid, GID: gid}},
+		{current.Uid + ":", Owner{UID: uid, GID: gid}},
+		{current.Uid + ":12345", Owner{UID: uid, GID: 12345}},
+	}
+	for _, tt := range tests {
+		o, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if *o != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.spec, *o, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", ":" + current.Gid, "no-such-user-homestruct"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	var o *Owner
+	if runtime.GOOS != "windows" {
+		o = &Owner{UID: os.Getuid(), GID: os.Getgid()}
+	}
+	if err := o.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("%s was not created: %v", dir, err)
+	}
+	if err := o.MkdirAll(dir, 0755); err != nil {
+		t.Errorf("MkdirAll of an existing directory: %v", err)
+	}
+}
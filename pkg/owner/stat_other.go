@@ -0,0 +1,10 @@
+//go:build !unix
+
+package owner
+
+import "os"
+
+// Of returns nil: file ownership is not reported on this platform.
+func Of(info os.FileInfo) *Owner {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package owner
+
+import (
+	"os"
+	"syscall"
+)
+
+// Of returns the owner of the file described by info, or nil if the
+// platform does not report one.
+func Of(info os.FileInfo) *Owner {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return &Owner{UID: int(st.Uid), GID: int(st.Gid)}
+}
@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Limits on documents downloaded by Fetcher.
+const (
+	MaxFetchSize = 1 << 20 // Largest document accepted, 1 MiB
+	fetchTimeout = 30 * time.Second
+)
+
+// Fetcher downloads documents over HTTP for the fetch template function and
+// caches them on disk, so configs can embed content from canonical online
+// sources without downloading it on every run.
+type Fetcher struct {
+	TTL      time.Duration // Age after which a cached document is downloaded again, 0 to always download
+	Offline  bool          // Only use cached documents, whatever their age
+	CacheDir string        // Directory holding cached documents, empty for the default
+	Client   *http.Client  // Client used for downloads, nil for a client with a timeout
+}
+
+// Fetch returns the document at rawURL, an http or https URL, from the
+// cache if it is younger than the TTL and downloaded otherwise. Offline, a
+// cached copy of any age is used and a missing one is an error. Documents
+// larger than MaxFetchSize are rejected.
+func (f Fetcher) Fetch(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid fetch URL %q (expected http or https)", rawURL)
+	}
+	path, err := f.cachePath(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(path); err == nil && (f.Offline || (f.TTL > 0 && time.Since(info.ModTime()) <= f.TTL)) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read cached %s: %w", rawURL, err)
+		}
+		return string(data), nil
+	}
+	if f.Offline {
+		return "", fmt.Errorf("%s is not cached and --offline is set", rawURL)
+	}
+
+	data, err := f.download(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	if err := writeCache(path, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// download returns the body of a GET request for rawURL.
+func (f Fetcher) download(rawURL string) ([]byte, error) {
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: fetchTimeout}
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxFetchSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFetchSize {
+		return nil, fmt.Errorf("document exceeds %d bytes", MaxFetchSize)
+	}
+	return data, nil
+}
+
+// cachePath returns the file the document at rawURL is cached in.
+func (f Fetcher) cachePath(rawURL string) (string, error) {
+	dir := f.CacheDir
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine cache directory: %w", err)
+		}
+		dir = filepath.Join(base, "homestruct", "fetch")
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])), nil
+}
+
+// writeCache replaces the cached document at path with data. It writes a
+// temporary file first so concurrent readers never see a partial document.
+func writeCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("failed to cache download: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err = errors.Join(err, tmp.Close()); err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to cache download: %w", err)
+	}
+	return nil
+}
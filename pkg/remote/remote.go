@@ -0,0 +1,276 @@
+package remote
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultTTL is how long a downloaded template tarball is reused before it
+// is fetched again.
+const DefaultTTL = 24 * time.Hour
+
+// maxArchiveSize bounds the size of a downloaded tarball.
+const maxArchiveSize = 256 << 20
+
+const (
+	archiveName = "archive.tar.gz"
+	rootName    = "root"
+)
+
+// Source is a gzipped tarball of templates served over HTTP.
+type Source struct {
+	URL      string
+	SHA256   string        // Expected hex digest of the tarball, empty to skip verification
+	TTL      time.Duration // Age after which the cached copy is fetched again, 0 to always fetch
+	Offline  bool          // Only use the cached copy, whatever its age
+	CacheDir string        // Directory holding cached downloads, empty for DefaultCacheDir
+	Client   *http.Client  // Client used for the download, nil for a client with a timeout
+}
+
+// DefaultCacheDir returns the directory downloaded templates are cached in,
+// under the user's cache directory (e.g. ~/.cache/homestruct/templates).
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine cache directory: %w", err)
+	}
+	return filepath.Join(dir, "homestruct", "templates"), nil
+}
+
+// Open fetches the tarball if the cached copy is missing or stale and returns
+// a filesystem with the templates under a top-level "templates" directory.
+func (s Source) Open() (fs.FS, error) {
+	dir, err := s.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	return os.DirFS(dir), nil
+}
+
+// Fetch fetches the tarball if the cached copy is missing or stale and
+// returns the extracted directory containing "templates".
+func (s Source) Fetch() (string, error) {
+	cacheDir := s.CacheDir
+	if cacheDir == "" {
+		var err error
+		if cacheDir, err = DefaultCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256([]byte(s.URL))
+	entryDir := filepath.Join(cacheDir, hex.EncodeToString(sum[:8]))
+	rootDir := filepath.Join(entryDir, rootName)
+
+	if s.fresh(entryDir) {
+		return templateRoot(rootDir)
+	}
+	if s.Offline {
+		return "", fmt.Errorf("templates from %s are not cached and --offline is set", s.URL)
+	}
+
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	archive, err := s.download(entryDir)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive)
+
+	tmpRoot, err := os.MkdirTemp(entryDir, rootName+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	if err := extract(archive, tmpRoot); err != nil {
+		os.RemoveAll(tmpRoot)
+		return "", err
+	}
+	if _, err := templateRoot(tmpRoot); err != nil {
+		os.RemoveAll(tmpRoot)
+		return "", err
+	}
+
+	if err := os.RemoveAll(rootDir); err != nil {
+		os.RemoveAll(tmpRoot)
+		return "", fmt.Errorf("failed to remove stale templates: %w", err)
+	}
+	if err := os.Rename(tmpRoot, rootDir); err != nil {
+		os.RemoveAll(tmpRoot)
+		return "", fmt.Errorf("failed to cache templates: %w", err)
+	}
+	if err := os.Rename(archive, filepath.Join(entryDir, archiveName)); err != nil {
+		return "", fmt.Errorf("failed to cache template archive: %w", err)
+	}
+	return templateRoot(rootDir)
+}
+
+// fresh reports whether the cached download in entryDir is younger than the
+// TTL, or of any age when offline, and, when a checksum is expected,
+// matches it.
+func (s Source) fresh(entryDir string) bool {
+	archive := filepath.Join(entryDir, archiveName)
+	info, err := os.Stat(archive)
+	if err != nil || (!s.Offline && (s.TTL <= 0 || time.Since(info.ModTime()) > s.TTL)) {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(entryDir, rootName)); err != nil {
+		return false
+	}
+	if s.SHA256 == "" {
+		return true
+	}
+	got, err := hashFile(archive)
+	return err == nil && strings.EqualFold(got, s.SHA256)
+}
+
+// download writes the tarball to a temporary file in dir, verifies its
+// checksum and returns the file's path.
+func (s Source) download(dir string) (string, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download templates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download templates from %s: %s", s.URL, resp.Status)
+	}
+
+	f, err := os.CreateTemp(dir, archiveName+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create download file: %w", err)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, maxArchiveSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxArchiveSize {
+		err = fmt.Errorf("archive exceeds %d bytes", maxArchiveSize)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to download templates: %w", err)
+	}
+
+	if s.SHA256 != "" {
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, s.SHA256) {
+			os.Remove(f.Name())
+			return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", s.URL, got, s.SHA256)
+		}
+	}
+	return f.Name(), nil
+}
+
+// extract unpacks a gzipped tarball into dir. Only regular files and
+// directories are extracted; entries escaping dir are rejected.
+func extract(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open template archive: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read template archive: %w", err)
+	}
+	defer zr.Close()
+
+	return ExtractTar(zr, dir)
+}
+
+// ExtractTar unpacks an uncompressed tar stream into dir. Only regular files
+// and directories are extracted; entries escaping dir are rejected.
+func ExtractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read template archive: %w", err)
+		}
+
+		name := filepath.FromSlash(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("template archive entry %q escapes the extraction directory", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+			}
+			if err := writeFile(target, tr); err != nil {
+				return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+			}
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// templateRoot returns the directory under dir that contains "templates".
+// Besides dir itself, this accepts a single top-level directory (as in
+// GitHub archive tarballs) and the repository layout cmd/homestruct/templates.
+func templateRoot(dir string) (string, error) {
+	candidates := []string{dir}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		candidates = append(candidates, filepath.Join(dir, entries[0].Name()))
+	}
+	for _, c := range candidates {
+		for _, root := range []string{c, filepath.Join(c, "cmd", "homestruct")} {
+			if info, err := os.Stat(filepath.Join(root, "templates")); err == nil && info.IsDir() {
+				return root, nil
+			}
+		}
+	}
+	return "", errors.New("template archive has no templates directory")
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
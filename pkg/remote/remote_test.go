@@ -0,0 +1,80 @@
+package remote
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarball returns an uncompressed tar stream with a regular file for each
+// name, holding the name as its content.
+func tarball(t *testing.T, names ...string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractTar(t *testing.T) {
+	dir := t.TempDir()
+	if err := ExtractTar(tarball(t, "./repo/templates/a.tmpl", "repo/README.md"), dir); err != nil {
+		t.Fatalf("ExtractTar: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "repo", "templates", "a.tmpl"))
+	if err != nil || string(data) != "./repo/templates/a.tmpl" {
+		t.Errorf("extracted a.tmpl = %q (%v)", data, err)
+	}
+	if root, err := templateRoot(dir); err != nil || root != filepath.Join(dir, "repo") {
+		t.Errorf("templateRoot = %q (%v), want %q", root, err, filepath.Join(dir, "repo"))
+	}
+
+	for _, name := range []string{"../escape", "/abs", "a/../../escape"} {
+		err := ExtractTar(tarball(t, name), t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "escapes the extraction directory") {
+			t.Errorf("ExtractTar(%q) error = %v, want an escape error", name, err)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	values := map[string]any{}
+	setPath(values, "git/email", "me@example.com")
+	setPath(values, "git", "ignored, git is a folder")
+	setPath(values, "editor", "vim")
+	setPath(values, "", "ignored")
+
+	git, ok := values["git"].(map[string]any)
+	if !ok || git["email"] != "me@example.com" {
+		t.Errorf("git = %#v, want the nested email", values["git"])
+	}
+	if values["editor"] != "vim" || len(values) != 2 {
+		t.Errorf("values = %#v", values)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct{ prefix, want string }{
+		{"homestruct/", "homestruct0"},
+		{"a\xff", "b"},
+		{"", "\x00"},
+	}
+	for _, tt := range tests {
+		if got := string(prefixEnd([]byte(tt.prefix))); got != tt.want {
+			t.Errorf("prefixEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ValueStore is a key-value backend that shared template values are read
+// from. The URL scheme selects the backend:
+//
+//   - consul://host:8500/prefix reads every key under prefix from Consul's
+//     KV HTTP API
+//   - etcd://host:2379/prefix reads every key under prefix from etcd's v3
+//     JSON gateway
+//   - http:// and https:// URLs return a JSON object of values
+//
+// Keys are taken relative to the prefix, and "/" in keys creates nested
+// values (team/proxy/http becomes {{ .Remote.proxy.http }} for prefix team).
+type ValueStore struct {
+	URL      string
+	CacheDir string       // Directory holding the last fetched values, empty for the default
+	Client   *http.Client // Client used for requests, nil for a client with a timeout
+}
+
+// Fetch reads the values from the backend and caches them for Cached.
+func (s ValueStore) Fetch() (map[string]any, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote values URL: %w", err)
+	}
+
+	var values map[string]any
+	switch u.Scheme {
+	case "consul":
+		values, err = s.fetchConsul(u)
+	case "etcd":
+		values, err = s.fetchEtcd(u)
+	case "http", "https":
+		values, err = s.fetchJSON(u)
+	default:
+		return nil, fmt.Errorf("unsupported remote values URL scheme %q (expected consul, etcd, http or https)", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch remote values from %s: %w", s.URL, err)
+	}
+
+	if path, err := s.cachePath(); err == nil {
+		if data, err := json.Marshal(values); err == nil {
+			if os.MkdirAll(filepath.Dir(path), 0700) == nil {
+				os.WriteFile(path, data, 0600)
+			}
+		}
+	}
+	return values, nil
+}
+
+// Cached returns the values saved by the last successful Fetch and when they
+// were fetched.
+func (s ValueStore) Cached() (map[string]any, time.Time, error) {
+	path, err := s.cachePath()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("no cached remote values: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read cached remote values: %w", err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse cached remote values: %w", err)
+	}
+	return values, info.ModTime(), nil
+}
+
+// cachePath returns the file the values for s.URL are cached in.
+func (s ValueStore) cachePath() (string, error) {
+	dir := s.CacheDir
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine cache directory: %w", err)
+		}
+		dir = filepath.Join(base, "homestruct", "values")
+	}
+	sum := sha256.Sum256([]byte(s.URL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// fetchConsul reads the keys under the URL path with a recursive GET on
+// /v1/kv. A token can be passed in the CONSUL_HTTP_TOKEN environment variable.
+func (s ValueStore) fetchConsul(u *url.URL) (map[string]any, error) {
+	prefix := strings.TrimPrefix(u.Path, "/")
+	endpoint := url.URL{Scheme: "http", Host: u.Host, Path: "/v1/kv/" + prefix, RawQuery: "recurse=true"}
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	var entries []struct {
+		Key   string
+		Value []byte // Base64 in the response, decoded by encoding/json
+	}
+	// Consul answers 404 when nothing is stored under the prefix
+	found, err := s.do(req, &entries)
+	if err != nil || !found {
+		return map[string]any{}, err
+	}
+
+	values := make(map[string]any)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Key, "/") {
+			continue // Folder placeholder
+		}
+		setPath(values, relativeKey(e.Key, prefix), string(e.Value))
+	}
+	return values, nil
+}
+
+// fetchEtcd reads the keys under the URL path with a range request on the
+// v3 JSON gateway.
+func (s ValueStore) fetchEtcd(u *url.URL) (map[string]any, error) {
+	prefix := strings.TrimPrefix(u.Path, "/")
+	body, err := json.Marshal(map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(prefixEnd([]byte(prefix))),
+	})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := url.URL{Scheme: "http", Host: u.Host, Path: "/v3/kv/range"}
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Kvs []struct {
+			Key   []byte `json:"key"`
+			Value []byte `json:"value"`
+		} `json:"kvs"`
+	}
+	if _, err := s.do(req, &resp); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]any)
+	for _, kv := range resp.Kvs {
+		setPath(values, relativeKey(string(kv.Key), prefix), string(kv.Value))
+	}
+	return values, nil
+}
+
+// fetchJSON reads a JSON object of values from an HTTP endpoint.
+func (s ValueStore) fetchJSON(u *url.URL) (map[string]any, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if _, err := s.do(req, &values); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+	return values, nil
+}
+
+// do sends req and decodes a JSON response into v. It reports false without
+// an error for 404 responses.
+func (s ValueStore) do(req *http.Request, v any) (bool, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxArchiveSize)).Decode(v); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return true, nil
+}
+
+// relativeKey strips prefix and surrounding slashes from key.
+func relativeKey(key, prefix string) string {
+	return strings.Trim(strings.TrimPrefix(key, prefix), "/")
+}
+
+// setPath stores value in values under a "/"-separated key, creating nested
+// maps. A key that is both a value and a folder keeps the nested values.
+func setPath(values map[string]any, key string, value any) {
+	if key == "" {
+		return
+	}
+	parts := strings.Split(key, "/")
+	node := values
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := node[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			node[part] = next
+		}
+		node = next
+	}
+	last := parts[len(parts)-1]
+	if _, isMap := node[last].(map[string]any); !isMap {
+		node[last] = value
+	}
+}
+
+// prefixEnd returns the smallest key greater than every key with prefix, as
+// etcd range requests expect. An empty prefix ranges over all keys.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
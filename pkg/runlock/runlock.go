@@ -0,0 +1,179 @@
+package runlock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nabkey/home-files/pkg/owner"
+)
+
+// pollInterval is how often Acquire retries while waiting for a held lock.
+const pollInterval = 200 * time.Millisecond
+
+// unreadableGrace is how long a lock without a readable PID counts as held
+// before it is considered left behind by a crashed run.
+const unreadableGrace = 10 * time.Second
+
+// Path returns the run lockfile for a home directory.
+func Path(homeDir string) string {
+	return filepath.Join(homeDir, ".config", "homestruct", ".lock")
+}
+
+// Lock is a held run lock. It must be released with Release.
+type Lock struct {
+	path string
+}
+
+// HeldError reports that another live process holds the lock.
+type HeldError struct {
+	Path string
+	PID  int
+}
+
+func (e *HeldError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("another homestruct run holds the lock %s; wait for it to finish or retry with --wait", e.Path)
+	}
+	return fmt.Sprintf("another homestruct run (PID %d) holds the lock %s; wait for it to finish or retry with --wait", e.PID, e.Path)
+}
+
+// TryAcquire takes the lock at path, recording the current PID in it. A lock
+// left behind by a process that is no longer running is treated as stale and
+// replaced. If a live process holds the lock, a *HeldError is returned.
+// Directories created for the lock are assigned to o.
+func TryAcquire(path string, o *owner.Owner) (*Lock, error) {
+	if err := o.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	for {
+		err := create(path)
+		if err == nil {
+			return &Lock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		before, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Released in the meantime
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lock %s: %w", path, err)
+		}
+		pid, err := readPID(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		switch {
+		case err == nil && processAlive(pid):
+			return nil, &HeldError{Path: path, PID: pid}
+		case err != nil && time.Since(before.ModTime()) < unreadableGrace:
+			// Locks appear with their content, but one written by an
+			// older version may still be empty while its holder starts
+			return nil, &HeldError{Path: path}
+		}
+
+		// Stale lock from a crashed run. Another waiter may have replaced
+		// it already, in which case the new lock must be left alone.
+		after, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lock %s: %w", path, err)
+		}
+		if !os.SameFile(before, after) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+		}
+	}
+}
+
+// create atomically creates the lockfile with the current PID: the PID is
+// written to a temporary file that is then hard-linked into place, so the
+// lock never exists without its content. It fails with an error matching
+// os.ErrExist if the lock is held.
+func create(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lock-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, writeErr := fmt.Fprintf(tmp, "%d\n", os.Getpid())
+	if err := errors.Join(writeErr, tmp.Close()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Link(tmp.Name(), path)
+}
+
+// Acquire is like TryAcquire, but while a live process holds the lock it
+// calls onWait once with the holder's error and retries until the lock is free.
+func Acquire(path string, o *owner.Owner, onWait func(*HeldError)) (*Lock, error) {
+	waited := false
+	for {
+		lock, err := TryAcquire(path, o)
+		var held *HeldError
+		if !errors.As(err, &held) {
+			return lock, err
+		}
+		if !waited && onWait != nil {
+			onWait(held)
+		}
+		waited = true
+		time.Sleep(pollInterval)
+	}
+}
+
+// Release removes the lockfile. It is safe to call on a nil Lock and more than once.
+func (l *Lock) Release() error {
+	if l == nil || l.path == "" {
+		return nil
+	}
+	err := os.Remove(l.path)
+	l.path = ""
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// readPID reads the PID recorded in a lockfile. An empty lockfile is an error.
+func readPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// processAlive reports whether a process with the given PID is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// On Windows FindProcess fails for processes that do not exist
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
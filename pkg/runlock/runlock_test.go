@@ -0,0 +1,63 @@
+package runlock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTryAcquire(t *testing.T) {
+	path := Path(t.TempDir())
+
+	lock, err := TryAcquire(path, nil)
+	if err != nil {
+		t.Fatalf("TryAcquire: %v", err)
+	}
+	if pid, err := readPID(path); err != nil || pid != os.Getpid() {
+		t.Errorf("lock records PID %d (%v), want %d", pid, err, os.Getpid())
+	}
+
+	// The holder is alive, so a second attempt fails
+	_, err = TryAcquire(path, nil)
+	var held *HeldError
+	if !errors.As(err, &held) || held.PID != os.Getpid() {
+		t.Fatalf("second TryAcquire error = %v, want a *HeldError for PID %d", err, os.Getpid())
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("second Release: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock still exists after Release: %v", err)
+	}
+}
+
+func TestTryAcquireStaleLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("processAlive cannot tell a dead PID on Windows")
+	}
+	path := Path(t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A PID above the Linux and macOS maximum is never running
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n", 1<<30)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := TryAcquire(path, nil)
+	if err != nil {
+		t.Fatalf("TryAcquire over a stale lock: %v", err)
+	}
+	defer lock.Release()
+	if pid, err := readPID(path); err != nil || pid != os.Getpid() {
+		t.Errorf("lock records PID %d (%v), want %d", pid, err, os.Getpid())
+	}
+}